@@ -3,8 +3,10 @@ package config
 import (
 	"fmt"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/zricethezav/gitleaks/v6/options"
 
@@ -21,6 +23,22 @@ type AllowList struct {
 	Files       []*regexp.Regexp
 	Paths       []*regexp.Regexp
 	Repos       []*regexp.Regexp
+
+	// CommitMessages allowlist the commits whose message matches one of them, like "\[gitleaks skip\]"
+	CommitMessages []*regexp.Regexp
+	// Entropies allowlist low entropy leaks of rules with entropy ranges in some paths
+	Entropies []EntropyAllowance
+	// Fixtures are known fake secrets of tests, leaks whose offender is at most FixtureDistance edits away from
+	// one of them are allowlisted so fixtures mutated by tests don't turn into new leaks
+	Fixtures        []string
+	FixtureDistance int
+}
+
+// EntropyAllowance allowlists the leaks of rules with entropy ranges whose entropy is at most Max in the paths
+// matching one of Paths, or in every path if Paths is empty. Fixtures are full of such made up secrets.
+type EntropyAllowance struct {
+	Max   float64
+	Paths []*regexp.Regexp
 }
 
 // Entropy represents an entropy range
@@ -36,6 +54,9 @@ type Entropy struct {
 // that match is not allowlisted (globally or locally), then a leak will be appended
 // to the final scan report.
 type Rule struct {
+	// ID identifies the rule in reports and fingerprints, unlike Description it isn't meant to be reworded.
+	// It's empty if the rule doesn't set one.
+	ID          string
 	Description string
 	Regex       *regexp.Regexp
 	File        *regexp.Regexp
@@ -44,32 +65,71 @@ type Rule struct {
 	Tags        []string
 	AllowList   AllowList
 	Entropies   []Entropy
+
+	// ReportOnly rules report their leaks without failing the scan, to roll out new rules gradually
+	ReportOnly bool
+	// Severity is one of Severities, or empty if the rule doesn't set one
+	Severity string
+	// IgnoreGlobalAllowlist rules are checked in the files, paths and lines the global allowlist allowlists, so
+	// critical rules still fire where noisy rules are allowlisted. Only the allowlist of the rule applies.
+	IgnoreGlobalAllowlist bool
+	// Validate is the name of the checksum of Validators the offenders of the rule must pass, or empty
+	Validate string
+	// Parse is the name of the parser of Parsers the matches of the rule are parsed with, or empty
+	Parse string
+	// PairOnly rules only report their leaks as parts of the credential pairs of Pairs, for parts that aren't
+	// secrets on their own
+	PairOnly bool
+	// MinMatches is how many times the regex of the rule must match the content of a file for its matches to
+	// be reported, for data like email addresses that is only a leak in bulk
+	MinMatches int
 }
 
+// ruleIDRe matches the ids rules can set
+var ruleIDRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Severities are the severities rules can set, least severe first
+var Severities = []string{"info", "low", "medium", "high", "critical"}
+
 // Config is a composite struct of Rules and Allowlists
 // Each Rule contains a description, regular expression, tags, and allowlists if available
 type Config struct {
 	Rules     []Rule
 	Allowlist AllowList
+	Pairs     []Pair
+
+	// Policy is the policy bundle the config is of (--policy), nil without one
+	Policy *Policy
 }
 
 // TomlAllowList is a struct used in the TomlLoader that loads in allowlists from
 // specific rules or globally at the top level config
 type TomlAllowList struct {
-	Description string
-	Regexes     []string
-	Commits     []string
-	Files       []string
-	Paths       []string
-	Repos       []string
+	Description    string
+	Regexes        []string
+	Commits        []string
+	CommitMessages []string
+	Files          []string
+	Paths          []string
+	Repos          []string
+	Entropies      []struct {
+		Max   string
+		Paths []string
+	}
+	Fixtures        []string
+	FixtureDistance int `toml:"fixture-distance"`
 }
 
 // TomlLoader gets loaded with the values from a gitleaks toml config
 // see the config in config/defaults.go for an example. TomlLoader is used
 // to generate Config values (compiling regexes, etc).
 type TomlLoader struct {
+	// Version is the SchemaVersion of the config, configs without a version are of the current schema
+	Version   int
 	AllowList TomlAllowList
+	Pairs     []TomlPair
 	Rules     []struct {
+		ID          string
 		Description string
 		Regex       string
 		File        string
@@ -81,7 +141,14 @@ type TomlLoader struct {
 			Max   string
 			Group string
 		}
-		AllowList TomlAllowList
+		AllowList             TomlAllowList
+		ReportOnly            bool `toml:"report-only"`
+		Severity              string
+		IgnoreGlobalAllowlist bool `toml:"ignore-global-allowlist"`
+		Validate              string
+		MinMatches            int `toml:"min-matches"`
+		Parse                 string
+		PairOnly              bool `toml:"pair-only"`
 	}
 }
 
@@ -93,24 +160,52 @@ func NewConfig(options options.Options) (Config, error) {
 	var cfg Config
 	tomlLoader := TomlLoader{}
 
+	if options.Policy != "" {
+		keys, err := options.PolicyKeys()
+		if err != nil {
+			return cfg, err
+		}
+		policy, err := LoadPolicy(options.Policy, keys)
+		if err != nil {
+			return cfg, err
+		}
+		if err := policy.CheckFlags(options); err != nil {
+			return cfg, err
+		}
+		cfg = policy.Config
+		if options.EnableRules != "" {
+			err = cfg.EnableOptionalRules(options.EnableRules)
+		}
+		return cfg, err
+	}
+
 	var err error
+	var meta toml.MetaData
 	if options.Config != "" {
-		_, err = toml.DecodeFile(options.Config, &tomlLoader)
+		meta, err = toml.DecodeFile(options.Config, &tomlLoader)
+		if err == nil {
+			err = tomlLoader.Interpolate(filepath.Dir(options.Config))
+		}
 		// append a allowlist rule for allowlisting the config
 		tomlLoader.AllowList.Files = append(tomlLoader.AllowList.Files, path.Base(options.Config))
 	} else {
-		_, err = toml.Decode(DefaultConfig, &tomlLoader)
+		meta, err = toml.Decode(DefaultConfig, &tomlLoader)
 	}
 	if err != nil {
 		return cfg, err
 	}
+	if err := tomlLoader.CheckSchema(meta); err != nil {
+		return cfg, err
+	}
 
 	cfg, err = tomlLoader.Parse()
 	if err != nil {
 		return cfg, err
 	}
-
-	return cfg, nil
+	if options.EnableRules != "" {
+		err = cfg.EnableOptionalRules(options.EnableRules)
+	}
+	return cfg, err
 }
 
 // Parse will parse the values set in a TomlLoader and use those values
@@ -166,6 +261,18 @@ func (tomlLoader TomlLoader) Parse() (Config, error) {
 			allowList.Paths = append(allowList.Paths, allowListedRegex)
 		}
 
+		// rule specific entropies
+		allowList.Entropies, err = rule.AllowList.parseEntropies()
+		if err != nil {
+			return cfg, err
+		}
+
+		// rule specific fixtures
+		allowList.Fixtures, allowList.FixtureDistance, err = rule.AllowList.parseFixtures()
+		if err != nil {
+			return cfg, err
+		}
+
 		var entropies []Entropy
 		for _, e := range rule.Entropies {
 			min, err := strconv.ParseFloat(e.Min, 64)
@@ -195,7 +302,26 @@ func (tomlLoader TomlLoader) Parse() (Config, error) {
 			entropies = append(entropies, Entropy{Min: min, Max: max, Group: int(group)})
 		}
 
+		severity := strings.ToLower(rule.Severity)
+		if severity != "" && !validSeverity(severity) {
+			return cfg, fmt.Errorf("problem loading config: invalid severity %q of rule %s, must be one of %s",
+				rule.Severity, rule.Description, strings.Join(Severities, ", "))
+		}
+
+		if _, ok := Validators[rule.Validate]; rule.Validate != "" && !ok {
+			return cfg, fmt.Errorf("problem loading config: unknown validate %q of rule %s, must be luhn, iban or ssn",
+				rule.Validate, rule.Description)
+		}
+		if _, ok := Parsers[rule.Parse]; rule.Parse != "" && !ok {
+			return cfg, fmt.Errorf("problem loading config: unknown parse %q of rule %s, must be connection-string",
+				rule.Parse, rule.Description)
+		}
+		if rule.MinMatches < 0 {
+			return cfg, fmt.Errorf("problem loading config: min-matches of rule %s can't be negative", rule.Description)
+		}
+
 		r := Rule{
+			ID:          rule.ID,
 			Description: rule.Description,
 			Regex:       re,
 			File:        fileNameRe,
@@ -204,6 +330,26 @@ func (tomlLoader TomlLoader) Parse() (Config, error) {
 			Tags:        rule.Tags,
 			AllowList:   allowList,
 			Entropies:   entropies,
+			ReportOnly:  rule.ReportOnly,
+			Severity:    severity,
+
+			IgnoreGlobalAllowlist: rule.IgnoreGlobalAllowlist,
+			Validate:              rule.Validate,
+			MinMatches:            rule.MinMatches,
+			Parse:                 rule.Parse,
+			PairOnly:              rule.PairOnly,
+		}
+		if r.ID != "" {
+			if !ruleIDRe.MatchString(r.ID) {
+				return cfg, fmt.Errorf("problem loading config: invalid id %q of rule %s, ids may only hold letters, digits, '.', '_' and '-'",
+					r.ID, r.Description)
+			}
+			for _, other := range cfg.Rules {
+				if other.ID == r.ID {
+					return cfg, fmt.Errorf("problem loading config: rules %s and %s have the same id %q",
+						other.Description, r.Description, r.ID)
+				}
+			}
 		}
 
 		cfg.Rules = append(cfg.Rules, r)
@@ -245,8 +391,82 @@ func (tomlLoader TomlLoader) Parse() (Config, error) {
 		cfg.Allowlist.Repos = append(cfg.Allowlist.Repos, re)
 	}
 
+	// global commit message allowLists
+	for _, allowListCommitMessage := range tomlLoader.AllowList.CommitMessages {
+		re, err := regexp.Compile(allowListCommitMessage)
+		if err != nil {
+			return cfg, fmt.Errorf("problem loading config: %v", err)
+		}
+		cfg.Allowlist.CommitMessages = append(cfg.Allowlist.CommitMessages, re)
+	}
+
+	// global entropy allowLists
+	entropies, err := tomlLoader.AllowList.parseEntropies()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Allowlist.Entropies = entropies
+
+	// global fixture allowLists
+	cfg.Allowlist.Fixtures, cfg.Allowlist.FixtureDistance, err = tomlLoader.AllowList.parseFixtures()
+	if err != nil {
+		return cfg, err
+	}
+
 	cfg.Allowlist.Commits = tomlLoader.AllowList.Commits
 	cfg.Allowlist.Description = tomlLoader.AllowList.Description
 
-	return cfg, nil
+	cfg.Pairs, err = cfg.parsePairs(tomlLoader.Pairs)
+	return cfg, err
+}
+
+// validSeverity returns true if severity is one of Severities
+func validSeverity(severity string) bool {
+	for _, s := range Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoresGlobalAllowlist returns true if any rule of the config is checked in spite of the global allowlist
+func (cfg Config) IgnoresGlobalAllowlist() bool {
+	for _, rule := range cfg.Rules {
+		if rule.IgnoreGlobalAllowlist {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFixtures returns the fixtures of an allowlist and the edit distance they allowlist offenders within
+func (allowList TomlAllowList) parseFixtures() ([]string, int, error) {
+	if allowList.FixtureDistance < 0 {
+		return nil, 0, fmt.Errorf("problem loading config: allowlist fixture-distance can't be negative")
+	}
+	return allowList.Fixtures, allowList.FixtureDistance, nil
+}
+
+// parseEntropies parses the entropy allowances of an allowlist
+func (allowList TomlAllowList) parseEntropies() ([]EntropyAllowance, error) {
+	var allowances []EntropyAllowance
+	for _, e := range allowList.Entropies {
+		max, err := strconv.ParseFloat(e.Max, 64)
+		if err != nil {
+			return nil, fmt.Errorf("problem loading config: invalid allowlist entropy max %q: %v", e.Max, err)
+		} else if max > 8.0 || max < 0.0 {
+			return nil, fmt.Errorf("problem loading config: invalid allowlist entropy max, must be within 0.0-8.0")
+		}
+		allowance := EntropyAllowance{Max: max}
+		for _, p := range e.Paths {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("problem loading config: %v", err)
+			}
+			allowance.Paths = append(allowance.Paths, re)
+		}
+		allowances = append(allowances, allowance)
+	}
+	return allowances, nil
 }
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Export returns cfg as a toml config of SchemaVersion (gitleaks config export --resolved). The config is the one
+// scans run with: environment variables and files are interpolated, severities normalized and the allowlist
+// entry of the config file is added. Loading it gives back cfg.
+func Export(cfg Config) ([]byte, error) {
+	out := map[string]interface{}{"version": SchemaVersion}
+	if allowlist := exportAllowList(cfg.Allowlist); len(allowlist) != 0 {
+		out["allowlist"] = allowlist
+	}
+
+	var rules []map[string]interface{}
+	for _, rule := range cfg.Rules {
+		r := make(map[string]interface{})
+		set(r, "id", rule.ID)
+		set(r, "description", rule.Description)
+		set(r, "regex", regexString(rule.Regex))
+		set(r, "file", regexString(rule.File))
+		set(r, "path", regexString(rule.Path))
+		set(r, "severity", rule.Severity)
+		set(r, "validate", rule.Validate)
+		set(r, "parse", rule.Parse)
+		if rule.MinMatches != 0 {
+			r["min-matches"] = rule.MinMatches
+		}
+		if rule.ReportGroup != 0 {
+			r["reportGroup"] = rule.ReportGroup
+		}
+		if len(rule.Tags) != 0 {
+			r["tags"] = rule.Tags
+		}
+		if rule.ReportOnly {
+			r["report-only"] = true
+		}
+		if rule.PairOnly {
+			r["pair-only"] = true
+		}
+		if rule.IgnoreGlobalAllowlist {
+			r["ignore-global-allowlist"] = true
+		}
+		var entropies []map[string]interface{}
+		for _, e := range rule.Entropies {
+			entropies = append(entropies, map[string]interface{}{
+				"Min":   formatEntropy(e.Min),
+				"Max":   formatEntropy(e.Max),
+				"Group": strconv.Itoa(e.Group),
+			})
+		}
+		if len(entropies) != 0 {
+			r["Entropies"] = entropies
+		}
+		if allowlist := exportAllowList(rule.AllowList); len(allowlist) != 0 {
+			r["allowlist"] = allowlist
+		}
+		rules = append(rules, r)
+	}
+	if len(rules) != 0 {
+		out["rules"] = rules
+	}
+
+	var pairs []map[string]interface{}
+	for _, pair := range cfg.Pairs {
+		p := map[string]interface{}{"rules": pair.Rules}
+		set(p, "id", pair.ID)
+		set(p, "description", pair.Description)
+		set(p, "severity", pair.Severity)
+		if pair.MaxLines != 0 {
+			p["max-lines"] = pair.MaxLines
+		}
+		pairs = append(pairs, p)
+	}
+	if len(pairs) != 0 {
+		out["pairs"] = pairs
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(out); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// exportAllowList returns the settings of allowList as they are written in toml configs
+func exportAllowList(allowList AllowList) map[string]interface{} {
+	out := make(map[string]interface{})
+	set(out, "description", allowList.Description)
+	setRegexes(out, "regexes", allowList.Regexes)
+	setRegexes(out, "commitMessages", allowList.CommitMessages)
+	setValues(out, "files", patterns(allowList.Files))
+	setValues(out, "paths", patterns(allowList.Paths))
+	setValues(out, "repos", patterns(allowList.Repos))
+	setValues(out, "commits", allowList.Commits)
+	setValues(out, "fixtures", allowList.Fixtures)
+	if allowList.FixtureDistance != 0 {
+		out["fixture-distance"] = allowList.FixtureDistance
+	}
+	var entropies []map[string]interface{}
+	for _, e := range allowList.Entropies {
+		entropy := map[string]interface{}{"max": formatEntropy(e.Max)}
+		setValues(entropy, "paths", patterns(e.Paths))
+		entropies = append(entropies, entropy)
+	}
+	if len(entropies) != 0 {
+		out["entropies"] = entropies
+	}
+	return out
+}
+
+// set sets key of m to value unless it's empty
+func set(m map[string]interface{}, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+// setValues sets key of m to values unless there are none. The values are of fields that are interpolated, their
+// ${ is escaped so it isn't interpolated when the exported config is loaded.
+func setValues(m map[string]interface{}, key string, values []string) {
+	var escaped []string
+	for _, value := range values {
+		escaped = append(escaped, strings.ReplaceAll(value, "${", "$${"))
+	}
+	if len(escaped) != 0 {
+		m[key] = escaped
+	}
+}
+
+// setRegexes sets key of m to the patterns of res unless there are none
+func setRegexes(m map[string]interface{}, key string, res []*regexp.Regexp) {
+	if p := patterns(res); len(p) != 0 {
+		m[key] = p
+	}
+}
+
+func patterns(res []*regexp.Regexp) []string {
+	var p []string
+	for _, re := range res {
+		p = append(p, re.String())
+	}
+	return p
+}
+
+func regexString(re *regexp.Regexp) string {
+	if re == nil {
+		return ""
+	}
+	return re.String()
+}
+
+func formatEntropy(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// fileRefPrefix starts config values that are replaced by the content of a file
+const fileRefPrefix = "file://"
+
+// envRefRe matches the ${NAME} references to environment variables of config values, and $${ escapes
+var envRefRe = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Interpolate replaces the ${NAME} references in the value fields of the config with the value of the
+// environment variable NAME, $${ being a literal ${, and values of the form file://path with the content of the
+// file at path without its trailing line break. Relative paths are relative to dir, the directory of the config.
+// Configs can then be committed without the credentials or host specific paths they use. Only the --config file
+// is interpolated, the configs of scanned repos could otherwise read the environment and files of gitleaks.
+//
+// The value fields are the commits, files, paths, repos and fixtures of allowlists. Rule regexes, files, paths
+// and descriptions are kept as written: $ and { are regex syntax, and a regex read from a file could not be
+// reviewed with the config.
+func (tomlLoader *TomlLoader) Interpolate(dir string) error {
+	if err := interpolateAllowList(&tomlLoader.AllowList, dir); err != nil {
+		return err
+	}
+	for i := range tomlLoader.Rules {
+		if err := interpolateAllowList(&tomlLoader.Rules[i].AllowList, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interpolateAllowList interpolates the value fields of allowList
+func interpolateAllowList(allowList *TomlAllowList, dir string) error {
+	values := [][]string{allowList.Commits, allowList.Files, allowList.Paths, allowList.Repos, allowList.Fixtures}
+	for _, e := range allowList.Entropies {
+		values = append(values, e.Paths)
+	}
+	for _, v := range values {
+		for i := range v {
+			s, err := interpolate(v[i], dir)
+			if err != nil {
+				return err
+			}
+			v[i] = s
+		}
+	}
+	return nil
+}
+
+// interpolate returns the config value s with its references replaced
+func interpolate(s, dir string) (string, error) {
+	if strings.HasPrefix(s, fileRefPrefix) {
+		path := strings.TrimPrefix(s, fileRefPrefix)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("problem loading config: %v", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	var err error
+	s = envRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		name := ref[2 : len(ref)-1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("problem loading config: environment variable %s is not set", name)
+		}
+		return value
+	})
+	return s, err
+}
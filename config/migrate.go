@@ -0,0 +1,169 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SchemaVersion is the version of the config schema of this gitleaks, set by the version field of configs.
+// Configs without a version are of the current schema unless they use settings of older schemas.
+//
+// Version 1 configs allowlist with [whitelist] and [[rules.whitelist]] tables, the latter an entry per regex,
+// file or path, and set the file and path a rule applies to with fileNameRegex and filePathRegex.
+const SchemaVersion = 2
+
+// legacyKeys are the settings of version 1 configs renamed by version 2
+var legacyKeys = []string{"whitelist", "fileNameRegex", "filePathRegex"}
+
+// migrations upgrade a decoded config of the schema version of their index to the next version
+var migrations = map[int]func(cfg map[string]interface{}) error{
+	1: migrateV1,
+}
+
+// CheckSchema returns an error if the config decoded with meta is of another schema than SchemaVersion,
+// suggesting `gitleaks config migrate` for older configs. Settings of older schemas would be silently ignored.
+func (tomlLoader TomlLoader) CheckSchema(meta toml.MetaData) error {
+	if tomlLoader.Version > SchemaVersion {
+		return fmt.Errorf("problem loading config: config version %d is newer than the version %d this gitleaks supports",
+			tomlLoader.Version, SchemaVersion)
+	}
+	for _, key := range meta.Undecoded() {
+		if isLegacyKey(key[len(key)-1]) {
+			return fmt.Errorf("problem loading config: %s is a setting of config version 1, "+
+				"upgrade the config with `gitleaks config migrate`", key)
+		}
+	}
+	if tomlLoader.Version != 0 && tomlLoader.Version < SchemaVersion {
+		return fmt.Errorf("problem loading config: config version %d is older than version %d, "+
+			"upgrade the config with `gitleaks config migrate`", tomlLoader.Version, SchemaVersion)
+	}
+	return nil
+}
+
+// isLegacyKey returns true if key is a setting of version 1 configs
+func isLegacyKey(key string) bool {
+	for _, k := range legacyKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Migrate upgrades the config b to SchemaVersion, returning the upgraded config and the version it was of.
+// Comments and the formatting of b are not kept.
+func Migrate(b []byte) ([]byte, int, error) {
+	cfg := make(map[string]interface{})
+	if _, err := toml.Decode(string(b), &cfg); err != nil {
+		return nil, 0, err
+	}
+
+	version, err := schemaVersion(cfg)
+	if err != nil {
+		return nil, 0, err
+	}
+	for v := version; v < SchemaVersion; v++ {
+		if err := migrations[v](cfg); err != nil {
+			return nil, version, fmt.Errorf("unable to migrate config version %d: %v", v, err)
+		}
+	}
+	cfg["version"] = SchemaVersion
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+		return nil, version, err
+	}
+	return buf.Bytes(), version, nil
+}
+
+// schemaVersion returns the schema version of the decoded config cfg, guessed from its settings if it has
+// no version
+func schemaVersion(cfg map[string]interface{}) (int, error) {
+	if v, ok := cfg["version"]; ok {
+		version, ok := v.(int64)
+		if !ok || version < 1 || version > SchemaVersion {
+			return 0, fmt.Errorf("unknown config version %v", v)
+		}
+		return int(version), nil
+	}
+	for _, table := range append(tables(cfg["rules"]), cfg) {
+		for key := range table {
+			if isLegacyKey(key) {
+				return 1, nil
+			}
+		}
+	}
+	return SchemaVersion, nil
+}
+
+// migrateV1 renames the whitelists of version 1 configs to allowlists and the fileNameRegex and filePathRegex
+// of rules to file and path
+func migrateV1(cfg map[string]interface{}) error {
+	if whitelist, ok := cfg["whitelist"]; ok {
+		allowlist, err := migrateWhitelist(whitelist)
+		if err != nil {
+			return err
+		}
+		cfg["allowlist"] = allowlist
+		delete(cfg, "whitelist")
+	}
+	for _, rule := range tables(cfg["rules"]) {
+		for old, key := range map[string]string{"fileNameRegex": "file", "filePathRegex": "path"} {
+			if v, ok := rule[old]; ok {
+				rule[key] = v
+				delete(rule, old)
+			}
+		}
+		if whitelist, ok := rule["whitelist"]; ok {
+			allowlist, err := migrateWhitelist(whitelist)
+			if err != nil {
+				return err
+			}
+			rule["allowlist"] = allowlist
+			delete(rule, "whitelist")
+		}
+	}
+	return nil
+}
+
+// migrateWhitelist returns the allowlist of a version 1 whitelist. Whitelists of rules are arrays of entries
+// with a single regex, file or path, which are gathered into the lists of one allowlist.
+func migrateWhitelist(whitelist interface{}) (map[string]interface{}, error) {
+	switch w := whitelist.(type) {
+	case map[string]interface{}:
+		return w, nil
+	case []map[string]interface{}:
+		allowlist := make(map[string]interface{})
+		var descriptions []string
+		for _, entry := range w {
+			for key, v := range entry {
+				switch key {
+				case "description":
+					if s, ok := v.(string); ok && s != "" {
+						descriptions = append(descriptions, s)
+					}
+				case "regex", "file", "path":
+					lists := map[string]string{"regex": "regexes", "file": "files", "path": "paths"}
+					list, _ := allowlist[lists[key]].([]interface{})
+					allowlist[lists[key]] = append(list, v)
+				default:
+					return nil, fmt.Errorf("unknown whitelist setting %q", key)
+				}
+			}
+		}
+		if len(descriptions) != 0 {
+			allowlist["description"] = strings.Join(descriptions, ", ")
+		}
+		return allowlist, nil
+	}
+	return nil, fmt.Errorf("whitelist must be a table or an array of tables")
+}
+
+// tables returns the tables of the decoded array of tables v
+func tables(v interface{}) []map[string]interface{} {
+	t, _ := v.([]map[string]interface{})
+	return t
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// OptionalConfig holds the built-in rules that are off by default, added to the config of the scan by their tags
+// with --enable-rules. They detect data that isn't a secret but mustn't be committed either, like card numbers
+// (pci) and personal data (pii), and are noisier and slower than the rules for secrets. Email addresses and
+// phone numbers are only reported in bulk, by files holding many of them.
+const OptionalConfig = `
+[[rules]]
+	id = "credit-card-number"
+	description = "Credit Card Number"
+	regex = '''\b(?:4|5[1-5]|2[2-7]|3[47]|6011|65)(?:[ -]?[0-9]){10,18}\b'''
+	validate = "luhn"
+	severity = "high"
+	tags = ["pci", "card"]
+
+[[rules]]
+	id = "iban"
+	description = "IBAN"
+	regex = '''\b[A-Z]{2}[0-9]{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b'''
+	validate = "iban"
+	severity = "medium"
+	tags = ["pci", "iban"]
+
+[[rules]]
+	id = "us-ssn"
+	description = "US Social Security Number"
+	regex = '''\b[0-9]{3}-[0-9]{2}-[0-9]{4}\b'''
+	validate = "ssn"
+	severity = "high"
+	tags = ["pii", "national-id"]
+
+[[rules]]
+	id = "uk-national-insurance-number"
+	description = "UK National Insurance Number"
+	regex = '''\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?[0-9]{2} ?[0-9]{2} ?[0-9]{2} ?[A-D]\b'''
+	severity = "high"
+	tags = ["pii", "national-id"]
+
+[[rules]]
+	id = "email-addresses-in-bulk"
+	description = "Email Addresses in Bulk"
+	regex = '''\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b'''
+	min-matches = 20
+	severity = "medium"
+	tags = ["pii", "email"]
+
+[[rules]]
+	id = "phone-numbers-in-bulk"
+	description = "Phone Numbers in Bulk"
+	regex = '''(?:\+[1-9][0-9]{7,14}|\(?\b[0-9]{3}\)?[ .-]?[0-9]{3}[ .-][0-9]{4})\b'''
+	min-matches = 20
+	severity = "medium"
+	tags = ["pii", "phone"]
+`
+
+// EnableOptionalRules adds the rules of OptionalConfig with one of tags, a comma separated list, to cfg. Rules
+// with the id or description of a rule of cfg are left out.
+func (cfg *Config) EnableOptionalRules(tags string) error {
+	var tomlLoader TomlLoader
+	if _, err := toml.Decode(OptionalConfig, &tomlLoader); err != nil {
+		return err
+	}
+	optional, err := tomlLoader.Parse()
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool)
+	for _, rule := range optional.Rules {
+		for _, tag := range rule.Tags {
+			known[tag] = true
+		}
+	}
+	enabled := make(map[string]bool)
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if !known[tag] {
+			var knownTags []string
+			for t := range known {
+				knownTags = append(knownTags, t)
+			}
+			sort.Strings(knownTags)
+			return fmt.Errorf("unknown --enable-rules tag %q, the optional rules are tagged %s", tag,
+				strings.Join(knownTags, ", "))
+		}
+		enabled[tag] = true
+	}
+
+	for _, rule := range optional.Rules {
+		for _, tag := range rule.Tags {
+			if !enabled[tag] {
+				continue
+			}
+			if _, ok := cfg.rule(rule); !ok {
+				cfg.Rules = append(cfg.Rules, rule)
+			}
+			break
+		}
+	}
+	return nil
+}
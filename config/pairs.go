@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultPairSeverity is the severity of pairs that don't set one, a pair of credentials is exploitable while its
+// parts on their own often aren't
+const defaultPairSeverity = "critical"
+
+// Pair is a credential pair ([[pairs]]), like an aws access key id and its secret key. The leaks of the rules of a
+// pair found in the same commit are also reported as one leak of the pair, with the severity of the pair.
+type Pair struct {
+	ID          string
+	Description string
+	// Rules are the ids or descriptions of the rules of the parts of the pair
+	Rules    []string
+	Severity string
+	// MaxLines is how many lines apart the parts of the pair may be in the same file, or 0 if they may be anywhere
+	// in the commit
+	MaxLines int
+}
+
+// TomlPair is a [[pairs]] entry of a gitleaks toml config
+type TomlPair struct {
+	ID          string
+	Description string
+	Rules       []string
+	Severity    string
+	MaxLines    int `toml:"max-lines"`
+}
+
+// parsePairs returns the pairs of tomlPairs, whose rules must be rules of cfg
+func (cfg Config) parsePairs(tomlPairs []TomlPair) ([]Pair, error) {
+	var pairs []Pair
+	for _, p := range tomlPairs {
+		if len(p.Rules) < 2 {
+			return nil, fmt.Errorf("problem loading config: pair %s must have at least two rules", p.Description)
+		}
+		for _, name := range p.Rules {
+			if _, ok := cfg.rule(Rule{ID: name, Description: name}); !ok {
+				return nil, fmt.Errorf("problem loading config: pair %s has no rule %s", p.Description, name)
+			}
+		}
+		severity := strings.ToLower(p.Severity)
+		if severity == "" {
+			severity = defaultPairSeverity
+		} else if !validSeverity(severity) {
+			return nil, fmt.Errorf("problem loading config: invalid severity %q of pair %s, must be one of %s",
+				p.Severity, p.Description, strings.Join(Severities, ", "))
+		}
+		if p.MaxLines < 0 {
+			return nil, fmt.Errorf("problem loading config: max-lines of pair %s can't be negative", p.Description)
+		}
+		pairs = append(pairs, Pair{
+			ID:          p.ID,
+			Description: p.Description,
+			Rules:       p.Rules,
+			Severity:    severity,
+			MaxLines:    p.MaxLines,
+		})
+	}
+	return pairs, nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// NormalizePath returns p the way the file and path allowlists and rules are matched against it and reports
+// show it: separated by forward slashes like the paths of git, without a leading ./, so patterns written with
+// forward slashes match the files of Windows worktrees too. Paths aren't case folded, matching is case
+// sensitive on every platform like git. Patterns match the files of case insensitive worktrees in any case
+// with (?i).
+func NormalizePath(p string) string {
+	return normalizePath(p, filepath.Separator)
+}
+
+// SplitPath returns the directory and the name of the file at p, normalized, that path and file allowlists and
+// rules are matched against. Files at the root of a repo are in directory ".".
+func SplitPath(p string) (dir, file string) {
+	return splitPath(p, filepath.Separator)
+}
+
+// normalizePath normalizes p, a path separated by separator
+func normalizePath(p string, separator rune) string {
+	if separator != '/' {
+		p = strings.ReplaceAll(p, string(separator), "/")
+	}
+	for strings.HasPrefix(p, "./") {
+		p = strings.TrimLeft(p[2:], "/")
+	}
+	return p
+}
+
+func splitPath(p string, separator rune) (dir, file string) {
+	p = normalizePath(p, separator)
+	return path.Dir(p), path.Base(p)
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v6/options"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	log "github.com/sirupsen/logrus"
+	// bundles signed by keys without hash preferences are hashed with RIPEMD-160
+	_ "golang.org/x/crypto/ripemd160"
+)
+
+const (
+	// policyConfigFile is the config of the rules and allowlists a policy bundle mandates and policyFile the
+	// settings of the policy
+	policyConfigFile = "gitleaks.toml"
+	policyFile       = "policy.toml"
+
+	// severityOfRulesWithout is the severity rules without one are treated as by minimum-severity, the severity
+	// their leaks are reported with
+	severityOfRulesWithout = "high"
+)
+
+// Policy is a policy bundle of an organization (--policy), a tar archive signed by one of the keys of
+// --policy-key holding the config of the rules and allowlists every scan must run with, gitleaks.toml, and
+// the settings of the policy, policy.toml:
+//
+//	# leaks of rules below the minimum severity don't fail the scan, rules at or above it can't be report-only
+//	minimum-severity = "medium"
+//
+//	# flags scans must run with, by their long name
+//	[required-flags]
+//	redact = true
+//
+// Repo configs (--repo-config) can add rules to those of the policy but can't change them.
+type Policy struct {
+	Config          Config
+	MinimumSeverity string
+	RequiredFlags   map[string]interface{}
+}
+
+// tomlPolicy is the policy.toml of a policy bundle
+type tomlPolicy struct {
+	MinimumSeverity string                 `toml:"minimum-severity"`
+	RequiredFlags   map[string]interface{} `toml:"required-flags"`
+}
+
+// LoadPolicy reads the policy bundle at path, refusing bundles that aren't signed by one of keys. Bundles are
+// signed pgp messages, as made by `gpg --sign`, armored or not, of a tar archive, gzipped or not.
+func LoadPolicy(path string, keys openpgp.EntityList) (*Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("problem loading policy: %v", err)
+	}
+	archive, err := verifyPolicy(b, keys)
+	if err != nil {
+		return nil, fmt.Errorf("problem loading policy %s: %v", path, err)
+	}
+	files, err := policyFiles(archive)
+	if err != nil {
+		return nil, fmt.Errorf("problem loading policy %s: %v", path, err)
+	}
+
+	cfgFile, ok := files[policyConfigFile]
+	if !ok {
+		return nil, fmt.Errorf("problem loading policy %s: no %s in the bundle", path, policyConfigFile)
+	}
+	var tomlLoader TomlLoader
+	meta, err := toml.Decode(cfgFile, &tomlLoader)
+	if err != nil {
+		return nil, fmt.Errorf("problem loading policy %s: %v", path, err)
+	}
+	if err := tomlLoader.CheckSchema(meta); err != nil {
+		return nil, err
+	}
+	cfg, err := tomlLoader.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var settings tomlPolicy
+	if _, err := toml.Decode(files[policyFile], &settings); err != nil {
+		return nil, fmt.Errorf("problem loading policy %s: %v", path, err)
+	}
+	minimum := strings.ToLower(settings.MinimumSeverity)
+	if minimum != "" && !validSeverity(minimum) {
+		return nil, fmt.Errorf("problem loading policy %s: invalid minimum-severity %q, must be one of %s",
+			path, settings.MinimumSeverity, strings.Join(Severities, ", "))
+	}
+	policy := &Policy{MinimumSeverity: minimum, RequiredFlags: settings.RequiredFlags}
+	policy.Config = policy.enforce(cfg)
+	policy.Config.Policy = policy
+	return policy, nil
+}
+
+// verifyPolicy returns the archive of the signed policy bundle b if it's signed by one of keys
+func verifyPolicy(b []byte, keys openpgp.EntityList) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(b)
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("-----BEGIN")) {
+		block, err := armor.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		r = block.Body
+	}
+	md, err := openpgp.ReadMessage(r, keys, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !md.IsSigned || md.SignedBy == nil {
+		return nil, fmt.Errorf("the bundle isn't signed by a key of --policy-key")
+	}
+	archive, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, err
+	}
+	// the signature is only checked once the whole message is read
+	if md.SignatureError != nil {
+		return nil, fmt.Errorf("invalid signature: %v", md.SignatureError)
+	}
+	return archive, nil
+}
+
+// policyFiles returns the contents of the files of the tar archive of a policy bundle by their name
+func policyFiles(archive []byte) (map[string]string, error) {
+	var r io.Reader = bytes.NewReader(archive)
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	files := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Base(hdr.Name)] = string(b)
+	}
+}
+
+// enforce returns cfg with the minimum severity of the policy applied to its rules
+func (policy *Policy) enforce(cfg Config) Config {
+	if policy.MinimumSeverity == "" {
+		return cfg
+	}
+	rules := make([]Rule, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		severity := rule.Severity
+		if severity == "" {
+			severity = severityOfRulesWithout
+		}
+		rule.ReportOnly = severityRank(severity) < severityRank(policy.MinimumSeverity)
+		rules[i] = rule
+	}
+	cfg.Rules = rules
+	return cfg
+}
+
+// severityRank returns the rank of severity in Severities, least severe first
+func severityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// Merge returns the config of the policy with the rules of repoCfg, the config of a scanned repo (--repo-config),
+// added. Repo configs can't weaken the policy: rules with the id or description of a rule of the policy and
+// the global allowlist of repoCfg are left out.
+func (policy *Policy) Merge(repoCfg Config) Config {
+	cfg := policy.Config
+	cfg.Rules = append([]Rule(nil), policy.Config.Rules...)
+	for _, rule := range policy.enforce(repoCfg).Rules {
+		if mandated, ok := policy.Config.rule(rule); ok {
+			log.Warnf("the repo config can't change rule %s of the policy, it is left out", mandated.Description)
+			continue
+		}
+		cfg.Rules = append(cfg.Rules, rule)
+	}
+	if !reflect.DeepEqual(repoCfg.Allowlist, AllowList{}) {
+		log.Warnf("the global allowlist of the repo config is left out, the policy sets the global allowlist")
+	}
+	return cfg
+}
+
+// CheckFlags returns an error if opts aren't set to the required flags of the policy
+func (policy *Policy) CheckFlags(opts options.Options) error {
+	values := make(map[string]reflect.Value)
+	v := reflect.ValueOf(opts)
+	for i := 0; i < v.NumField(); i++ {
+		if long := v.Type().Field(i).Tag.Get("long"); long != "" {
+			values[long] = v.Field(i)
+		}
+	}
+
+	var flags []string
+	for flag := range policy.RequiredFlags {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+	for _, flag := range flags {
+		required := fmt.Sprint(policy.RequiredFlags[flag])
+		value, ok := values[flag]
+		if !ok {
+			return fmt.Errorf("the policy requires --%s, which this gitleaks doesn't have", flag)
+		}
+		if fmt.Sprint(value.Interface()) != required {
+			return fmt.Errorf("the policy requires --%s=%s", flag, required)
+		}
+	}
+	return nil
+}
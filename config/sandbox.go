@@ -0,0 +1,82 @@
+package config
+
+import (
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Sandbox returns cfg, the config of the scan, with what --repo-config-allow allows the config of a scanned repo,
+// repoCfg, to change added to it: the rules of repoCfg and the entries of kinds of its global allowlist. Rules
+// with the id or description of a rule of cfg and anything else repoCfg sets are left out. The global allowlist
+// of a policy can't be added to.
+func (cfg Config) Sandbox(repoCfg Config, allow []string) Config {
+	allowed := make(map[string]bool)
+	for _, a := range allow {
+		allowed[a] = true
+	}
+	leftOut := func(change string, n int) bool {
+		if n == 0 {
+			return false
+		}
+		if !allowed[change] {
+			log.Warnf("%s of the repo config are left out, --repo-config-allow doesn't allow %s", change, change)
+			return true
+		}
+		if cfg.Policy != nil && change != "rules" {
+			log.Warnf("%s of the repo config are left out, the policy sets the global allowlist", change)
+			return true
+		}
+		return false
+	}
+
+	var rules []Rule
+	if !leftOut("rules", len(repoCfg.Rules)) {
+		rules = repoCfg.Rules
+	}
+	if cfg.Policy != nil {
+		return cfg.Policy.Merge(Config{Rules: rules})
+	}
+
+	sandboxed := cfg
+	sandboxed.Rules = append([]Rule(nil), cfg.Rules...)
+	for _, rule := range rules {
+		if existing, ok := cfg.rule(rule); ok {
+			log.Warnf("the repo config can't change rule %s, it is left out", existing.Description)
+			continue
+		}
+		sandboxed.Rules = append(sandboxed.Rules, rule)
+	}
+
+	allowList := &sandboxed.Allowlist
+	add := func(change string, entries *[]*regexp.Regexp, repoEntries []*regexp.Regexp) {
+		if !leftOut(change, len(repoEntries)) {
+			*entries = append(append([]*regexp.Regexp(nil), *entries...), repoEntries...)
+		}
+	}
+	add("allowlist-paths", &allowList.Paths, repoCfg.Allowlist.Paths)
+	add("allowlist-files", &allowList.Files, repoCfg.Allowlist.Files)
+	add("allowlist-regexes", &allowList.Regexes, repoCfg.Allowlist.Regexes)
+	add("allowlist-commit-messages", &allowList.CommitMessages, repoCfg.Allowlist.CommitMessages)
+	if !leftOut("allowlist-commits", len(repoCfg.Allowlist.Commits)) {
+		allowList.Commits = append(append([]string(nil), allowList.Commits...), repoCfg.Allowlist.Commits...)
+	}
+	if !leftOut("allowlist-fixtures", len(repoCfg.Allowlist.Fixtures)) {
+		// the allowlist has a single fixture distance, the larger of the two applies to all fixtures
+		allowList.Fixtures = append(append([]string(nil), allowList.Fixtures...), repoCfg.Allowlist.Fixtures...)
+		if repoCfg.Allowlist.FixtureDistance > allowList.FixtureDistance {
+			allowList.FixtureDistance = repoCfg.Allowlist.FixtureDistance
+		}
+	}
+	return sandboxed
+}
+
+// rule returns the rule of cfg with the id or description of rule
+func (cfg Config) rule(rule Rule) (Rule, bool) {
+	for _, r := range cfg.Rules {
+		if (rule.ID != "" && rule.ID == r.ID) || rule.Description == r.Description {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"math/big"
+	"strings"
+)
+
+// Validators are the checksums rules can validate their offenders with (validate). Matches failing the checksum
+// of their rule aren't reported, which keeps rules for numbers like card numbers from reporting every long
+// number.
+var Validators = map[string]func(offender string) bool{
+	"luhn": validLuhn,
+	"iban": validIBAN,
+	"ssn":  validSSN,
+}
+
+// validLuhn returns true if offender, with spaces and dashes left out, is a card number of 13 to 19 digits
+// passing the Luhn checksum
+func validLuhn(offender string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(offender)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		// every second digit from the right is doubled
+		if (len(digits)-i)%2 == 0 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// ibanLengths are the lengths of the ibans of the countries using them
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BR": 29,
+	"CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "EG": 29, "ES": 24,
+	"FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27, "GT": 28, "HR": 21,
+	"HU": 28, "IE": 22, "IL": 23, "IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LI": 21,
+	"LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24, "ME": 22, "MK": 19, "MR": 27, "MT": 31, "MU": 30,
+	"NL": 18, "NO": 15, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "SA": 24,
+	"SE": 24, "SI": 19, "SK": 24, "SM": 27, "TN": 24, "TR": 26, "UA": 29, "VG": 24, "XK": 20,
+}
+
+// validIBAN returns true if offender, with spaces left out, is an iban of the length of its country passing the
+// mod 97 checksum
+func validIBAN(offender string) bool {
+	iban := strings.ToUpper(strings.Replace(offender, " ", "", -1))
+	if len(iban) < 4 || ibanLengths[iban[:2]] != len(iban) {
+		return false
+	}
+	// the country and check digits move to the end and letters become 10 to 35
+	var number strings.Builder
+	for _, c := range iban[4:] + iban[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			number.WriteRune(c)
+		case c >= 'A' && c <= 'Z':
+			number.WriteString(big.NewInt(int64(c - 'A' + 10)).String())
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(number.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validSSN returns true if offender is a us social security number of the form 123-45-6789 that could be issued:
+// its area isn't 000, 666 or above 899, and neither its group nor its serial are zeros
+func validSSN(offender string) bool {
+	parts := strings.Split(offender, "-")
+	if len(parts) != 3 || len(parts[0]) != 3 || len(parts[1]) != 2 || len(parts[2]) != 4 {
+		return false
+	}
+	area := parts[0]
+	return area != "000" && area != "666" && area[0] != '9' && parts[1] != "00" && parts[2] != "0000"
+}
@@ -0,0 +1,235 @@
+package daemon
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+	"github.com/zricethezav/gitleaks/v6/manager"
+	"github.com/zricethezav/gitleaks/v6/options"
+	"github.com/zricethezav/gitleaks/v6/scan"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// stateFile is the file in the cache directory holding the branch heads of every repo scanned so far
+const stateFile = "state.json"
+
+// Daemon scans the repos of --repo-list on the schedule set by --schedule. Clones are kept in the cache
+// directory between runs and only fetched before a scan. Every run only scans the commits added since the
+// last successful run, so each leak is reported once, and reports the leaks found to the configured report
+// and sinks.
+type Daemon struct {
+	opts     options.Options
+	cfg      config.Config
+	cacheDir string
+
+	// heads holds the branch heads of each repo at its last successful scan, keyed by the url of the repo
+	heads map[string][]string
+}
+
+// Run runs the daemon until it's interrupted
+func Run(opts options.Options, cfg config.Config) error {
+	d, err := New(opts, cfg)
+	if err != nil {
+		return err
+	}
+	schedule, err := cron.ParseStandard(opts.Daemon.Schedule)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	for {
+		next := schedule.Next(time.Now())
+		log.Infof("next scan at %s", next.Format(time.RFC3339))
+		select {
+		case <-time.After(time.Until(next)):
+		case <-stop:
+			log.Info("gitleaks daemon received interrupt, stopping")
+			return nil
+		}
+		if err := d.RunOnce(); err != nil {
+			log.Errorf("scan failed: %v", err)
+		}
+	}
+}
+
+// New returns a daemon for the repos of --repo-list, loading the heads scanned by earlier runs from the cache directory
+func New(opts options.Options, cfg config.Config) (*Daemon, error) {
+	cacheDir := opts.Daemon.CacheDir
+	if cacheDir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the user cache directory, set --cache-dir: %v", err)
+		}
+		cacheDir = filepath.Join(userCache, "gitleaks", "daemon")
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return nil, err
+	}
+
+	d := &Daemon{
+		opts:     opts,
+		cfg:      cfg,
+		cacheDir: cacheDir,
+		heads:    make(map[string][]string),
+	}
+	b, err := ioutil.ReadFile(filepath.Join(cacheDir, stateFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &d.heads); err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", filepath.Join(cacheDir, stateFile), err)
+		}
+	}
+	return d, nil
+}
+
+// RunOnce fetches the repos of --repo-list, scans the commits added since the last run and reports the
+// leaks found. The heads scanned are only saved once the leaks are reported, a run that fails to report
+// is repeated in full by the next run.
+func (d *Daemon) RunOnce() error {
+	urls, err := readRepoList(d.opts.Daemon.RepoList)
+	if err != nil {
+		return err
+	}
+	m, err := manager.NewManager(d.opts, d.cfg)
+	if err != nil {
+		return err
+	}
+
+	heads := make(map[string][]string, len(d.heads))
+	for url, h := range d.heads {
+		heads[url] = h
+	}
+	for _, url := range urls {
+		repoHeads, err := d.scanRepo(m, url)
+		if err != nil {
+			log.Errorf("unable to scan %s: %v", url, err)
+			continue
+		}
+		heads[url] = repoHeads
+	}
+
+	if err := m.Report(); err != nil {
+		return err
+	}
+	if m.Stopped() {
+		// commits that weren't scanned are left for the next run
+		return fmt.Errorf("the scan was stopped early, the scanned commits aren't saved: %s", m.StopReason())
+	}
+	d.heads = heads
+	if err := d.saveHeads(); err != nil {
+		return err
+	}
+	log.Infof("%d leaks detected in %d new commits of %d repos", m.LeakCount(), m.GetMetadata().Commits, len(urls))
+	return nil
+}
+
+// scanRepo updates the clone of the repo at url and scans the commits it didn't scan before. It returns the
+// branch heads that were scanned.
+func (d *Daemon) scanRepo(m *manager.Manager, url string) ([]string, error) {
+	repoOpts := d.opts
+	repoOpts.Repo = url
+	cloneOpts, err := repoOpts.CloneOptions()
+	if err != nil {
+		return nil, err
+	}
+	repository, err := d.updateClone(url, cloneOpts)
+	if err != nil {
+		m.RecordCloneError(url, err)
+		return nil, err
+	}
+
+	r := scan.NewRepo(m)
+	r.Repository = repository
+	r.Name = strings.TrimSuffix(filepath.Base(url), ".git")
+	span := r.StartSpan(url)
+	defer span.End()
+
+	heads, err := r.Heads()
+	if err != nil {
+		return nil, err
+	}
+	if sameHeads(heads, d.heads[url]) {
+		log.Infof("no new commits in %s", url)
+		return heads, nil
+	}
+	if err := r.SkipReachable(d.heads[url]); err != nil {
+		return nil, err
+	}
+	if err := r.Scan(); err != nil {
+		return nil, err
+	}
+	return heads, nil
+}
+
+// updateClone fetches the cached clone of the repo at url, or clones it if it isn't cached yet
+func (d *Daemon) updateClone(url string, cloneOpts *git.CloneOptions) (*git.Repository, error) {
+	path := filepath.Join(d.cacheDir, "repos", fmt.Sprintf("%x", sha1.Sum([]byte(url))))
+	return scan.FetchClone(path, cloneOpts)
+}
+
+func (d *Daemon) saveHeads() error {
+	b, err := json.MarshalIndent(d.heads, "", " ")
+	if err != nil {
+		return err
+	}
+	// written to a temporary file first so an interrupted write can't lose the heads of every repo
+	path := filepath.Join(d.cacheDir, stateFile)
+	if err := ioutil.WriteFile(path+".tmp", b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readRepoList reads the repo urls of --repo-list, skipping blank lines and comments
+func readRepoList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// sameHeads returns true if a repo's branches point at the same commits as in the last scan
+func sameHeads(heads, last []string) bool {
+	if len(last) == 0 {
+		return false
+	}
+	scanned := make(map[string]bool, len(last))
+	for _, h := range last {
+		scanned[h] = true
+	}
+	for _, h := range heads {
+		if !scanned[h] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+	"github.com/zricethezav/gitleaks/v6/manager"
+	"github.com/zricethezav/gitleaks/v6/options"
+)
+
+func TestRunOnceIncremental(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitleaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	origin := filepath.Join(dir, "origin")
+	git := func(args ...string) {
+		args = append([]string{"-C", origin, "-c", "user.name=gitleaks", "-c", "user.email=gitleaks@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+	}
+	commit := func(file, content string) {
+		if err := ioutil.WriteFile(filepath.Join(origin, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", file)
+		git("commit", "--quiet", "-m", "add "+file)
+	}
+
+	if err := os.Mkdir(origin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "--quiet")
+	commit("config.py", "aws_access_key_id = \"AKIALALEMEL33243OLIAE\"\n")
+
+	repoList := filepath.Join(dir, "repos.txt")
+	if err := ioutil.WriteFile(repoList, []byte("# repos\n"+origin+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(dir, "report.json")
+	opts := options.Options{
+		Report:       report,
+		ReportFormat: "json",
+		Daemon: options.DaemonOptions{
+			Schedule: "@daily",
+			RepoList: repoList,
+			CacheDir: filepath.Join(dir, "cache"),
+			Active:   true,
+		},
+	}
+	cfg, err := config.NewConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func() []manager.Leak {
+		// every run starts from the heads saved by the last one
+		d, err := New(opts, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(report)
+		if err := d.RunOnce(); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(report)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		var leaks []manager.Leak
+		if err := json.Unmarshal(b, &leaks); err != nil {
+			t.Fatal(err)
+		}
+		return leaks
+	}
+
+	if leaks := run(); len(leaks) != 1 || leaks[0].File != "config.py" {
+		t.Fatalf("expected the leak of config.py, got %v", leaks)
+	}
+	commit("server.py", "AWS_KEY = \"AKIALALEMEL33243OLIBE\"\n")
+	if leaks := run(); len(leaks) != 1 || leaks[0].File != "server.py" {
+		t.Fatalf("expected only the leak of the new commit, got %v", leaks)
+	}
+	if leaks := run(); len(leaks) != 0 {
+		t.Fatalf("expected no leaks without new commits, got %v", leaks)
+	}
+
+	// a run stopped early leaves the commits it didn't get to for the next run
+	commit("client.py", "AWS_KEY = \"AKIALALEMEL33243OLICE\"\n")
+	commit("worker.py", "AWS_KEY = \"AKIALALEMEL33243OLIDE\"\n")
+	stoppedOpts := opts
+	stoppedOpts.MaxFindings = 1
+	d, err := New(stoppedOpts, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RunOnce(); err == nil {
+		t.Fatal("expected the run stopped at --max-findings to fail")
+	}
+	if leaks := run(); len(leaks) != 2 {
+		t.Fatalf("expected the leaks of the commits of the stopped run, got %v", leaks)
+	}
+}
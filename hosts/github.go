@@ -2,9 +2,11 @@ package hosts
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/zricethezav/gitleaks/v6/manager"
 	"github.com/zricethezav/gitleaks/v6/options"
@@ -14,6 +16,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/google/go-github/v31/github"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
@@ -24,6 +27,13 @@ type Github struct {
 	client  *github.Client
 	manager *manager.Manager
 	wg      sync.WaitGroup
+
+	// appTokens creates the installation tokens used for api calls and clones when
+	// authenticating as a github app
+	appTokens oauth2.TokenSource
+
+	// state is the --scan-state of the scan, nil without it
+	state *scanState
 }
 
 // NewGithubClient accepts a manager struct and returns a Github host pointer which will be used to
@@ -34,8 +44,17 @@ func NewGithubClient(m *manager.Manager) (*Github, error) {
 	token := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: options.GetAccessToken(m.Opts)},
 	)
+	var appTokens oauth2.TokenSource
+	if m.Opts.GithubAppID != 0 {
+		if appTokens, err = newAppTokenSource(m); err != nil {
+			return nil, err
+		}
+		token = appTokens
+	}
 
 	var githubClient *github.Client
+	// oauth2 wraps the transport of the client set in the context
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, hostHTTPClient(m))
 	httpClient := oauth2.NewClient(ctx, token)
 
 	if m.Opts.BaseURL == "" {
@@ -43,25 +62,40 @@ func NewGithubClient(m *manager.Manager) (*Github, error) {
 	} else {
 		githubClient, err = github.NewEnterpriseClient(m.Opts.BaseURL, m.Opts.BaseURL, httpClient)
 	}
+	if err != nil {
+		return nil, err
+	}
+	state, err := hostScanState(m)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Github{
-		manager: m,
-		client:  githubClient,
-	}, err
+		manager:   m,
+		client:    githubClient,
+		appTokens: appTokens,
+		state:     state,
+	}, nil
 }
 
 // Scan will scan a github user or organization's repos.
 func (g *Github) Scan() {
+	if g.manager.Opts.GithubGists != "" {
+		g.scanGists()
+		return
+	}
+
 	ctx := context.Background()
 	listOptions := github.ListOptions{
 		PerPage: 100,
 		Page:    1,
 	}
 
-	var (
-		githubRepos []*github.Repository
-		auth        transport.AuthMethod
-	)
+	var githubRepos []*github.Repository
+
+	// the repositories of the authenticated user can only be listed with the user left empty,
+	// in which case private repos are listed as well.
+	ownRepos := g.manager.Opts.GithubUser != "" && g.isAuthenticatedUser(ctx, g.manager.Opts.GithubUser)
 
 	for {
 		var (
@@ -69,12 +103,21 @@ func (g *Github) Scan() {
 			resp         *github.Response
 			err          error
 		)
-		if g.manager.Opts.User != "" {
+		if ownRepos {
+			_githubRepos, resp, err = g.client.Repositories.List(ctx, "",
+				&github.RepositoryListOptions{Affiliation: "owner", ListOptions: listOptions})
+		} else if g.manager.Opts.GithubUser != "" {
+			_githubRepos, resp, err = g.client.Repositories.List(ctx, g.manager.Opts.GithubUser,
+				&github.RepositoryListOptions{ListOptions: listOptions})
+		} else if g.manager.Opts.User != "" {
 			_githubRepos, resp, err = g.client.Repositories.List(ctx, g.manager.Opts.User,
 				&github.RepositoryListOptions{ListOptions: listOptions})
 		} else if g.manager.Opts.Organization != "" {
 			_githubRepos, resp, err = g.client.Repositories.ListByOrg(ctx, g.manager.Opts.Organization,
 				&github.RepositoryListByOrgOptions{ListOptions: listOptions})
+		} else if g.appTokens != nil {
+			// an app has no repos of its own, scan every repo the installation has access to
+			_githubRepos, resp, err = g.client.Apps.ListRepos(ctx, &listOptions)
 		} else {
 			_githubRepos, resp, err = g.client.Repositories.List(ctx, "",
 				&github.RepositoryListOptions{ListOptions: listOptions})
@@ -85,6 +128,10 @@ func (g *Github) Scan() {
 				log.Debugf("excluding forked repo: %s", *r.Name)
 				continue
 			}
+			if g.manager.Opts.ExcludeArchived && r.GetArchived() {
+				log.Debugf("excluding archived repo: %s", *r.Name)
+				continue
+			}
 			githubRepos = append(githubRepos, r)
 		}
 
@@ -105,36 +152,133 @@ func (g *Github) Scan() {
 	}
 
 	for _, repo := range githubRepos {
-		r := scan.NewRepo(g.manager)
+		// wikis have no push date, they are scanned even if their repo is skipped
+		if !g.state.skip(*repo.CloneURL, repo.GetPushedAt().Time) {
+			if err := g.cloneAndScan(*repo.Name, *repo.CloneURL, *repo.SSHURL); err != nil {
+				log.Warnf("%+v, skipping clone and scan", err)
+				g.manager.RecordCloneError(*repo.Name, err)
+			}
+		}
+
+		if g.manager.Opts.IncludeWikis && repo.GetHasWiki() {
+			name := *repo.Name + ".wiki"
+			if err := g.cloneAndScan(name, scan.WikiURL(*repo.CloneURL), scan.WikiURL(*repo.SSHURL)); err != nil {
+				// wikis that have never been edited do not have a git repo to clone
+				log.Debugf("unable to clone wiki %s: %v", name, err)
+			}
+		}
+	}
+	g.state.saveAfterReport(g.manager)
+}
+
+// scanGists scans the gists of the user set by --github-gists. Secret gists are included
+// if the access token belongs to that user.
+func (g *Github) scanGists() {
+	ctx := context.Background()
+	user := g.manager.Opts.GithubGists
+	if g.isAuthenticatedUser(ctx, user) {
+		user = ""
+	}
 
-		if g.manager.CloneOptions != nil {
-			auth = g.manager.CloneOptions.Auth
+	listOptions := &github.GistListOptions{
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+			Page:    1,
+		},
+	}
+	var gists []*github.Gist
+	for {
+		_gists, resp, err := g.client.Gists.List(ctx, user, listOptions)
+		if err != nil {
+			log.Error(err)
+			break
+		}
+		gists = append(gists, _gists...)
+		log.Infof("gathering github gists... progress: page %d", listOptions.Page)
+		if resp == nil || resp.NextPage == 0 {
+			break
 		}
-		err := r.Clone(&git.CloneOptions{
-			URL:  *repo.CloneURL,
+		listOptions.Page = resp.NextPage
+	}
+
+	for _, gist := range gists {
+		name := "gist-" + gist.GetID()
+		sshURL := fmt.Sprintf("git@gist.github.com:%s.git", gist.GetID())
+		if err := g.cloneAndScan(name, gist.GetGitPullURL(), sshURL); err != nil {
+			log.Warnf("%+v, skipping clone and scan", err)
+			g.manager.RecordCloneError(name, err)
+		}
+	}
+}
+
+// isAuthenticatedUser returns true if the access token belongs to user. Github only lists
+// private repos and secret gists for the authenticated user.
+func (g *Github) isAuthenticatedUser(ctx context.Context, user string) bool {
+	if options.GetAccessToken(g.manager.Opts) == "" {
+		return false
+	}
+	authUser, _, err := g.client.Users.Get(ctx, "")
+	if err != nil {
+		log.Warnf("unable to get authenticated github user, only public content will be scanned: %v", err)
+		return false
+	}
+	return strings.EqualFold(authUser.GetLogin(), user)
+}
+
+// cloneAndScan clones a github repo via https and the access token, falling back to ssh if that fails,
+// and then scans the repo.
+func (g *Github) cloneAndScan(name, cloneURL, sshURL string) error {
+	if g.manager.Stopped() {
+		return nil
+	}
+	var auth transport.AuthMethod
+	if g.manager.CloneOptions != nil {
+		auth = g.manager.CloneOptions.Auth
+	}
+	if g.appTokens != nil {
+		token, err := g.appTokens.Token()
+		if err != nil {
+			return err
+		}
+		auth = &http.BasicAuth{Username: "x-access-token", Password: token.AccessToken}
+	}
+	if auth == nil && g.manager.Opts.CredHelper {
+		if helperAuth, err := options.CredentialHelperAuth(cloneURL); err != nil {
+			log.Debug(err)
+		} else {
+			auth = helperAuth
+		}
+	}
+
+	start := time.Now()
+	r := scan.NewRepo(g.manager)
+	span := r.StartSpan(name)
+	defer span.End()
+	err := r.Clone(&git.CloneOptions{
+		URL:  cloneURL,
+		Auth: auth,
+	})
+	r.Name = name
+	if err != nil {
+		log.Debugf("unable to clone %s via https and access token, attempting with ssh now", cloneURL)
+		auth, err := options.SSHAuth(g.manager.Opts)
+		if err != nil {
+			return fmt.Errorf("unable to get ssh auth for repo %s: %v", cloneURL, err)
+		}
+		err = r.Clone(&git.CloneOptions{
+			URL:  sshURL,
 			Auth: auth,
 		})
-		r.Name = *repo.Name
 		if err != nil {
-			log.Warn("unable to clone via https and access token, attempting with ssh now")
-			auth, err := options.SSHAuth(g.manager.Opts)
-			if err != nil {
-				log.Warnf("unable to get ssh auth, skipping clone and scan for repo %s: %+v\n", *repo.CloneURL, err)
-				continue
-			}
-			err = r.Clone(&git.CloneOptions{
-				URL:  *repo.SSHURL,
-				Auth: auth,
-			})
-			if err != nil {
-				log.Warnf("err cloning %s, skipping clone and scan: %+v\n", *repo.SSHURL, err)
-				continue
-			}
-		}
-		if err = r.Scan(); err != nil {
-			log.Warn(err)
+			return fmt.Errorf("err cloning %s: %v", sshURL, err)
 		}
 	}
+	if err = r.Scan(); err != nil {
+		log.Warn(err)
+	} else if !r.TimedOut() && !g.manager.Stopped() {
+		g.state.scanned(cloneURL, start)
+	}
+	return nil
 }
 
 // ScanPR scan a single github PR
@@ -146,6 +290,8 @@ func (g *Github) ScanPR() {
 	prNum, err := strconv.Atoi(splits[len(splits)-1])
 	repo := scan.NewRepo(g.manager)
 	repo.Name = repoName
+	span := repo.StartSpan(g.manager.Opts.PullRequest)
+	defer span.End()
 	log.Infof("scanning pr %s\n", g.manager.Opts.PullRequest)
 
 	if err != nil {
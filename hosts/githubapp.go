@@ -0,0 +1,139 @@
+package hosts
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	"github.com/google/go-github/v31/github"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+// appTokenSource creates installation access tokens of a github app. Installation tokens expire after an
+// hour, wrapped in oauth2.ReuseTokenSource a new token is created whenever the current one expires so org
+// scans running for longer keep working. The tokens are only as privileged as the app's installation,
+// unlike a personal access token.
+type appTokenSource struct {
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+
+	// client authenticates as the app itself, which is only allowed to create installation tokens
+	client *github.Client
+}
+
+// newAppTokenSource returns a token source for the app installation set by --github-app-id,
+// --github-app-installation-id and --github-app-key
+func newAppTokenSource(m *manager.Manager) (oauth2.TokenSource, error) {
+	pemBytes, err := ioutil.ReadFile(m.Opts.GithubAppKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseAppKey(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &appTokenSource{
+		appID:          m.Opts.GithubAppID,
+		installationID: m.Opts.GithubAppInstID,
+		key:            key,
+	}
+	appClient := &http.Client{Transport: &appTransport{source: ts, base: hostHTTPClient(m).Transport}}
+	if m.Opts.BaseURL == "" {
+		ts.client = github.NewClient(appClient)
+	} else if ts.client, err = github.NewEnterpriseClient(m.Opts.BaseURL, m.Opts.BaseURL, appClient); err != nil {
+		return nil, err
+	}
+	return oauth2.ReuseTokenSource(nil, ts), nil
+}
+
+// Token creates a new installation access token
+func (ts *appTokenSource) Token() (*oauth2.Token, error) {
+	token, _, err := ts.client.Apps.CreateInstallationToken(context.Background(), ts.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create github app installation token: %v", err)
+	}
+	log.Debugf("created github app installation token expiring at %s", token.GetExpiresAt())
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "token",
+		Expiry:      token.GetExpiresAt(),
+	}, nil
+}
+
+// jwt returns a json web token authenticating as the app. Github rejects tokens valid for more than
+// 10 minutes, the issue time is backdated a minute to allow for clock drift.
+func (ts *appTokenSource) jwt() (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": ts.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, ts.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// appTransport authenticates requests as the github app
+type appTransport struct {
+	source *appTokenSource
+	base   http.RoundTripper
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	jwt, err := t.source.jwt()
+	if err != nil {
+		return nil, err
+	}
+	// requests must not be modified by a RoundTripper
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	return t.base.RoundTrip(req)
+}
+
+// parseAppKey parses the PEM encoded private key of a github app. Github generates PKCS#1 keys,
+// PKCS#8 is accepted as well.
+func parseAppKey(pemBytes []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("github app key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse github app key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("github app key is not an RSA key")
+	}
+	return rsaKey, nil
+}
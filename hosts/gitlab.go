@@ -3,6 +3,7 @@ package hosts
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/zricethezav/gitleaks/v6/manager"
 	"github.com/zricethezav/gitleaks/v6/options"
@@ -18,6 +19,9 @@ type Gitlab struct {
 	manager *manager.Manager
 	ctx     context.Context
 	wg      sync.WaitGroup
+
+	// state is the --scan-state of the scan, nil without it
+	state *scanState
 }
 
 // NewGitlabClient accepts a manager struct and returns a Gitlab host pointer which will be used to
@@ -28,12 +32,15 @@ func NewGitlabClient(m *manager.Manager) (*Gitlab, error) {
 	gitlabClient := &Gitlab{
 		manager: m,
 		ctx:     context.Background(),
-		client:  gitlab.NewClient(nil, options.GetAccessToken(m.Opts)),
+		client:  gitlab.NewClient(hostHTTPClient(m), options.GetAccessToken(m.Opts)),
 	}
 
 	if m.Opts.BaseURL != "" {
 		err = gitlabClient.client.SetBaseURL(m.Opts.BaseURL)
 	}
+	if err == nil {
+		gitlabClient.state, err = hostScanState(m)
+	}
 
 	return gitlabClient, err
 }
@@ -74,6 +81,10 @@ func (g *Gitlab) Scan() {
 				log.Debugf("excluding forked repo: %s", p.Name)
 				continue
 			}
+			if g.manager.Opts.ExcludeArchived && p.Archived {
+				log.Debugf("excluding archived repo: %s", p.Name)
+				continue
+			}
 			projects = append(projects, p)
 		}
 
@@ -89,12 +100,34 @@ func (g *Gitlab) Scan() {
 
 	// iterate of gitlab projects
 	for _, p := range projects {
+		if g.manager.Stopped() {
+			break
+		}
+		// gitlab has no push date, the last activity of a project includes its pushes
+		var pushedAt time.Time
+		if p.LastActivityAt != nil {
+			pushedAt = *p.LastActivityAt
+		}
+		if g.state.skip(p.HTTPURLToRepo, pushedAt) {
+			continue
+		}
+		start := time.Now()
 		r := scan.NewRepo(g.manager)
-		cloneOpts := g.manager.CloneOptions
+		span := r.StartSpan(p.Name)
+		cloneOpts := *g.manager.CloneOptions
 		cloneOpts.URL = p.HTTPURLToRepo
-		err := r.Clone(cloneOpts)
+		if cloneOpts.Auth == nil && g.manager.Opts.CredHelper {
+			if auth, err := options.CredentialHelperAuth(cloneOpts.URL); err != nil {
+				log.Debug(err)
+			} else {
+				cloneOpts.Auth = auth
+			}
+		}
+		err := r.Clone(&cloneOpts)
 		if err != nil {
 			log.Error(err)
+			g.manager.RecordCloneError(p.Name, err)
+			span.End()
 			continue
 		}
 		// TODO handle clone retry with ssh like github host
@@ -102,8 +135,12 @@ func (g *Gitlab) Scan() {
 
 		if err = r.Scan(); err != nil {
 			log.Error(err)
+		} else if !r.TimedOut() && !g.manager.Stopped() {
+			g.state.scanned(p.HTTPURLToRepo, start)
 		}
+		span.End()
 	}
+	g.state.saveAfterReport(g.manager)
 }
 
 // ScanPR TODO not implemented
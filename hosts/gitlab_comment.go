@@ -0,0 +1,156 @@
+package hosts
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+	"github.com/zricethezav/gitleaks/v6/options"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xanzy/go-gitlab"
+)
+
+// mrCommentMarker is a hidden marker embedded in the merge request comment so that
+// subsequent runs can find and update the comment instead of posting a new one.
+const mrCommentMarker = "<!-- gitleaks-mr-comment -->"
+
+// PostMRComment posts a summary of the manager's leaks to the gitlab merge request set by --mr-comment.
+// If a gitleaks comment already exists on the merge request, it is updated in place so re-runs
+// of a pipeline don't flood the merge request with comments.
+func PostMRComment(m *manager.Manager) error {
+	baseURL, projectPath, iid, err := parseMergeRequestURL(m.Opts.MRComment)
+	if err != nil {
+		return err
+	}
+	if m.Opts.BaseURL != "" {
+		baseURL = m.Opts.BaseURL
+	}
+
+	client := gitlab.NewClient(hostHTTPClient(m), options.GetAccessToken(m.Opts))
+	if err := client.SetBaseURL(baseURL); err != nil {
+		return err
+	}
+
+	project, _, err := client.Projects.GetProject(projectPath, nil)
+	if err != nil {
+		return err
+	}
+	mr, _, err := client.MergeRequests.GetMergeRequest(projectPath, iid, nil)
+	if err != nil {
+		return err
+	}
+
+	body := mrCommentBody(m.GetLeaks(), project.WebURL, mr.SHA)
+
+	noteID, err := findMRComment(client, projectPath, iid)
+	if err != nil {
+		return err
+	}
+	if noteID != 0 {
+		_, _, err = client.Notes.UpdateMergeRequestNote(projectPath, iid, noteID,
+			&gitlab.UpdateMergeRequestNoteOptions{Body: &body})
+		if err == nil {
+			log.Infof("updated gitleaks comment on %s", m.Opts.MRComment)
+		}
+		return err
+	}
+	_, _, err = client.Notes.CreateMergeRequestNote(projectPath, iid,
+		&gitlab.CreateMergeRequestNoteOptions{Body: &body})
+	if err == nil {
+		log.Infof("posted gitleaks comment on %s", m.Opts.MRComment)
+	}
+	return err
+}
+
+// findMRComment returns the id of a previous gitleaks comment on the merge request or 0 if there is none.
+func findMRComment(client *gitlab.Client, projectPath string, iid int) (int, error) {
+	listOpts := &gitlab.ListMergeRequestNotesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100, Page: 1},
+	}
+	for {
+		notes, resp, err := client.Notes.ListMergeRequestNotes(projectPath, iid, listOpts)
+		if err != nil {
+			return 0, err
+		}
+		for _, n := range notes {
+			if strings.Contains(n.Body, mrCommentMarker) {
+				return n.ID, nil
+			}
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return 0, nil
+		}
+		listOpts.Page = resp.NextPage
+	}
+}
+
+// mrCommentBody renders the markdown summary of leaks. Secrets are always redacted since
+// merge request comments are visible to anyone with access to the project.
+func mrCommentBody(leaks []manager.Leak, webURL, headSha string) string {
+	var b strings.Builder
+	b.WriteString(mrCommentMarker + "\n")
+	if len(leaks) == 0 {
+		b.WriteString("### Gitleaks found no leaks\n")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "### Gitleaks found %d leak(s)\n\n", len(leaks))
+	b.WriteString("| Rule | Location | Commit | Secret |\n")
+	b.WriteString("|------|----------|--------|--------|\n")
+	for _, leak := range leaks {
+		ref := leak.Commit
+		if strings.Trim(ref, "0") == "" {
+			// uncommitted changes have no commit so link to the merge request head instead
+			ref = headSha
+		}
+		location := leak.File
+		link := fmt.Sprintf("%s/-/blob/%s/%s", webURL, ref, leak.File)
+		if leak.LineNumber > 0 {
+			location = fmt.Sprintf("%s:%d", leak.File, leak.LineNumber)
+			link = fmt.Sprintf("%s#L%d", link, leak.LineNumber)
+		}
+		fmt.Fprintf(&b, "| %s | [%s](%s) | %s | `%s` |\n",
+			escapeMarkdownCell(leak.Rule),
+			escapeMarkdownCell(location),
+			link,
+			manager.ShortSha(leak.Commit),
+			escapeMarkdownCell(manager.MaskSecret(leak.Offender)))
+	}
+	return b.String()
+}
+
+// parseMergeRequestURL splits a merge request url like https://gitlab.com/group/project/-/merge_requests/1
+// into the api base url, project path, and merge request iid.
+func parseMergeRequestURL(mrURL string) (string, string, int, error) {
+	u, err := url.Parse(mrURL)
+	if err != nil {
+		return "", "", 0, err
+	}
+	splits := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, s := range splits {
+		if s != "merge_requests" || i+1 >= len(splits) {
+			continue
+		}
+		iid, err := strconv.Atoi(splits[i+1])
+		if err != nil {
+			return "", "", 0, fmt.Errorf("invalid merge request url %s: %v", mrURL, err)
+		}
+		project := splits[:i]
+		if len(project) != 0 && project[len(project)-1] == "-" {
+			project = project[:len(project)-1]
+		}
+		if len(project) == 0 {
+			break
+		}
+		return fmt.Sprintf("%s://%s/api/v4", u.Scheme, u.Host), strings.Join(project, "/"), iid, nil
+	}
+	return "", "", 0, fmt.Errorf("invalid merge request url %s", mrURL)
+}
+
+func escapeMarkdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
@@ -22,7 +22,11 @@ type Host interface {
 func Run(m *manager.Manager) error {
 	var host Host
 	var err error
-	switch getHost(m.Opts.Host) {
+	hostName := m.Opts.Host
+	if m.Opts.GithubUser != "" || m.Opts.GithubGists != "" {
+		hostName = "github"
+	}
+	switch getHost(hostName) {
 	case _github:
 		host, err = NewGithubClient(m)
 	case _gitlab:
@@ -1,10 +1,25 @@
 package hosts
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/zricethezav/gitleaks/v6/config"
 	"github.com/zricethezav/gitleaks/v6/manager"
@@ -114,3 +129,562 @@ func TestGitlab(t *testing.T) {
 		}
 	}
 }
+
+func TestParseMergeRequestURL(t *testing.T) {
+	tests := []struct {
+		url         string
+		wantBaseURL string
+		wantProject string
+		wantIID     int
+		wantErr     bool
+	}{
+		{
+			url:         "https://gitlab.com/gitleakstest/gronit/-/merge_requests/1",
+			wantBaseURL: "https://gitlab.com/api/v4",
+			wantProject: "gitleakstest/gronit",
+			wantIID:     1,
+		},
+		{
+			url:         "https://git.example.com/group/subgroup/project/merge_requests/42",
+			wantBaseURL: "https://git.example.com/api/v4",
+			wantProject: "group/subgroup/project",
+			wantIID:     42,
+		},
+		{
+			url:     "https://gitlab.com/gitleakstest/gronit/-/issues/1",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		baseURL, project, iid, err := parseMergeRequestURL(test.url)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("expected error parsing %s", test.url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		if baseURL != test.wantBaseURL || project != test.wantProject || iid != test.wantIID {
+			t.Errorf("got %s %s %d, wanted %s %s %d", baseURL, project, iid, test.wantBaseURL, test.wantProject, test.wantIID)
+		}
+	}
+}
+
+func TestGithubAppTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, err := ioutil.TempFile("", "gitleaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keyFile.Name())
+	pemBlock := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if err := pem.Encode(keyFile, pemBlock); err != nil {
+		t.Fatal(err)
+	}
+	keyFile.Close()
+
+	var created int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v3/app/installations/42/access_tokens" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		if len(parts) != 3 {
+			t.Errorf("expected a jwt, got %q", r.Header.Get("Authorization"))
+		}
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if !strings.Contains(string(claims), `"iss":7`) {
+			t.Errorf("expected the jwt to be issued by app 7, got %s", claims)
+		}
+		created++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "installation-token-%d", "expires_at": %q}`, created, time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	opts := options.Options{
+		BaseURL:         server.URL,
+		GithubAppID:     7,
+		GithubAppInstID: 42,
+		GithubAppKey:    keyFile.Name(),
+	}
+	cfg, err := config.NewConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := manager.NewManager(opts, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := newAppTokenSource(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		token, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "installation-token-1" {
+			t.Errorf("expected the first installation token to be reused, got %s", token.AccessToken)
+		}
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	reset := time.Now().Add(time.Minute).Unix()
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			// secondary rate limit
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusForbidden)
+		case 2:
+			// the last request before the limit resets
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		default:
+			w.Header().Set("RateLimit-Limit", "100")
+			w.Header().Set("RateLimit-Remaining", "99")
+			w.Header().Set("RateLimit-Reset", strconv.FormatInt(reset, 10))
+		}
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	transport := newRateLimitTransport(http.DefaultTransport)
+	transport.sleep = func(d time.Duration) { waits = append(waits, d) }
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected request %d to succeed, got %d", i, resp.StatusCode)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+	if len(waits) != 2 || waits[0] != 30*time.Second || waits[1] < 50*time.Second || waits[1] > 62*time.Second {
+		t.Errorf("expected to wait 30s for the retry and about a minute for the reset, got %v", waits)
+	}
+}
+
+// initLeakyRepos creates a repo in dir for each name with a commit that leaks an aws key
+func initLeakyRepos(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.Mkdir(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, "deploy.sh"), []byte("# "+name+"\nexport AWS_KEY=AKIALALEMEL33243OLIAE\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, args := range [][]string{{"init", "--quiet"}, {"add", "."}, {"commit", "--quiet", "-m", "add key"}} {
+			args = append([]string{"-C", path, "-c", "user.name=gitleaks", "-c", "user.email=gitleaks@example.com"}, args...)
+			if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+		}
+	}
+}
+
+// leakRepos returns the sorted names of the repos the leaks of m were found in
+func leakRepos(m *manager.Manager) []string {
+	var repos []string
+	for _, leak := range m.GetLeaks() {
+		repos = append(repos, leak.Repo)
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+func TestGithubListRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitleaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	initLeakyRepos(t, dir, "dotfiles", "secret-plans", "hubot-scripts", "api", "legacy-api")
+
+	repo := func(name string, archived bool) string {
+		path := filepath.Join(dir, name)
+		return fmt.Sprintf(`{"name": %q, "clone_url": %q, "ssh_url": %q, "archived": %v}`, name, path, path, archived)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/user":
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"login": "Octocat"}`)
+		case "/api/v3/user/repos":
+			// private repos are only listed for the owner of the token
+			if r.URL.Query().Get("affiliation") != "owner" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, "[%s, %s]", repo("dotfiles", false), repo("secret-plans", false))
+		case "/api/v3/users/octocat/repos":
+			fmt.Fprintf(w, "[%s]", repo("dotfiles", false))
+		case "/api/v3/users/hubot/repos":
+			fmt.Fprintf(w, "[%s]", repo("hubot-scripts", false))
+		case "/api/v3/orgs/acme/repos":
+			fmt.Fprintf(w, "[%s, %s]", repo("api", false), repo("legacy-api", true))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		description string
+		opts        options.Options
+		repos       []string
+	}{
+		{
+			description: "the token owner's repos, including private ones",
+			opts:        options.Options{GithubUser: "octocat", AccessToken: "token"},
+			repos:       []string{"dotfiles", "secret-plans"},
+		},
+		{
+			description: "the public repos of the user without a token",
+			opts:        options.Options{GithubUser: "octocat"},
+			repos:       []string{"dotfiles"},
+		},
+		{
+			description: "the public repos of another user",
+			opts:        options.Options{GithubUser: "hubot", AccessToken: "token"},
+			repos:       []string{"hubot-scripts"},
+		},
+		{
+			description: "archived repos are scanned by default",
+			opts:        options.Options{Host: "github", Organization: "acme"},
+			repos:       []string{"api", "legacy-api"},
+		},
+		{
+			description: "archived repos are excluded",
+			opts:        options.Options{Host: "github", Organization: "acme", ExcludeArchived: true},
+			repos:       []string{"api"},
+		},
+	}
+	for _, test := range tests {
+		test.opts.BaseURL = server.URL
+		cfg, err := config.NewConfig(test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := manager.NewManager(test.opts, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Run(m); err != nil {
+			t.Fatal(err)
+		}
+		if repos := leakRepos(m); !reflect.DeepEqual(repos, test.repos) {
+			t.Errorf("%s: expected the leaks of %v, got %v", test.description, test.repos, repos)
+		}
+	}
+}
+
+func TestGithubWikis(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitleaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// docs has a wiki, handbook has a wiki that was never edited and so has no git repo,
+	// the wiki of tools is disabled even though a repo exists at its wiki url
+	initLeakyRepos(t, dir, "docs", "docs.wiki", "handbook", "tools", "tools.wiki")
+
+	repo := func(name string, hasWiki bool) string {
+		path := filepath.Join(dir, name+".git")
+		return fmt.Sprintf(`{"name": %q, "clone_url": %q, "ssh_url": %q, "has_wiki": %v}`, name, path, path, hasWiki)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/orgs/acme/repos" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, "[%s, %s, %s]", repo("docs", true), repo("handbook", true), repo("tools", false))
+	}))
+	defer server.Close()
+
+	// the repos are cloned from their .git urls like they are on github
+	for _, name := range []string{"docs", "docs.wiki", "handbook", "tools", "tools.wiki"} {
+		if err := os.Rename(filepath.Join(dir, name), filepath.Join(dir, name+".git")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		includeWikis bool
+		repos        []string
+	}{
+		{includeWikis: false, repos: []string{"docs", "handbook", "tools"}},
+		{includeWikis: true, repos: []string{"docs", "docs.wiki", "handbook", "tools"}},
+	}
+	for _, test := range tests {
+		opts := options.Options{Host: "github", Organization: "acme", BaseURL: server.URL, IncludeWikis: test.includeWikis}
+		cfg, err := config.NewConfig(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := manager.NewManager(opts, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Run(m); err != nil {
+			t.Fatal(err)
+		}
+		if repos := leakRepos(m); !reflect.DeepEqual(repos, test.repos) {
+			t.Errorf("include wikis %v: expected the leaks of %v, got %v", test.includeWikis, test.repos, repos)
+		}
+		if errs := m.GetCloneErrors(); len(errs) != 0 {
+			t.Errorf("include wikis %v: expected a missing wiki not to be a clone error, got %v", test.includeWikis, errs)
+		}
+	}
+}
+
+func TestGithubGists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitleaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	initLeakyRepos(t, dir, "aa11", "bb22", "cc33")
+
+	gist := func(id string) string {
+		return fmt.Sprintf(`{"id": %q, "git_pull_url": %q}`, id, filepath.Join(dir, id))
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/user":
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"login": "octocat"}`)
+		case "/api/v3/gists":
+			// the gists of the authenticated user, secret ones included
+			fmt.Fprintf(w, "[%s, %s]", gist("aa11"), gist("bb22"))
+		case "/api/v3/users/octocat/gists":
+			fmt.Fprintf(w, "[%s]", gist("aa11"))
+		case "/api/v3/users/hubot/gists":
+			fmt.Fprintf(w, "[%s]", gist("cc33"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		opts  options.Options
+		repos []string
+	}{
+		{opts: options.Options{GithubGists: "octocat", AccessToken: "token"}, repos: []string{"gist-aa11", "gist-bb22"}},
+		{opts: options.Options{GithubGists: "octocat"}, repos: []string{"gist-aa11"}},
+		{opts: options.Options{GithubGists: "hubot", AccessToken: "token"}, repos: []string{"gist-cc33"}},
+	}
+	for _, test := range tests {
+		test.opts.BaseURL = server.URL
+		cfg, err := config.NewConfig(test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := manager.NewManager(test.opts, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Run(m); err != nil {
+			t.Fatal(err)
+		}
+		if repos := leakRepos(m); !reflect.DeepEqual(repos, test.repos) {
+			t.Errorf("%s with token %v: expected the leaks of %v, got %v",
+				test.opts.GithubGists, test.opts.AccessToken != "", test.repos, repos)
+		}
+	}
+}
+
+func TestGitlabListProjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitleaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	initLeakyRepos(t, dir, "runner", "old-runner", "charts")
+
+	project := func(name string, archived bool) string {
+		return fmt.Sprintf(`{"name": %q, "http_url_to_repo": %q, "archived": %v}`, name, filepath.Join(dir, name), archived)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/users/gitleakstest/projects":
+			fmt.Fprintf(w, "[%s, %s]", project("runner", false), project("old-runner", true))
+		case "/api/v4/groups/acme/projects":
+			fmt.Fprintf(w, "[%s]", project("charts", false))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		opts  options.Options
+		repos []string
+	}{
+		{opts: options.Options{User: "gitleakstest"}, repos: []string{"old-runner", "runner"}},
+		{opts: options.Options{User: "gitleakstest", ExcludeArchived: true}, repos: []string{"runner"}},
+		{opts: options.Options{Organization: "acme", ExcludeArchived: true}, repos: []string{"charts"}},
+	}
+	for _, test := range tests {
+		test.opts.Host = "gitlab"
+		test.opts.BaseURL = server.URL
+		cfg, err := config.NewConfig(test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := manager.NewManager(test.opts, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Run(m); err != nil {
+			t.Fatal(err)
+		}
+		if repos := leakRepos(m); !reflect.DeepEqual(repos, test.repos) {
+			t.Errorf("%+v: expected the leaks of %v, got %v", test.opts, test.repos, repos)
+		}
+	}
+}
+
+func TestGithubScanState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitleaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	initLeakyRepos(t, dir, "active", "dormant")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/orgs/acme/repos" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `[{"name": "active", "clone_url": %q, "ssh_url": %q, "pushed_at": %q},
+			{"name": "dormant", "clone_url": %q, "ssh_url": %q, "pushed_at": "2020-06-01T00:00:00Z"}]`,
+			filepath.Join(dir, "active"), filepath.Join(dir, "active"), time.Now().UTC().Format(time.RFC3339),
+			filepath.Join(dir, "dormant"), filepath.Join(dir, "dormant"))
+	}))
+	defer server.Close()
+
+	lastScan := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	statePath := filepath.Join(dir, "state.json")
+	opts := options.Options{Host: "github", Organization: "acme", BaseURL: server.URL, ScanState: statePath}
+	cfg, err := config.NewConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dormantConfig string
+		repos         []string
+	}{
+		{dormantConfig: "", repos: []string{"active"}},
+		// the dormant repo was scanned with another config
+		{dormantConfig: "sha256:0000", repos: []string{"active", "dormant"}},
+	}
+	for _, test := range tests {
+		m, err := manager.NewManager(opts, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		configHash, err := m.ConfigHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dormantConfig := configHash
+		if test.dormantConfig != "" {
+			dormantConfig = test.dormantConfig
+		}
+		state := fmt.Sprintf(`{"repos": {%q: {"scanned": %q, "config": %q}, %q: {"scanned": %q, "config": %q}}}`,
+			filepath.Join(dir, "active"), lastScan.Format(time.RFC3339), configHash,
+			filepath.Join(dir, "dormant"), lastScan.Format(time.RFC3339), dormantConfig)
+		if err := ioutil.WriteFile(statePath, []byte(state), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now().Add(-time.Second)
+		if err := Run(m); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Report(); err != nil {
+			t.Fatal(err)
+		}
+		if repos := leakRepos(m); !reflect.DeepEqual(repos, test.repos) {
+			t.Errorf("expected the leaks of %v, got %+v", test.repos, repos)
+		}
+
+		saved, err := loadScanState(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scan := saved.Repos[filepath.Join(dir, "active")]; scan.Scanned.Before(start) || scan.Config != configHash {
+			t.Errorf("expected the scan of the active repo to be recorded, got %+v", scan)
+		}
+		if scan := saved.Repos[filepath.Join(dir, "dormant")]; test.dormantConfig == "" && !scan.Scanned.Equal(lastScan) {
+			t.Errorf("expected the last scan of the dormant repo to be kept, got %+v", scan)
+		}
+	}
+
+	// the state isn't saved if the leaks of the scan can't be reported, the next scan scans the repos again
+	state := fmt.Sprintf(`{"repos": {%q: {"scanned": %q}}}`, filepath.Join(dir, "dormant"), lastScan.Format(time.RFC3339))
+	if err := ioutil.WriteFile(statePath, []byte(state), 0600); err != nil {
+		t.Fatal(err)
+	}
+	failingOpts := opts
+	failingOpts.Report = filepath.Join(dir, "missing", "report.json")
+	m, err := manager.NewManager(failingOpts, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.GetLeaks()) == 0 {
+		t.Fatal("expected leaks to report")
+	}
+	if err := m.Report(); err == nil {
+		t.Fatal("expected the report to fail")
+	}
+	if b, err := ioutil.ReadFile(statePath); err != nil || string(b) != state {
+		t.Errorf("expected the scan state to be left as it was, got %v\n%s", err, b)
+	}
+
+	// states saved before the config was kept are read, their repos are scanned again
+	state = fmt.Sprintf(`{"repos": {%q: %q}}`, filepath.Join(dir, "dormant"), lastScan.Format(time.RFC3339))
+	if err := ioutil.WriteFile(statePath, []byte(state), 0600); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := loadScanState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scan := saved.Repos[filepath.Join(dir, "dormant")]; !scan.Scanned.Equal(lastScan) || scan.Config != "" {
+		t.Errorf("expected the scan of the dormant repo without a config, got %+v", scan)
+	}
+}
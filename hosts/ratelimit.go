@@ -0,0 +1,179 @@
+package hosts
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxRateLimitRetries is how often a request rejected by a rate limit is retried
+	maxRateLimitRetries = 3
+
+	// secondaryLimitWait is how long to wait after hitting a secondary rate limit when the
+	// response doesn't say for how long, as recommended by github
+	secondaryLimitWait = time.Minute
+
+	// paceFraction is the fraction of the rate limit left at which requests start to be spread
+	// out over the time until the limit resets
+	paceFraction = 10
+)
+
+// rateLimitTransport keeps host api calls within the rate limits of github and gitlab. Both report the
+// limit in response headers, github as X-RateLimit-* and gitlab as RateLimit-*. Once less than a tenth
+// of the limit is left requests are paced so the rest lasts until the limit resets, and when the limit is
+// used up requests wait for the reset instead of failing. Requests rejected by a rate limit, including
+// github's secondary rate limits, are retried after the wait the host asks for.
+type rateLimitTransport struct {
+	base  http.RoundTripper
+	sleep func(time.Duration)
+	now   func() time.Time
+
+	mu        sync.Mutex
+	known     bool
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// hostHTTPClient returns the http client used for host api calls
+func hostHTTPClient(m *manager.Manager) *http.Client {
+	base := http.DefaultTransport
+	if m.HTTPClient != nil {
+		base = m.HTTPClient.Transport
+	}
+	return &http.Client{Transport: newRateLimitTransport(base)}
+}
+
+func newRateLimitTransport(base http.RoundTripper) *rateLimitTransport {
+	return &rateLimitTransport{
+		base:  base,
+		sleep: time.Sleep,
+		now:   time.Now,
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if wait := t.pace(req.URL.Host); wait > 0 {
+			t.sleep(wait)
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		t.update(resp.Header)
+
+		wait, limited := t.retryAfter(resp)
+		// requests with a body that can't be replayed are not retried
+		if !limited || attempt == maxRateLimitRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		_ = resp.Body.Close()
+		log.Warnf("%s rate limit exceeded, waiting %s before retrying", req.URL.Host, wait.Round(time.Second))
+		t.sleep(wait)
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// pace returns how long to wait before sending the next request to host
+func (t *rateLimitTransport) pace(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	if !t.known || !now.Before(t.reset) {
+		return 0
+	}
+	untilReset := t.reset.Sub(now)
+	if t.remaining <= 0 {
+		log.Infof("%s rate limit used up, waiting %s until it resets", host, untilReset.Round(time.Second))
+		// the reset may already have happened when the wait is over, but the next response will tell
+		t.known = false
+		return untilReset + time.Second
+	}
+	if t.remaining*paceFraction > t.limit {
+		return 0
+	}
+	wait := untilReset / time.Duration(t.remaining)
+	log.Debugf("%s rate limit nearly used up, %d requests left, pacing requests %s apart", host, t.remaining, wait.Round(time.Millisecond))
+	t.remaining--
+	return wait
+}
+
+// update records the rate limit reported by a response
+func (t *rateLimitTransport) update(header http.Header) {
+	limit, okLimit := rateLimitHeader(header, "Limit")
+	remaining, okRemaining := rateLimitHeader(header, "Remaining")
+	reset, okReset := rateLimitHeader(header, "Reset")
+	if !okLimit || !okRemaining || !okReset {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.known = true
+	t.limit = limit
+	t.remaining = remaining
+	t.reset = time.Unix(int64(reset), 0)
+}
+
+// retryAfter returns how long to wait before retrying a request if resp rejected it because of a rate limit
+func (t *rateLimitTransport) retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusForbidden {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if remaining, ok := rateLimitHeader(resp.Header, "Remaining"); ok && remaining == 0 {
+		if reset, ok := rateLimitHeader(resp.Header, "Reset"); ok {
+			if wait := time.Unix(int64(reset), 0).Sub(t.now()); wait > 0 {
+				return wait + time.Second, true
+			}
+			return time.Second, true
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return secondaryLimitWait, true
+	}
+
+	// github reports secondary rate limits as 403s, which are otherwise permission errors
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 0, false
+	}
+	msg := strings.ToLower(string(body))
+	if strings.Contains(msg, "secondary rate limit") || strings.Contains(msg, "abuse detection") {
+		return secondaryLimitWait, true
+	}
+	return 0, false
+}
+
+// rateLimitHeader returns the value of the X-RateLimit-{name} header set by github or the
+// RateLimit-{name} header set by gitlab
+func rateLimitHeader(header http.Header, name string) (int, bool) {
+	value := header.Get("X-RateLimit-" + name)
+	if value == "" {
+		value = header.Get("RateLimit-" + name)
+	}
+	n, err := strconv.Atoi(value)
+	return n, err == nil
+}
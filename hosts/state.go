@@ -0,0 +1,134 @@
+package hosts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// scanState holds when each repo of host scans was last scanned successfully (--scan-state), by the url it's
+// cloned from. Repos that haven't been pushed to since are skipped, so nightly scans of an organization only
+// clone and scan the repos active since the last night. Repos last scanned with another config are scanned
+// again, the new config may find leaks the last scan didn't.
+type scanState struct {
+	path string
+	mux  sync.Mutex
+	// config is the ConfigHash of the scan
+	config string
+
+	Repos map[string]repoScan `json:"repos"`
+}
+
+// repoScan is the last successful scan of a repo and the ConfigHash of its config
+type repoScan struct {
+	Scanned time.Time `json:"scanned"`
+	Config  string    `json:"config"`
+}
+
+// UnmarshalJSON reads the scan of a repo, or the time alone of the states saved before the config was kept
+func (r *repoScan) UnmarshalJSON(b []byte) error {
+	if len(b) != 0 && b[0] == '"' {
+		return json.Unmarshal(b, &r.Scanned)
+	}
+	type scan repoScan
+	return json.Unmarshal(b, (*scan)(r))
+}
+
+// hostScanState returns the --scan-state of the scan of m, or nil without it. Pull request scans keep no state.
+func hostScanState(m *manager.Manager) (*scanState, error) {
+	if m.Opts.ScanState == "" || m.Opts.PullRequest != "" {
+		return nil, nil
+	}
+	state, err := loadScanState(m.Opts.ScanState)
+	if err != nil {
+		return nil, err
+	}
+	if state.config, err = m.ConfigHash(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// loadScanState reads the scan state at path. A missing file is an empty state, every repo is scanned.
+func loadScanState(path string) (*scanState, error) {
+	state := &scanState{path: path, Repos: make(map[string]repoScan)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	if state.Repos == nil {
+		state.Repos = make(map[string]repoScan)
+	}
+	return state, nil
+}
+
+// skip returns true if the repo at url was last pushed to at pushedAt, before it was last scanned with the config
+// of the scan. Repos without a push date are always scanned. A nil state skips no repos.
+func (s *scanState) skip(url string, pushedAt time.Time) bool {
+	if s == nil || pushedAt.IsZero() {
+		return false
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	scan, ok := s.Repos[url]
+	if ok && scan.Config == s.config && pushedAt.Before(scan.Scanned) {
+		log.Infof("skipping %s, not pushed to since it was scanned at %s", url, scan.Scanned.Format(time.RFC3339))
+		return true
+	}
+	return false
+}
+
+// scanned records a successful scan of the repo at url started at start. Pushes during the scan are after start,
+// so the repo is scanned again by the next scan.
+func (s *scanState) scanned(url string, start time.Time) {
+	if s == nil {
+		return
+	}
+	s.mux.Lock()
+	s.Repos[url] = repoScan{Scanned: start, Config: s.config}
+	s.mux.Unlock()
+}
+
+// saveAfterReport saves the state once the leaks of the scan of m are reported, like the heads of cached clones.
+// The repos of a scan whose report fails or is interrupted are scanned again by the next scan, and so is every
+// repo of a scan stopped early.
+func (s *scanState) saveAfterReport(m *manager.Manager) {
+	if s == nil {
+		return
+	}
+	m.AfterReport(func() error {
+		if m.Stopped() {
+			return nil
+		}
+		return s.save()
+	})
+}
+
+// save writes the state back to its file
+func (s *scanState) save() error {
+	if s == nil {
+		return nil
+	}
+	s.mux.Lock()
+	b, err := json.MarshalIndent(s, "", " ")
+	s.mux.Unlock()
+	if err != nil {
+		return err
+	}
+	// written to a temporary file first so an interrupted write can't lose the state of every repo
+	if err := ioutil.WriteFile(s.path+".tmp", b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
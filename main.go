@@ -1,11 +1,16 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/zricethezav/gitleaks/v6/config"
+	"github.com/zricethezav/gitleaks/v6/daemon"
 	"github.com/zricethezav/gitleaks/v6/hosts"
 	"github.com/zricethezav/gitleaks/v6/manager"
 	"github.com/zricethezav/gitleaks/v6/options"
@@ -16,12 +21,12 @@ import (
 )
 
 func main() {
-	log.Info("Gitleaks - SeeEverything Edition\n")
 	opts, err := options.ParseOptions()
 	if err != nil {
 		log.Error(err)
 		os.Exit(options.ErrorEncountered)
 	}
+	log.Info("Gitleaks - SeeEverything Edition\n")
 
 	err = opts.Guard()
 	if err != nil {
@@ -29,12 +34,82 @@ func main() {
 		os.Exit(options.ErrorEncountered)
 	}
 
+	if opts.Trends.Active {
+		trends, err := manager.Trends(opts.Trends.Database)
+		if err != nil {
+			log.Error(err)
+			os.Exit(options.ErrorEncountered)
+		}
+		// validated by Guard
+		loc, _ := opts.ReportLocation()
+		if err := manager.WriteTrends(os.Stdout, trends, opts.Trends.Format, loc); err != nil {
+			log.Error(err)
+			os.Exit(options.ErrorEncountered)
+		}
+		os.Exit(options.Success)
+	}
+
+	if opts.Mark.Active {
+		if err := markLeak(opts); err != nil {
+			log.Error(err)
+			os.Exit(options.ErrorEncountered)
+		}
+		os.Exit(options.Success)
+	}
+
+	if opts.ConfigCmd.Migrate.Active {
+		if err := migrateConfig(opts); err != nil {
+			log.Error(err)
+			os.Exit(options.ErrorEncountered)
+		}
+		os.Exit(options.Success)
+	}
+
 	cfg, err := config.NewConfig(opts)
 	if err != nil {
 		log.Error(err)
 		os.Exit(options.ErrorEncountered)
 	}
 
+	if opts.ConfigCmd.Export.Active {
+		if err := exportConfig(opts, cfg); err != nil {
+			log.Error(err)
+			os.Exit(options.ErrorEncountered)
+		}
+		os.Exit(options.Success)
+	}
+
+	if opts.ConfigCmd.Doctor.Active {
+		dir := opts.RepoPath
+		if dir == "" {
+			dir = "."
+		}
+		problems, err := scan.Doctor(os.Stdout, cfg, dir, opts.Config)
+		if err != nil {
+			log.Error(err)
+			os.Exit(options.ErrorEncountered)
+		}
+		if problems != 0 {
+			os.Exit(options.LeaksPresent)
+		}
+		os.Exit(options.Success)
+	}
+
+	if opts.Explain != "" {
+		if scan.Explain(os.Stdout, cfg, opts.ExplainPath, opts.Explain) {
+			os.Exit(options.LeaksPresent)
+		}
+		os.Exit(options.Success)
+	}
+
+	if opts.Daemon.Active {
+		if err := daemon.Run(opts, cfg); err != nil {
+			log.Error(err)
+			os.Exit(options.ErrorEncountered)
+		}
+		os.Exit(options.Success)
+	}
+
 	m, err := manager.NewManager(opts, cfg)
 	if err != nil {
 		log.Error(err)
@@ -47,19 +122,50 @@ func main() {
 		os.Exit(options.ErrorEncountered)
 	}
 
-	leaks := m.GetLeaks()
+	// the leaks of report-only rules are reported but don't fail the scan
+	leaks := m.FailingLeakCount()
 	metadata := m.GetMetadata()
 
-	if len(m.GetLeaks()) != 0 {
-		if m.Opts.CheckUncommitted() {
-			log.Warnf("%d leaks detected in staged changes", len(leaks))
+	if m.Opts.Sample != "" {
+		// leaks are only found in the sampled commits, the totals of the history scale with the coverage
+		total := metadata.Commits + metadata.SampledOut
+		coverage := 0.0
+		if total != 0 {
+			coverage = float64(metadata.Commits) / float64(total)
+		}
+		log.Infof("sampled %d of %d commits (%.2f%% coverage)", metadata.Commits, total, coverage*100)
+		if coverage != 0 && leaks != 0 {
+			log.Infof("about %.0f leaks estimated in the whole history", float64(leaks)/coverage)
+		}
+	}
+	if skipped := m.SkippedFiles(); len(skipped) != 0 {
+		log.Infof("skipped %s", skippedFiles(skipped))
+	}
+	if reportOnly := m.LeakCount() - leaks; reportOnly != 0 {
+		log.Infof("%d leaks of report-only rules detected", reportOnly)
+	}
+	if leaks != 0 {
+		if m.Opts.CommitMsgFile != "" {
+			log.Warnf("%d leaks detected in commit message", leaks)
+		} else if m.Opts.Env.Active {
+			log.Warnf("%d leaks detected in %s", leaks, envTarget(m.Opts))
+		} else if m.Opts.Artifact != "" {
+			log.Warnf("%d leaks detected in artifact %s", leaks, m.Opts.Artifact)
+		} else if m.Opts.CheckUncommitted() {
+			log.Warnf("%d leaks detected in staged changes", leaks)
 		} else {
-			log.Warnf("%d leaks detected. %d commits scanned in %s", len(leaks),
+			log.Warnf("%d leaks detected. %d commits scanned in %s", leaks,
 				metadata.Commits, durafmt.Parse(time.Duration(metadata.ScanTime)*time.Nanosecond))
 		}
 		os.Exit(options.LeaksPresent)
 	} else {
-		if m.Opts.CheckUncommitted() {
+		if m.Opts.CommitMsgFile != "" {
+			log.Infof("No leaks detected in commit message")
+		} else if m.Opts.Env.Active {
+			log.Infof("No leaks detected in %s", envTarget(m.Opts))
+		} else if m.Opts.Artifact != "" {
+			log.Infof("No leaks detected in artifact %s", m.Opts.Artifact)
+		} else if m.Opts.CheckUncommitted() {
 			log.Infof("No leaks detected in staged changes")
 		} else {
 			log.Infof("No leaks detected. %d commits scanned in %s",
@@ -75,7 +181,8 @@ func main() {
 // If no options or the uncommitted option is set then a pre-commit scan will
 // take place -- this is similar to running `git diff` on all the tracked files.
 func Run(m *manager.Manager) error {
-	if m.Opts.Disk {
+	// clones spilled to disk past --memory-limit are removed along with the clones made on disk
+	if m.Opts.Disk || m.Opts.PartialClone || m.Opts.MemoryLimit != 0 {
 		dir, err := ioutil.TempDir("", "gitleaks")
 		defer os.RemoveAll(dir)
 		if err != nil {
@@ -85,7 +192,7 @@ func Run(m *manager.Manager) error {
 	}
 
 	var err error
-	if m.Opts.Host != "" {
+	if m.Opts.HostScan() {
 		err = hosts.Run(m)
 	} else {
 		err = scan.Run(m)
@@ -94,5 +201,130 @@ func Run(m *manager.Manager) error {
 		return err
 	}
 
-	return m.Report()
+	if err = m.Report(); err != nil {
+		return err
+	}
+
+	if m.Opts.MRComment != "" {
+		return hosts.PostMRComment(m)
+	}
+	return nil
+}
+
+// envTarget describes what the env command scanned
+func envTarget(opts options.Options) string {
+	if opts.Env.EnvFile != "" {
+		return opts.Env.EnvFile
+	}
+	return "environment variables"
+}
+
+// skippedFiles describes the files skipped instead of scanned, like "12 files (10 binary, 2 image)", by reason
+func skippedFiles(skipped map[string]int) string {
+	var reasons []string
+	for reason := range skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	total := 0
+	for i, reason := range reasons {
+		total += skipped[reason]
+		reasons[i] = fmt.Sprintf("%d %s", skipped[reason], reason)
+	}
+	return fmt.Sprintf("%d files (%s)", total, strings.Join(reasons, ", "))
+}
+
+// migrateConfig upgrades the config of --config to the current config version, printing it or rewriting the config
+// with --write
+func migrateConfig(opts options.Options) error {
+	b, err := ioutil.ReadFile(opts.Config)
+	if err != nil {
+		return err
+	}
+	migrated, version, err := config.Migrate(b)
+	if err != nil {
+		return err
+	}
+	if !opts.ConfigCmd.Migrate.Write {
+		_, err = os.Stdout.Write(migrated)
+		return err
+	}
+	if version == config.SchemaVersion {
+		log.Infof("%s is already config version %d", opts.Config, version)
+		return nil
+	}
+	if err := ioutil.WriteFile(opts.Config, migrated, 0644); err != nil {
+		return err
+	}
+	log.Infof("upgraded %s from config version %d to %d", opts.Config, version, config.SchemaVersion)
+	return nil
+}
+
+// exportConfig prints the config of --config, or the default config, as written or, with --resolved, as
+// scans run with it
+func exportConfig(opts options.Options, cfg config.Config) error {
+	var b []byte
+	var err error
+	switch {
+	case opts.ConfigCmd.Export.Resolved:
+		b, err = config.Export(cfg)
+	case opts.Config != "":
+		b, err = ioutil.ReadFile(opts.Config)
+	default:
+		b = []byte(config.DefaultConfig)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
+
+// markLeak records the verdict of the mark command in --triage-store, or prints the false positives of the store
+// as allowlist entries with --export
+func markLeak(opts options.Options) error {
+	store, err := manager.LoadTriageStore(opts.TriageStore)
+	if err != nil {
+		return err
+	}
+	if opts.Mark.Export {
+		b, err := store.ExportAllowlist()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+
+	fingerprint := opts.Mark.Args.Fingerprint
+	var leak *manager.Leak
+	if opts.Mark.FromReport != "" {
+		b, err := ioutil.ReadFile(opts.Mark.FromReport)
+		if err != nil {
+			return err
+		}
+		var leaks []manager.Leak
+		if err := json.Unmarshal(b, &leaks); err != nil {
+			return fmt.Errorf("unable to read %s, --from-report must be a json report: %v", opts.Mark.FromReport, err)
+		}
+		for i := range leaks {
+			if leaks[i].Fingerprint == fingerprint {
+				leak = &leaks[i]
+				break
+			}
+		}
+		if leak == nil {
+			return fmt.Errorf("no leak of fingerprint %s in %s", fingerprint, opts.Mark.FromReport)
+		}
+		if manager.IsRedacted(*leak) {
+			// the offender recorded would be exported to the allowlist
+			return fmt.Errorf("%s is redacted, --from-report must be a report of a scan without --redact or --redact-report-only", opts.Mark.FromReport)
+		}
+	}
+	store.Mark(fingerprint, opts.Mark.Args.Verdict, leak)
+	if err := store.Save(); err != nil {
+		return err
+	}
+	log.Infof("marked %s as %s in %s", fingerprint, opts.Mark.Args.Verdict, opts.TriageStore)
+	return nil
 }
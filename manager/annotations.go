@@ -0,0 +1,179 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// isAnnotationFormat returns true if the report format is a CI service message format. These formats
+// are only rendered by CI systems when they are printed to stdout.
+func isAnnotationFormat(format string) bool {
+	switch format {
+	case "github-actions", "teamcity", "azure-pipelines":
+		return true
+	}
+	return false
+}
+
+// writeGithubActions writes leaks as GitHub Actions workflow commands. When these commands are printed to
+// stdout during a workflow run, GitHub renders each leak as an error annotation on the offending file and line,
+// or as a warning for the leaks of report-only rules. Scans stopped early end with a warning saying so.
+// See https://docs.github.com/en/actions/reference/workflow-commands-for-github-actions
+func (manager *Manager) writeGithubActions(w io.Writer) error {
+	for _, leak := range manager.reportLeaks() {
+		props := []string{
+			"file=" + escapeGithubProperty(leak.File),
+		}
+		if leak.LineNumber > 0 {
+			props = append(props, fmt.Sprintf("line=%d", leak.LineNumber))
+			if leak.MatchEnd > leak.MatchStart {
+				props = append(props, fmt.Sprintf("col=%d,endColumn=%d", leak.MatchStart+1, leak.MatchEnd))
+			}
+		}
+		props = append(props, "title="+escapeGithubProperty(leak.Rule))
+
+		command := "error"
+		if leak.ReportOnly {
+			command = "warning"
+		}
+		msg := fmt.Sprintf("%s secret detected in commit %s", leak.Rule, ShortSha(leak.Commit))
+		if _, err := fmt.Fprintf(w, "::%s %s::%s\n", command, strings.Join(props, ","), escapeGithubData(msg)); err != nil {
+			return err
+		}
+	}
+	if notice := manager.stopNotice(); notice != "" {
+		_, err := fmt.Fprintf(w, "::warning title=Gitleaks::%s\n", escapeGithubData(notice))
+		return err
+	}
+	return nil
+}
+
+// escapeGithubData escapes the message portion of a workflow command
+func escapeGithubData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
+
+// escapeGithubProperty escapes a property value of a workflow command. Properties
+// additionally need colons and commas escaped as those delimit the properties themselves.
+func escapeGithubProperty(s string) string {
+	s = escapeGithubData(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	return strings.ReplaceAll(s, ",", "%2C")
+}
+
+// writeTeamCity writes leaks as TeamCity service messages. Each rule is registered as an inspection type
+// and each leak as an inspection so TeamCity lists leaks in the build's "Inspections" tab.
+// See https://www.jetbrains.com/help/teamcity/service-messages.html#Reporting+Inspections
+func (manager *Manager) writeTeamCity(w io.Writer) error {
+	seen := make(map[string]bool)
+	for _, leak := range manager.reportLeaks() {
+		id := leakRuleID(leak)
+		if !seen[id] {
+			seen[id] = true
+			if _, err := fmt.Fprintf(w, "##teamcity[inspectionType id='%s' name='%s' category='gitleaks' description='%s']\n",
+				escapeTeamCity(id), escapeTeamCity(leak.Rule),
+				escapeTeamCity(leak.Rule+" secret detected")); err != nil {
+				return err
+			}
+		}
+
+		msg := fmt.Sprintf("%s secret detected in commit %s", leak.Rule, ShortSha(leak.Commit))
+		line := ""
+		if leak.LineNumber > 0 {
+			line = fmt.Sprintf(" line='%d'", leak.LineNumber)
+		}
+		severity := "ERROR"
+		if leak.ReportOnly {
+			severity = "WARNING"
+		}
+		if _, err := fmt.Fprintf(w, "##teamcity[inspection typeId='%s' message='%s' file='%s'%s SEVERITY='%s']\n",
+			escapeTeamCity(id), escapeTeamCity(msg), escapeTeamCity(leak.File), line, severity); err != nil {
+			return err
+		}
+	}
+	if notice := manager.stopNotice(); notice != "" {
+		_, err := fmt.Fprintf(w, "##teamcity[message text='%s' status='WARNING']\n", escapeTeamCity(notice))
+		return err
+	}
+	return nil
+}
+
+// writeAzurePipelines writes leaks as Azure Pipelines logging commands which show up as errors
+// in the pipeline run summary, or as warnings for the leaks of report-only rules.
+// See https://docs.microsoft.com/en-us/azure/devops/pipelines/scripts/logging-commands
+func (manager *Manager) writeAzurePipelines(w io.Writer) error {
+	for _, leak := range manager.reportLeaks() {
+		issueType := "error"
+		if leak.ReportOnly {
+			issueType = "warning"
+		}
+		props := []string{
+			"type=" + issueType,
+			"sourcepath=" + escapeAzureProperty(leak.File),
+		}
+		if leak.LineNumber > 0 {
+			props = append(props, fmt.Sprintf("linenumber=%d", leak.LineNumber))
+			if leak.MatchEnd > leak.MatchStart {
+				props = append(props, fmt.Sprintf("columnnumber=%d", leak.MatchStart+1))
+			}
+		}
+		props = append(props, "code="+escapeAzureProperty(leakRuleID(leak)))
+
+		msg := fmt.Sprintf("%s secret detected in commit %s", leak.Rule, ShortSha(leak.Commit))
+		if _, err := fmt.Fprintf(w, "##vso[task.logissue %s;]%s\n", strings.Join(props, ";"), escapeAzureData(msg)); err != nil {
+			return err
+		}
+	}
+	if notice := manager.stopNotice(); notice != "" {
+		_, err := fmt.Fprintf(w, "##vso[task.logissue type=warning;]%s\n", escapeAzureData(notice))
+		return err
+	}
+	return nil
+}
+
+// escapeTeamCity escapes values of TeamCity service message attributes
+func escapeTeamCity(s string) string {
+	return strings.NewReplacer(
+		"|", "||",
+		"'", "|'",
+		"\n", "|n",
+		"\r", "|r",
+		"[", "|[",
+		"]", "|]",
+		"\u0085", "|x",
+		"\u2028", "|l",
+		"\u2029", "|p",
+	).Replace(s)
+}
+
+// escapeAzureData escapes the message portion of an Azure Pipelines logging command
+func escapeAzureData(s string) string {
+	return strings.NewReplacer(
+		"%", "%AZP25",
+		"\r", "%0D",
+		"\n", "%0A",
+	).Replace(s)
+}
+
+// escapeAzureProperty escapes a property value of an Azure Pipelines logging command
+func escapeAzureProperty(s string) string {
+	return strings.NewReplacer(
+		"%", "%AZP25",
+		"\r", "%0D",
+		"\n", "%0A",
+		";", "%3B",
+		"]", "%5D",
+	).Replace(s)
+}
+
+// ShortSha returns the abbreviated commit sha shown by git, or sha as is if it isn't a sha, like the messages
+// of leaks found outside of history
+func ShortSha(sha string) string {
+	if len(sha) == 40 {
+		return sha[:7]
+	}
+	return sha
+}
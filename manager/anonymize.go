@@ -0,0 +1,34 @@
+package manager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// anonymizedIDLen is the number of hex characters of the hash kept in anonymized authors
+const anonymizedIDLen = 16
+
+// anonymizeAuthor replaces the author and email of l with pseudonyms derived from their hashes
+// (--anonymize-authors). The same author always gets the same pseudonym, so leaks can still be grouped
+// by author without the report revealing who it is. The hashes are keyed with
+// GITLEAKS_ANONYMIZE_KEY if it is set, without a key anyone with a list of candidate emails can find out
+// who is behind a pseudonym.
+func anonymizeAuthor(l *Leak) {
+	key := []byte(os.Getenv("GITLEAKS_ANONYMIZE_KEY"))
+	if l.Author != "" {
+		l.Author = "author-" + anonymizedID(key, strings.TrimSpace(l.Author))
+	}
+	if l.Email != "" {
+		// email addresses are case insensitive in practice
+		l.Email = anonymizedID(key, strings.ToLower(strings.TrimSpace(l.Email))) + "@anonymized.invalid"
+	}
+}
+
+func anonymizedID(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:anonymizedIDLen]
+}
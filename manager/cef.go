@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/version"
+)
+
+// cefSeverities maps the severities of rules to the 0-10 severity of CEF
+var cefSeverities = map[string]int{
+	"info":     1,
+	"low":      3,
+	"medium":   5,
+	"high":     8,
+	"critical": 10,
+}
+
+// writeCEF writes the leaks of the scan as ArcSight Common Event Format events to w, one per line. The fields of
+// leaks without a CEF key are written as custom string and number extensions, labeled with the field.
+// See https://www.microfocus.com/documentation/arcsight/arcsight-smartconnectors/pdfdoc/common-event-format-v25/common-event-format-v25.pdf
+func (manager *Manager) writeCEF(w io.Writer) error {
+	now := time.Now()
+	for _, leak := range manager.reportLeaks() {
+		if _, err := io.WriteString(w, cefEvent(leak, now)); err != nil {
+			return err
+		}
+	}
+	if event := manager.cefStopEvent(now); event != "" {
+		_, err := io.WriteString(w, event)
+		return err
+	}
+	return nil
+}
+
+// cefStopEvent returns the CEF event of a scan stopped early, reported at now, as a line, or "" if the scan
+// wasn't stopped
+func (manager *Manager) cefStopEvent(now time.Time) string {
+	notice := manager.stopNotice()
+	if notice == "" {
+		return ""
+	}
+	return fmt.Sprintf("CEF:0|Gitleaks|Gitleaks|%s|scan-stopped|Scan stopped early|%d|rt=%d msg=%s\n",
+		escapeCEFHeader(version.Version), cefSeverities["medium"], now.UnixNano()/int64(time.Millisecond),
+		escapeCEFExtension(notice))
+}
+
+// cefEvent returns the CEF event of leak, reported at now, as a line
+func cefEvent(leak Leak, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|Gitleaks|Gitleaks|%s|%s|%s|%d|", escapeCEFHeader(version.Version),
+		escapeCEFHeader(leakRuleID(leak)), escapeCEFHeader(leak.Rule+" secret detected"), cefSeverities[leakSeverity(leak)])
+	extensions := 0
+	extension := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if extensions != 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(key + "=" + escapeCEFExtension(value))
+		extensions++
+	}
+	// custom extensions are labeled by their label extension
+	custom := func(key, label, value string) {
+		if value != "" {
+			extension(key+"Label", label)
+			extension(key, value)
+		}
+	}
+	extension("rt", strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10))
+	extension("msg", fmt.Sprintf("%s secret detected in commit %s", leak.Rule, leak.Commit))
+	extension("externalId", leak.lookupHash)
+	extension("fname", path.Base(leak.File))
+	extension("filePath", leak.File)
+	extension("suser", leak.Author)
+	if !leak.Date.IsZero() {
+		extension("start", strconv.FormatInt(leak.Date.UnixNano()/int64(time.Millisecond), 10))
+	}
+	extension("request", leak.URL)
+	custom("cs1", "commit", leak.Commit)
+	custom("cs2", "repo", leak.Repo)
+	custom("cs3", "offender", leak.Offender)
+	custom("cs4", "line", leak.Line)
+	custom("cs5", "tags", leak.Tags)
+	custom("cs6", "email", leak.Email)
+	custom("cn1", "lineNumber", strconv.Itoa(leak.LineNumber))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// escapeCEFHeader escapes the pipes and backslashes of the header fields of CEF events
+func escapeCEFHeader(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// escapeCEFExtension escapes the backslashes, equal signs and line breaks of the values of CEF extensions
+func escapeCEFExtension(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
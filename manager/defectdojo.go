@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// defectDojoReport is the report written with --report-format=defectdojo, in the format of DefectDojo's
+// Generic Findings Import
+// See https://documentation.defectdojo.com/integrations/parsers/file/generic/
+type defectDojoReport struct {
+	Findings []defectDojoFinding `json:"findings"`
+
+	// Truncated is set to why the scan stopped early if it did, the import ignores it
+	Truncated string `json:"truncated,omitempty"`
+}
+
+type defectDojoFinding struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Severity    string `json:"severity"`
+	Date        string `json:"date,omitempty"`
+	FilePath    string `json:"file_path"`
+	Line        int    `json:"line,omitempty"`
+	CWE         int    `json:"cwe"`
+	Mitigation  string `json:"mitigation"`
+	References  string `json:"references,omitempty"`
+
+	// UniqueID is the fingerprint of the leak so DefectDojo deduplicates the leaks found again by later scans
+	UniqueID       string `json:"unique_id_from_tool"`
+	VulnID         string `json:"vuln_id_from_tool"`
+	ComponentName  string `json:"component_name,omitempty"`
+	StaticFinding  bool   `json:"static_finding"`
+	DynamicFinding bool   `json:"dynamic_finding"`
+}
+
+// cweHardcodedCredentials is CWE-798: Use of Hard-coded Credentials
+const cweHardcodedCredentials = 798
+
+// writeDefectDojo writes the leaks of the scan as DefectDojo findings to w
+func (manager *Manager) writeDefectDojo(w io.Writer) error {
+	report := defectDojoReport{Findings: []defectDojoFinding{}, Truncated: manager.StopReason()}
+	for _, leak := range manager.reportLeaks() {
+		finding := defectDojoFinding{
+			Title:          fmt.Sprintf("%s in %s", leak.Rule, leak.File),
+			Description:    defectDojoDescription(leak),
+			Severity:       strings.Title(leakSeverity(leak)),
+			FilePath:       leak.File,
+			Line:           leak.LineNumber,
+			CWE:            cweHardcodedCredentials,
+			Mitigation:     "Revoke and rotate the secret, then remove it from the code and, if needed, from the history of the repository.",
+			References:     leak.URL,
+			UniqueID:       leak.lookupHash,
+			VulnID:         leakRuleID(leak),
+			ComponentName:  leak.Repo,
+			StaticFinding:  true,
+			DynamicFinding: false,
+		}
+		if !leak.Date.IsZero() {
+			finding.Date = leak.Date.Format("2006-01-02")
+		}
+		report.Findings = append(report.Findings, finding)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(report)
+}
+
+// defectDojoDescription describes where leak was found, DefectDojo renders descriptions as markdown
+func defectDojoDescription(leak Leak) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s secret detected by gitleaks.\n\n", leak.Rule)
+	if leak.Repo != "" {
+		fmt.Fprintf(&b, "**Repo:** %s\n\n", leak.Repo)
+	}
+	fmt.Fprintf(&b, "**Commit:** %s\n\n", leak.Commit)
+	if leak.Author != "" {
+		fmt.Fprintf(&b, "**Author:** %s <%s>\n\n", leak.Author, leak.Email)
+	}
+	if leak.Tags != "" {
+		fmt.Fprintf(&b, "**Tags:** %s\n\n", leak.Tags)
+	}
+	fmt.Fprintf(&b, "**Secret:** `%s`\n\n", leak.Offender)
+	fmt.Fprintf(&b, "**Line:**\n```\n%s\n```\n", leak.Line)
+	return b.String()
+}
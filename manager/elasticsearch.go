@@ -0,0 +1,160 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/version"
+)
+
+const (
+	defaultElasticsearchIndex = "gitleaks"
+
+	// elasticsearchBulkSize is the number of leaks sent per bulk request
+	elasticsearchBulkSize = 1000
+)
+
+// elasticsearchTemplate is the index template installed for the indices leaks are written to. Fields that are
+// grouped and filtered on in dashboards are keywords, the lines and commit messages are searchable text.
+// Composable index templates are supported by Elasticsearch 7.8+ and OpenSearch.
+const elasticsearchTemplate = `{
+	"index_patterns": [%q],
+	"template": {
+		"mappings": {
+			"properties": {
+				"@timestamp": {"type": "date"},
+				"fingerprint": {"type": "keyword"},
+				"scanTarget": {"type": "keyword"},
+				"gitleaksVersion": {"type": "keyword"},
+				"repo": {"type": "keyword"},
+				"rule": {"type": "keyword"},
+				"tags": {"type": "keyword"},
+				"commit": {"type": "keyword"},
+				"file": {"type": "keyword"},
+				"oldFile": {"type": "keyword"},
+				"lineNumber": {"type": "integer"},
+				"line": {"type": "text"},
+				"offender": {"type": "keyword"},
+				"commitMessage": {"type": "text"},
+				"author": {"type": "keyword"},
+				"email": {"type": "keyword"},
+				"date": {"type": "date"},
+				"operation": {"type": "keyword"},
+				"mergeParent": {"type": "keyword"}
+			}
+		}
+	}
+}`
+
+// elasticsearchDoc is a leak as indexed into elasticsearch
+type elasticsearchDoc struct {
+	Leak
+	Timestamp   time.Time `json:"@timestamp"`
+	Fingerprint string    `json:"fingerprint"`
+	ScanTarget  string    `json:"scanTarget"`
+	Version     string    `json:"gitleaksVersion"`
+}
+
+// writeElasticsearch installs the index template and bulk indexes a document for every leak of the scan
+// into the index set by --elasticsearch-index. Every scan adds new documents so dashboards can show
+// findings over time, the fingerprint field groups the documents of the same leak.
+func (manager *Manager) writeElasticsearch(url string) error {
+	url = strings.TrimSuffix(url, "/")
+	index := manager.Opts.ESIndex
+	if index == "" {
+		index = defaultElasticsearchIndex
+	}
+
+	template := fmt.Sprintf(elasticsearchTemplate, index+"*")
+	if err := manager.elasticsearchRequest("PUT", url+"/_index_template/"+index, "application/json", template); err != nil {
+		return fmt.Errorf("unable to install index template: %v", err)
+	}
+
+	leaks := manager.reportLeaks()
+	now := time.Now()
+	for start := 0; start < len(leaks); start += elasticsearchBulkSize {
+		end := start + elasticsearchBulkSize
+		if end > len(leaks) {
+			end = len(leaks)
+		}
+		var body strings.Builder
+		encoder := json.NewEncoder(&body)
+		for _, leak := range leaks[start:end] {
+			action := map[string]map[string]string{"index": {"_index": index}}
+			if err := encoder.Encode(action); err != nil {
+				return err
+			}
+			doc := elasticsearchDoc{
+				Leak:        leak,
+				Timestamp:   now,
+				Fingerprint: leak.lookupHash,
+				ScanTarget:  manager.Opts.Target(),
+				Version:     version.Version,
+			}
+			if err := encoder.Encode(doc); err != nil {
+				return err
+			}
+		}
+		if err := manager.elasticsearchRequest("POST", url+"/_bulk", "application/x-ndjson", body.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// elasticsearchRequest sends a request to elasticsearch, authenticated with the api key or basic auth
+// credentials of the GITLEAKS_ELASTICSEARCH_* environment variables, and checks the response for errors
+func (manager *Manager) elasticsearchRequest(method, url, contentType, body string) error {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if apiKey := os.Getenv("GITLEAKS_ELASTICSEARCH_API_KEY"); apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+apiKey)
+	} else if user := os.Getenv("GITLEAKS_ELASTICSEARCH_USERNAME"); user != "" {
+		req.SetBasicAuth(user, os.Getenv("GITLEAKS_ELASTICSEARCH_PASSWORD"))
+	}
+
+	client := http.DefaultClient
+	if manager.HTTPClient != nil {
+		client = manager.HTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s %s", method, url, resp.Status, bytes.TrimSpace(respBody))
+	}
+
+	// bulk requests succeed even if some documents could not be indexed
+	var bulk struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respBody, &bulk); err == nil && bulk.Errors {
+		for _, item := range bulk.Items {
+			for _, result := range item {
+				if len(result.Error) != 0 {
+					return fmt.Errorf("bulk indexing failed: %s", result.Error)
+				}
+			}
+		}
+		return fmt.Errorf("bulk indexing failed")
+	}
+	return nil
+}
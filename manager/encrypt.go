@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	// keys without hash preferences fall back to RIPEMD-160, which must be linked in to encrypt to them
+	_ "golang.org/x/crypto/ripemd160"
+)
+
+// encryptedWriter encrypts what is written to it as an armored pgp message, Close finishes the message
+type encryptedWriter struct {
+	plaintext io.WriteCloser
+	armored   io.WriteCloser
+}
+
+// encryptReport returns a writer encrypting the report written to it to the keys of --encrypt-report, writing
+// the armored message to w. The writer must be closed to finish the message, w is left open.
+func (manager *Manager) encryptReport(w io.Writer) (io.WriteCloser, error) {
+	armored, err := armor.Encode(w, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openpgp.Encrypt(armored, manager.reportKeys, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedWriter{plaintext: plaintext, armored: armored}, nil
+}
+
+// writeEncryptedReport writes the report encrypted to the keys of --encrypt-report to w
+func (manager *Manager) writeEncryptedReport(w io.Writer) error {
+	encrypted, err := manager.encryptReport(w)
+	if err != nil {
+		return err
+	}
+	if err := manager.writeReport(encrypted); err != nil {
+		return err
+	}
+	return encrypted.Close()
+}
+
+func (e *encryptedWriter) Write(p []byte) (int, error) {
+	return e.plaintext.Write(p)
+}
+
+func (e *encryptedWriter) Close() error {
+	if err := e.plaintext.Close(); err != nil {
+		return err
+	}
+	return e.armored.Close()
+}
@@ -0,0 +1,254 @@
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/options"
+	"github.com/zricethezav/gitleaks/v6/version"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// eventQueueSize is the number of leaks that can wait to be published before the scan is slowed down
+	eventQueueSize = 1000
+
+	// eventBatchSize is the maximum number of leaks published at once
+	eventBatchSize = 100
+)
+
+// leakEventSchema is the avro schema of leak events published with --event-format=avro. Events are
+// written with avro's single object encoding, which prefixes them with the fingerprint of this schema.
+const leakEventSchema = `{
+	"type": "record",
+	"name": "Leak",
+	"namespace": "io.gitleaks",
+	"fields": [
+		{"name": "fingerprint", "type": "string"},
+		{"name": "scanTarget", "type": "string"},
+		{"name": "gitleaksVersion", "type": "string"},
+		{"name": "repo", "type": "string"},
+		{"name": "rule", "type": "string"},
+		{"name": "ruleRegex", "type": "string", "default": ""},
+		{"name": "tags", "type": "string"},
+		{"name": "commit", "type": "string"},
+		{"name": "file", "type": "string"},
+		{"name": "oldFile", "type": "string"},
+		{"name": "lineNumber", "type": "int"},
+		{"name": "line", "type": "string"},
+		{"name": "offender", "type": "string"},
+		{"name": "entropy", "type": "double", "default": 0},
+		{"name": "matchStart", "type": "int", "default": 0},
+		{"name": "matchEnd", "type": "int", "default": 0},
+		{"name": "commitMessage", "type": "string"},
+		{"name": "author", "type": "string"},
+		{"name": "email", "type": "string"},
+		{"name": "date", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "operation", "type": "string"},
+		{"name": "mergeParent", "type": "string"},
+		{"name": "groups", "type": {"type": "map", "values": "string"}, "default": {}},
+		{"name": "url", "type": "string", "default": ""},
+		{"name": "ruleID", "type": "string", "default": ""}
+	]
+}`
+
+// leakEvent is a leak as published with --event-format=json
+type leakEvent struct {
+	Leak
+	Fingerprint string `json:"fingerprint"`
+	ScanTarget  string `json:"scanTarget"`
+	Version     string `json:"gitleaksVersion"`
+}
+
+// event is a serialized leak, keyed by the leak's fingerprint
+type event struct {
+	key   string
+	value []byte
+}
+
+// eventPublisher publishes leak events to a message broker
+type eventPublisher interface {
+	publish(events []event) error
+	Close() error
+}
+
+// newEventPublisher returns the publisher for --kafka-brokers or --nats-url, or nil if neither is set. nats
+// connections over tls trust the roots of the tls config of client.
+func newEventPublisher(opts options.Options, client *http.Client) (eventPublisher, error) {
+	switch {
+	case opts.KafkaBrokers != "":
+		return newKafkaPublisher(opts), nil
+	case opts.NATSURL != "":
+		subject := opts.NATSSubject
+		if subject == "" {
+			subject = "gitleaks.leaks"
+		}
+		return dialNATS(opts.NATSURL, subject, clientTLSConfig(client))
+	}
+	return nil, nil
+}
+
+// publishEvents publishes the leaks received on manager.events until the channel is closed. Leaks that
+// arrive while a batch is being published are published together in the next batch.
+func (manager *Manager) publishEvents(publisher eventPublisher) {
+	encode, err := manager.eventEncoder()
+	if err != nil {
+		manager.eventsDone <- err
+		return
+	}
+
+	var failed int
+	var firstErr error
+	for leak := range manager.events {
+		batch := []Leak{leak}
+	drain:
+		for len(batch) < eventBatchSize {
+			select {
+			case l, ok := <-manager.events:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, l)
+			default:
+				break drain
+			}
+		}
+
+		events := make([]event, 0, len(batch))
+		for _, l := range batch {
+			value, err := encode(l)
+			if err != nil {
+				failed++
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			events = append(events, event{key: l.lookupHash, value: value})
+		}
+		if len(events) == 0 {
+			continue
+		}
+		if err := publisher.publish(events); err != nil {
+			log.Warnf("unable to publish %d leak events: %v", len(events), err)
+			failed += len(events)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	err = publisher.Close()
+	if firstErr != nil {
+		err = fmt.Errorf("%d leak events could not be published: %v", failed, firstErr)
+	}
+	manager.eventsDone <- err
+}
+
+// eventEncoder returns the func serializing leak events in the format set by --event-format
+func (manager *Manager) eventEncoder() (func(Leak) ([]byte, error), error) {
+	target := manager.Opts.Target()
+	if manager.Opts.EventFormat != "avro" {
+		return func(l Leak) ([]byte, error) {
+			return json.Marshal(leakEvent{Leak: l, Fingerprint: l.lookupHash, ScanTarget: target, Version: version.Version})
+		}, nil
+	}
+
+	codec, err := goavro.NewCodec(leakEventSchema)
+	if err != nil {
+		return nil, err
+	}
+	return func(l Leak) ([]byte, error) {
+		return codec.SingleFromNative(nil, map[string]interface{}{
+			"fingerprint":     l.lookupHash,
+			"scanTarget":      target,
+			"gitleaksVersion": version.Version,
+			"repo":            l.Repo,
+			"rule":            l.Rule,
+			"ruleRegex":       l.RuleRegex,
+			"tags":            l.Tags,
+			"commit":          l.Commit,
+			"file":            l.File,
+			"oldFile":         l.OldFile,
+			"lineNumber":      int32(l.LineNumber),
+			"line":            l.Line,
+			"offender":        l.Offender,
+			"entropy":         l.Entropy,
+			"matchStart":      int32(l.MatchStart),
+			"matchEnd":        int32(l.MatchEnd),
+			"commitMessage":   l.Message,
+			"author":          l.Author,
+			"email":           l.Email,
+			"date":            l.Date,
+			"operation":       l.Operation,
+			"mergeParent":     l.MergeParent,
+			"groups":          avroGroups(l.Groups),
+			"url":             l.URL,
+			"ruleID":          l.RuleID,
+		})
+	}, nil
+}
+
+// avroGroups converts the named groups of a leak to the native form of an avro map
+func avroGroups(groups map[string]string) map[string]interface{} {
+	native := make(map[string]interface{}, len(groups))
+	for name, value := range groups {
+		native[name] = value
+	}
+	return native
+}
+
+// kafkaPublisher publishes leak events to the topic set by --kafka-topic. Events are keyed by the leak's
+// fingerprint so the events of a leak found by many scans end up in the same partition.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher(opts options.Options) *kafkaPublisher {
+	topic := opts.KafkaTopic
+	if topic == "" {
+		topic = "gitleaks-leaks"
+	}
+	dialer := &kafka.Dialer{Timeout: 10 * time.Second, DualStack: true}
+	if user := os.Getenv("GITLEAKS_KAFKA_USERNAME"); user != "" {
+		dialer.SASLMechanism = plain.Mechanism{Username: user, Password: os.Getenv("GITLEAKS_KAFKA_PASSWORD")}
+		dialer.TLS = &tls.Config{}
+	}
+
+	var brokers []string
+	for _, broker := range strings.Split(opts.KafkaBrokers, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	return &kafkaPublisher{writer: kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      brokers,
+		Topic:        topic,
+		Dialer:       dialer,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    eventBatchSize,
+		BatchTimeout: 10 * time.Millisecond,
+	})}
+}
+
+func (p *kafkaPublisher) publish(events []event) error {
+	msgs := make([]kafka.Message, len(events))
+	for i, e := range events {
+		msgs[i] = kafka.Message{Key: []byte(e.key), Value: e.value}
+	}
+	return p.writer.WriteMessages(context.Background(), msgs...)
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,23 @@
+package manager
+
+// LeakFilter is called with every leak before it's counted and reported. It returns the leak to report, which
+// applications embedding gitleaks can redact or enrich, and false to drop the leak.
+type LeakFilter func(leak Leak) (Leak, bool)
+
+// AddLeakFilter adds filter to the filters leaks pass through, in the order they are added. Filters are added
+// before the scan starts and called from a single goroutine, after duplicate leaks are dropped and leaks are
+// redacted with --redact.
+func (manager *Manager) AddLeakFilter(filter LeakFilter) {
+	manager.leakFilters = append(manager.leakFilters, filter)
+}
+
+// filterLeak passes leak through the filters of the manager and returns false if one of them drops it
+func (manager *Manager) filterLeak(leak Leak) (Leak, bool) {
+	for _, filter := range manager.leakFilters {
+		var ok bool
+		if leak, ok = filter(leak); !ok {
+			return leak, false
+		}
+	}
+	return leak, true
+}
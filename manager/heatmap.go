@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"html/template"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// heatmapReport is the report written with --report-format=heatmap and heatmap-html. It counts the leaks of
+// the scan per directory and per file extension to show where leaks concentrate. The leaks of a directory
+// include the leaks of its subdirectories, so a chart or module directory ranks by all the leaks below it.
+type heatmapReport struct {
+	Leaks       int            `json:"leaks"`
+	Directories []heatmapEntry `json:"directories"`
+	Extensions  []heatmapEntry `json:"extensions"`
+
+	// Truncated is set to why the scan stopped early if it did
+	Truncated string `json:"truncated,omitempty"`
+}
+
+type heatmapEntry struct {
+	Name  string         `json:"name"`
+	Leaks int            `json:"leaks"`
+	Files int            `json:"files"`
+	Rules map[string]int `json:"rules"`
+
+	// Heat is Leaks relative to the entry with the most leaks, used to shade the html report
+	Heat float64 `json:"-"`
+}
+
+// noExtension is the extension files without one are counted under
+const noExtension = "(none)"
+
+// heatmapReport counts the leaks of the scan per directory and extension. Entries are sorted by leaks, most first.
+func (manager *Manager) heatmapReport() heatmapReport {
+	dirs := newHeatmapCounter()
+	exts := newHeatmapCounter()
+	leaks := manager.GetLeaks()
+	for _, leak := range leaks {
+		file := path.Clean("/" + leak.File)[1:]
+		// leaks of different repos are in different files, even if the paths match
+		fileKey := leak.Repo + "\x00" + file
+
+		for dir := path.Dir(file); ; dir = path.Dir(dir) {
+			dirs.add(dir+"/", fileKey, leak.Rule)
+			if dir == "." {
+				break
+			}
+		}
+		ext := strings.ToLower(path.Ext(file))
+		if ext == "" {
+			ext = noExtension
+		}
+		exts.add(ext, fileKey, leak.Rule)
+	}
+	return heatmapReport{
+		Leaks:       len(leaks),
+		Directories: dirs.entries(),
+		Extensions:  exts.entries(),
+		Truncated:   manager.StopReason(),
+	}
+}
+
+// heatmapCounter counts leaks, and the files they are in, by directory or extension
+type heatmapCounter struct {
+	counts map[string]*heatmapEntry
+	files  map[string]map[string]bool
+}
+
+func newHeatmapCounter() *heatmapCounter {
+	return &heatmapCounter{
+		counts: make(map[string]*heatmapEntry),
+		files:  make(map[string]map[string]bool),
+	}
+}
+
+// add counts a leak of rule in file under name
+func (c *heatmapCounter) add(name, file, rule string) {
+	e, ok := c.counts[name]
+	if !ok {
+		e = &heatmapEntry{Name: name, Rules: make(map[string]int)}
+		c.counts[name] = e
+		c.files[name] = make(map[string]bool)
+	}
+	e.Leaks++
+	e.Rules[rule]++
+	c.files[name][file] = true
+}
+
+// entries returns the entries counted, most leaks first
+func (c *heatmapCounter) entries() []heatmapEntry {
+	entries := []heatmapEntry{}
+	most := 0
+	for name, e := range c.counts {
+		e.Files = len(c.files[name])
+		if e.Leaks > most {
+			most = e.Leaks
+		}
+		entries = append(entries, *e)
+	}
+	for i := range entries {
+		entries[i].Heat = float64(entries[i].Leaks) / float64(most)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Leaks != entries[j].Leaks {
+			return entries[i].Leaks > entries[j].Leaks
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// writeHeatmapHTML writes the heatmap report as an html page with a table of directories and one of extensions,
+// rows shaded by their leaks
+func (manager *Manager) writeHeatmapHTML(w io.Writer) error {
+	return heatmapTemplate.Execute(w, manager.heatmapReport())
+}
+
+var heatmapTemplate = template.Must(template.New("heatmap").Funcs(template.FuncMap{
+	"entries": func(title string, entries []heatmapEntry) interface{} {
+		return struct {
+			Title   string
+			Entries []heatmapEntry
+		}{title, entries}
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Gitleaks heatmap</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 4px 12px; text-align: left; border-bottom: 1px solid #ddd; }
+td.count { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Gitleaks heatmap</h1>
+<p>{{.Leaks}} leaks</p>
+{{if .Truncated}}<p><strong>The scan was stopped early: {{.Truncated}}</strong></p>{{end}}
+{{define "entries"}}
+<table>
+<tr><th>{{.Title}}</th><th>Leaks</th><th>Files</th><th>Rules</th></tr>
+{{range .Entries}}<tr style="background-color: rgba(220, 38, 38, {{printf "%.2f" .Heat}})">
+<td><code>{{.Name}}</code></td><td class="count">{{.Leaks}}</td><td class="count">{{.Files}}</td>
+<td>{{range $rule, $leaks := .Rules}}{{$rule}} ({{$leaks}})<br>{{end}}</td>
+</tr>
+{{end}}</table>
+{{end}}
+<h2>Directories</h2>
+{{template "entries" (entries "Directory" .Directories)}}
+<h2>Extensions</h2>
+{{template "entries" (entries "Extension" .Extensions)}}
+</body>
+</html>
+`))
@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+// htmlLeak is a leak of the html report with its hunk split into diff lines
+type htmlLeak struct {
+	Leak
+	Diff []diffLine
+}
+
+// diffLine is a line of the diff of a leak in the html report. Op is "+", "-" or " " like in the patch, and
+// the line is split into segments around the secret so it's highlighted.
+type diffLine struct {
+	Op       string
+	Segments []diffSegment
+}
+
+type diffSegment struct {
+	Text   string
+	Secret bool
+}
+
+// htmlDiff returns the diff lines of leak. Leaks found with --patch-context show the lines of their hunk around
+// them, other leaks only their line.
+func htmlDiff(leak Leak) []diffLine {
+	lines := strings.Split(leak.Hunk, "\n")
+	if leak.Hunk == "" {
+		op := " "
+		switch leak.Operation {
+		case "addition":
+			op = "+"
+		case "deletion":
+			op = "-"
+		}
+		lines = []string{op + leak.Line}
+	}
+	diff := make([]diffLine, 0, len(lines))
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		diff = append(diff, diffLine{Op: line[:1], Segments: secretSegments(line[1:], leak.Offender)})
+	}
+	return diff
+}
+
+// secretSegments splits line into the occurrences of secret and the text around them
+func secretSegments(line, secret string) []diffSegment {
+	var segments []diffSegment
+	for secret != "" {
+		i := strings.Index(line, secret)
+		if i == -1 {
+			break
+		}
+		if i != 0 {
+			segments = append(segments, diffSegment{Text: line[:i]})
+		}
+		segments = append(segments, diffSegment{Text: secret, Secret: true})
+		line = line[i+len(secret):]
+	}
+	if line != "" || len(segments) == 0 {
+		segments = append(segments, diffSegment{Text: line})
+	}
+	return segments
+}
+
+// writeHTML writes the leaks of the scan as an html page for reviewers. Every leak shows the lines of the
+// hunk around it with the secret highlighted, so it can be reviewed without checking out its commit. Secrets
+// are redacted like in every other report.
+func (manager *Manager) writeHTML(w io.Writer) error {
+	leaks := manager.reportLeaks()
+	report := struct {
+		Leaks     []htmlLeak
+		Truncated string
+	}{
+		Leaks:     make([]htmlLeak, len(leaks)),
+		Truncated: manager.StopReason(),
+	}
+	for i, leak := range leaks {
+		report.Leaks[i] = htmlLeak{Leak: leak, Diff: htmlDiff(leak)}
+	}
+	return htmlTemplate.Execute(w, report)
+}
+
+var htmlTemplate = template.Must(template.New("html").Funcs(template.FuncMap{"shortSha": ShortSha}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Gitleaks report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.leak { border: 1px solid #ddd; margin-bottom: 2em; }
+.leak h2 { font-size: 1em; margin: 0; padding: 8px 12px; background-color: #f6f8fa; border-bottom: 1px solid #ddd; }
+.leak p { margin: 8px 12px; color: #555; }
+.diff { font-family: monospace; white-space: pre; overflow-x: auto; margin: 0; padding: 4px 0; }
+.diff div { padding: 0 12px; }
+.diff .add { background-color: #e6ffec; }
+.diff .del { background-color: #ffebe9; }
+.diff .hunk { color: #777; background-color: #f1f8ff; }
+.secret { background-color: #dc2626; color: #fff; }
+</style>
+</head>
+<body>
+<h1>Gitleaks report</h1>
+<p>{{len .Leaks}} leaks</p>
+{{if .Truncated}}<p><strong>The scan was stopped early: {{.Truncated}}</strong></p>{{end}}
+{{range .Leaks}}<div class="leak">
+<h2>{{.Rule}} in {{if .URL}}<a href="{{.URL}}"><code>{{.File}}:{{.LineNumber}}</code></a>{{else}}<code>{{.File}}:{{.LineNumber}}</code>{{end}}</h2>
+<p>{{if .Repo}}{{.Repo}} {{end}}{{if .Commit}}commit <code>{{shortSha .Commit}}</code> {{end}}{{if .Author}}by {{.Author}} {{end}}{{if not .Date.IsZero}}on {{.Date.Format "2006-01-02T15:04:05Z07:00"}}{{end}}</p>
+<div class="diff">{{if .HunkHeader}}<div class="hunk">{{.HunkHeader}}</div>{{end}}{{range .Diff}}<div class="{{if eq .Op "+"}}add{{else if eq .Op "-"}}del{{end}}">{{.Op}}{{range .Segments}}{{if .Secret}}<span class="secret">{{.Text}}</span>{{else}}{{.Text}}{{end}}{{end}}</div>{{end}}</div>
+</div>
+{{end}}</body>
+</html>
+`))
@@ -1,25 +1,34 @@
 package manager
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
-	"strings"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"text/tabwriter"
 	"time"
 
 	"github.com/zricethezav/gitleaks/v6/config"
 	"github.com/zricethezav/gitleaks/v6/options"
+	"github.com/zricethezav/gitleaks/v6/version"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/hako/durafmt"
 	"github.com/mattn/go-colorable"
 	log "github.com/sirupsen/logrus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const maxLineLen = 200
@@ -33,35 +42,173 @@ type Manager struct {
 	CloneOptions *git.CloneOptions
 	CloneDir     string
 
+	// HTTPClient is used for cloning over http(s) and host api calls. It is nil unless
+	// --proxy, --ca-cert or --client-cert are set.
+	HTTPClient *http.Client
+
+	// Tracer starts the spans of the scan stages, exported with --otlp-endpoint. It is a no-op
+	// tracer if tracing is disabled.
+	Tracer         trace.Tracer
+	tracerProvider *sdktrace.TracerProvider
+
+	// Scorer scores the risk of leaks with --score and Verifier, if set, tells whether their secrets are live
+	Scorer   Scorer
+	Verifier Verifier
+
+	// leakFilters are the filters added with AddLeakFilter
+	leakFilters []LeakFilter
+
+	// triage holds the verdicts of triaged leaks with --triage-store and suppressed the false positives reported
+	// as suppressed with --sarif-suppressions
+	triage     *TriageStore
+	suppressed []Leak
+
+	// pairParts holds the leaks of the rules of the credential pairs of the config, paired once all leaks are
+	// received
+	pairParts []Leak
+	pairOnce  sync.Once
+
 	leaks     []Leak
 	leakChan  chan Leak
 	leakWG    *sync.WaitGroup
 	leakCache map[string]bool
 
+	// leakCount and failingCount count the leaks received and the leaks failing the scan, stream is set
+	// with --report-batch-size and writes leaks to the report instead of keeping them in leaks
+	leakCount    int
+	failingCount int
+	stream       *reportStream
+
 	stopChan chan os.Signal
 	metadata Metadata
 	metaWG   *sync.WaitGroup
+
+	cloneErrors   []CloneError
+	cloneErrorMux sync.Mutex
+
+	// afterReport are the functions run by Report once the leaks are reported
+	afterReport    []func() error
+	afterReportMux sync.Mutex
+
+	// events receives leaks to publish with --kafka-brokers or --nats-url, publishEvents reports
+	// the outcome on eventsDone once events is closed
+	events     chan Leak
+	eventsDone chan error
+
+	startTime time.Time
+
+	// location is the timezone of --report-timezone the dates of leaks are converted to, nil keeps the
+	// timezone of their commit
+	location *time.Location
+
+	// reportKeys are the public keys reports are encrypted to with --encrypt-report, signingKey is the key
+	// reports are signed with by --sign-report
+	reportKeys openpgp.EntityList
+	signingKey *openpgp.Entity
+
+	// scannedBytes counts the content scanned for --max-total-bytes and findings the leaks received for
+	// --max-findings. stopReason is set by Stop.
+	scannedBytes int64
+	findings     int
+	stopReason   atomic.Value
+	stopOnce     sync.Once
+}
+
+// CloneError is a repo of a host scan that could not be cloned and was skipped
+type CloneError struct {
+	Repo  string `json:"repo"`
+	Error string `json:"error"`
 }
 
 // Leak is a struct that contains information about some line of code that contains
-// sensitive information as determined by the rules set in a gitleaks config
+// sensitive information as determined by the rules set in a gitleaks config.
+// Entropy is the shannon entropy of the offender and MatchStart and MatchEnd are the byte offsets
+// of the offender in Line, before long lines are truncated.
 type Leak struct {
 	Line       string    `json:"line"`
 	LineNumber int       `json:"lineNumber"`
 	Offender   string    `json:"offender"`
+	Entropy    float64   `json:"entropy"`
+	MatchStart int       `json:"matchStart"`
+	MatchEnd   int       `json:"matchEnd"`
 	Commit     string    `json:"commit"`
 	Repo       string    `json:"repo"`
 	Rule       string    `json:"rule"`
+	RuleID     string    `json:"ruleID,omitempty"`
+	RuleRegex  string    `json:"ruleRegex"`
 	Message    string    `json:"commitMessage"`
 	Author     string    `json:"author"`
 	Email      string    `json:"email"`
 	File       string    `json:"file"`
+	OldFile    string    `json:"oldFile,omitempty"`
 	Date       time.Time `json:"date"`
 	Tags       string    `json:"tags"`
 	Operation  string    `json:"operation"`
 	lookupHash string
+
+	// secretHash identifies the secret of the leak once its offender is redacted
+	secretHash string
+
+	// partOffenders are the offenders of the parts of the leaks of credential pairs, redacted one by one
+	partOffenders []string
+
+	// MergeParent is set for leaks found in merge commits with --merges=all-parents and holds the parent the merge was diffed against
+	MergeParent string `json:"mergeParent,omitempty"`
+
+	// DiffHeader and HunkHeader are set for leaks found in patches with --patch-context. DiffHeader holds
+	// the lines of the patch before the first hunk of the file, like its paths and modes, and HunkHeader
+	// the @@ line of the hunk containing the leak. Hunk holds the line of the leak and up to three lines of
+	// its hunk before and after it, prefixed by + and - like in the patch.
+	DiffHeader string `json:"diffHeader,omitempty"`
+	HunkHeader string `json:"hunkHeader,omitempty"`
+	Hunk       string `json:"hunk,omitempty"`
+
+	// Groups holds the values of the named groups of the rule's regex, like the user and host of a connection
+	// string whose password is the offender, or the fields its parser parsed from the match. The groups of the
+	// leaks of credential pairs hold the offenders of the parts of the pair by their rule.
+	Groups map[string]string `json:"groups,omitempty"`
+
+	// URL links to the file and line of the leak at its commit when the repo's origin is on github, gitlab
+	// or bitbucket
+	URL string `json:"url,omitempty"`
+
+	// RemoteURL is the url of the origin of the repo of the leak, without credentials, and DefaultBranch the
+	// default branch of the origin. They are empty for repos without an origin.
+	RemoteURL     string `json:"remoteURL,omitempty"`
+	DefaultBranch string `json:"defaultBranch,omitempty"`
+
+	// ReportOnly is set for leaks of rules marked report-only, which are reported but don't fail the scan
+	ReportOnly bool `json:"reportOnly,omitempty"`
+
+	// Severity is the severity of the rule, if the rule sets one
+	Severity string `json:"severity,omitempty"`
+
+	// Signature is how the commit of the leak was signed, gpg, ssh or x509, and SigningKey the id of the gpg key
+	// or the fingerprint of the ssh key it was signed with. Signatures aren't verified, `git verify-commit`
+	// tells whether the key is trusted.
+	Signature  string `json:"signature,omitempty"`
+	SigningKey string `json:"signingKey,omitempty"`
+
+	// AtHead is set with --score for leaks whose secret is still in their file at the HEAD of the repo, and
+	// Score is the risk of the leak scored by the Scorer of the manager
+	AtHead bool    `json:"atHead,omitempty"`
+	Score  float64 `json:"score,omitempty"`
+
+	// Fingerprint is set with --triage-store and identifies the leak to `gitleaks mark`, Verdict is the verdict
+	// it was marked with
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Verdict     string `json:"verdict,omitempty"`
+
+	// Category is CategoryRemovedNotRotated for leaks found in lines removed by their commit, with
+	// --include-deletion, and IntroducedCommit the commit that added the line
+	Category         string `json:"category,omitempty"`
+	IntroducedCommit string `json:"introducedCommit,omitempty"`
 }
 
+// CategoryRemovedNotRotated is the category of leaks in removed lines. Deleting a secret doesn't revoke it, it's
+// still in the history of the repo until it's rotated.
+const CategoryRemovedNotRotated = "removed-not-rotated"
+
 // ScanTime is a type used to determine total scan time
 type ScanTime int64
 
@@ -86,11 +233,29 @@ type Metadata struct {
 
 	timings chan interface{}
 
+	// regexTimes holds the time spent matching each regex, by regex, as an *int64 added to atomically. The
+	// workers checking rules record a time per rule and bundle, sending them on timings contends at high
+	// thread counts.
+	regexTimes *sync.Map
+
 	RegexTime map[string]int64
 	Commits   int
 	ScanTime  int64
 	patchTime int64
 	cloneTime int64
+
+	// RepoCommits holds the number of commits scanned per repo
+	RepoCommits map[string]int
+
+	// SampledOut counts the commits left out of the scan by --sample
+	SampledOut int
+
+	// RepoHeads holds the commit the history of each repo was walked from
+	RepoHeads map[string]string
+
+	// Skipped counts the files skipped instead of scanned by the reason they were skipped for: extension,
+	// binary or the kind of --skip-mime. Files of patches are counted once per commit they are changed in.
+	Skipped map[string]int
 }
 
 func init() {
@@ -113,10 +278,53 @@ func NewManager(opts options.Options, cfg config.Config) (*Manager, error) {
 		return nil, err
 	}
 
+	httpClient, err := opts.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		// go-git's transports are global, every clone in this process goes through the client
+		client.InstallProtocol("https", githttp.NewClient(httpClient))
+		client.InstallProtocol("http", githttp.NewClient(httpClient))
+	}
+
+	reportKeys, err := opts.ReportKeys()
+	if err != nil {
+		return nil, err
+	}
+	signingKey, err := opts.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	location, err := opts.ReportLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	tracerProvider, err := newTracerProvider(opts, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	var tracer trace.Tracer
+	if tracerProvider != nil {
+		tracer = tracerProvider.Tracer(tracerName, trace.WithInstrumentationVersion(version.Version))
+	} else {
+		tracer = trace.NewNoopTracerProvider().Tracer(tracerName)
+	}
+
 	m := &Manager{
 		Opts:         opts,
 		Config:       cfg,
 		CloneOptions: cloneOpts,
+		HTTPClient:   httpClient,
+		Tracer:       tracer,
+		Scorer:       DefaultScorer{},
+		startTime:    time.Now(),
+
+		location:       location,
+		tracerProvider: tracerProvider,
+		reportKeys:     reportKeys,
+		signingKey:     signingKey,
 
 		stopChan:  make(chan os.Signal, 1),
 		leakChan:  make(chan Leak),
@@ -124,13 +332,39 @@ func NewManager(opts options.Options, cfg config.Config) (*Manager, error) {
 		leakCache: make(map[string]bool),
 		metaWG:    &sync.WaitGroup{},
 		metadata: Metadata{
-			RegexTime: make(map[string]int64),
-			timings:   make(chan interface{}),
-			data:      make(map[string]interface{}),
-			mux:       new(sync.Mutex),
+			RepoCommits: make(map[string]int),
+			RepoHeads:   make(map[string]string),
+			Skipped:     make(map[string]int),
+			timings:     make(chan interface{}),
+			regexTimes:  new(sync.Map),
+			data:        make(map[string]interface{}),
+			mux:         new(sync.Mutex),
 		},
 	}
 
+	if opts.ReportBatch > 0 {
+		// only the built-in writers of the formats can write batches
+		if isRegistered(opts.ReportFormat) {
+			return nil, fmt.Errorf("--report-format=%s can't be written in batches, its writer is registered by the application", opts.ReportFormat)
+		}
+		m.stream = &reportStream{now: time.Now()}
+	}
+	if opts.TriageStore != "" {
+		if m.triage, err = LoadTriageStore(opts.TriageStore); err != nil {
+			return nil, err
+		}
+	}
+
+	publisher, err := newEventPublisher(opts, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to event broker: %v", err)
+	}
+	if publisher != nil {
+		m.events = make(chan Leak, eventQueueSize)
+		m.eventsDone = make(chan error, 1)
+		go m.publishEvents(publisher)
+	}
+
 	signal.Notify(m.stopChan, os.Interrupt)
 
 	// start receiving leaks and metadata
@@ -141,33 +375,111 @@ func NewManager(opts options.Options, cfg config.Config) (*Manager, error) {
 	return m, nil
 }
 
-// GetLeaks returns all available leaks
+// GetLeaks returns all available leaks. Leaks written to the report in batches with --report-batch-size aren't
+// kept, use LeakCount and FailingLeakCount to count them.
 func (manager *Manager) GetLeaks() []Leak {
 	// need to wait for any straggling leaks
-	manager.leakWG.Wait()
+	manager.waitForLeaks()
+	sortLeaks(manager.leaks, manager.Opts.Sort)
 	return manager.leaks
 }
 
+// GetFailingLeaks returns the leaks that fail the scan, leaving out the leaks of report-only rules
+func (manager *Manager) GetFailingLeaks() []Leak {
+	var failing []Leak
+	for _, leak := range manager.GetLeaks() {
+		if !leak.ReportOnly {
+			failing = append(failing, leak)
+		}
+	}
+	return failing
+}
+
+// LeakCount returns the number of leaks found
+func (manager *Manager) LeakCount() int {
+	manager.waitForLeaks()
+	return manager.leakCount
+}
+
+// FailingLeakCount returns the number of leaks that fail the scan, leaving out the leaks of report-only rules
+func (manager *Manager) FailingLeakCount() int {
+	manager.waitForLeaks()
+	return manager.failingCount
+}
+
+// RecordCloneError records a repo that could not be cloned. Host scans skip such repos and carry on,
+// the errors are listed in the report at the end of the scan.
+func (manager *Manager) RecordCloneError(repo string, err error) {
+	manager.cloneErrorMux.Lock()
+	defer manager.cloneErrorMux.Unlock()
+	manager.cloneErrors = append(manager.cloneErrors, CloneError{Repo: repo, Error: err.Error()})
+}
+
+// GetCloneErrors returns the repos that could not be cloned
+func (manager *Manager) GetCloneErrors() []CloneError {
+	manager.cloneErrorMux.Lock()
+	defer manager.cloneErrorMux.Unlock()
+	return append([]CloneError(nil), manager.cloneErrors...)
+}
+
 // SendLeaks accepts a leak and is used by the scan pkg. This is the public function
 // that allows other packages to send leaks to the manager.
 func (manager *Manager) SendLeaks(l Leak) {
+	l.File, l.OldFile = config.NormalizePath(l.File), config.NormalizePath(l.OldFile)
+	if manager.location != nil && !l.Date.IsZero() {
+		l.Date = l.Date.In(manager.location)
+	}
+	l.lookupHash = lookupHash(l)
+	l.secretHash = secretHash(l.Offender)
+	if manager.triage != nil {
+		// leaks are fingerprinted by their secret, before it's redacted
+		l.Fingerprint = manager.triage.fingerprint(leakRuleID(l), l.File, l.Offender)
+	}
+	if manager.Opts.Redact {
+		// secrets are redacted before lines are cut short, which could cut them in two and leave a part
+		l = redactLeak(l)
+	}
 	if len(l.Line) > maxLineLen {
 		l.Line = l.Line[0:maxLineLen-1] + "..."
 	}
 	if len(l.Offender) > maxLineLen {
 		l.Offender = l.Offender[0:maxLineLen-1] + "..."
 	}
-	h := sha1.New()
-	h.Write([]byte(l.Commit + l.Offender + l.File + l.Line + fmt.Sprint(l.LineNumber)))
-	l.lookupHash = hex.EncodeToString(h.Sum(nil))
-	if manager.Opts.Redact {
-		l.Line = strings.ReplaceAll(l.Line, l.Offender, "REDACTED")
-		l.Offender = "REDACTED"
+	if manager.Opts.Anonymize {
+		anonymizeAuthor(&l)
 	}
 	manager.leakWG.Add(1)
 	manager.leakChan <- l
 }
 
+// keyPool holds the buffers used to build the keys hashed by lookupHash
+var keyPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// lookupHash returns the hash used to deduplicate leaks found more than once
+func lookupHash(l Leak) string {
+	key := keyPool.Get().(*bytes.Buffer)
+	defer keyPool.Put(key)
+	key.Reset()
+	key.WriteString(l.Commit)
+	key.WriteString(l.Offender)
+	key.WriteString(l.File)
+	key.WriteString(l.Line)
+	key.WriteString(strconv.Itoa(l.LineNumber))
+	key.WriteString(l.MergeParent)
+	// leaks of rules without an id keep the fingerprints they had before rules had ids
+	key.WriteString(l.RuleID)
+	sum := sha1.Sum(key.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+// secretHash returns the hash of a secret leaks are grouped by when their offenders may be redacted
+func secretHash(secret string) string {
+	sum := sha1.Sum([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
 func (manager *Manager) alreadySeen(leak Leak) bool {
 	if _, ok := manager.leakCache[leak.lookupHash]; ok {
 		return true
@@ -181,28 +493,55 @@ func (manager *Manager) alreadySeen(leak Leak) bool {
 // json and printed out.
 func (manager *Manager) receiveLeaks() {
 	for leak := range manager.leakChan {
-		if manager.alreadySeen(leak) {
-			manager.leakWG.Done()
-			continue
+		if !manager.alreadySeen(leak) && !manager.collectPairPart(leak) {
+			manager.addLeak(leak)
 		}
+		manager.leakWG.Done()
+	}
+}
+
+// addLeak adds leak to the leaks of the scan
+func (manager *Manager) addLeak(leak Leak) {
+	leak, ok := manager.filterLeak(leak)
+	if !ok || (manager.triage != nil && !manager.applyVerdict(&leak)) || !manager.countFinding(leak) {
+		return
+	}
+	if manager.Opts.Score {
+		manager.scoreLeak(&leak)
+	}
+	manager.leakCount++
+	if !leak.ReportOnly {
+		manager.failingCount++
+	}
+	if manager.stream != nil {
+		manager.streamLeak(leak)
+	} else {
 		manager.leaks = append(manager.leaks, leak)
-		if manager.Opts.Verbose {
-			var b []byte
-			if manager.Opts.PrettyPrint {
-				b, _ = json.MarshalIndent(leak, "", "	")
-			} else {
-				b, _ = json.Marshal(leak)
-			}
-			fmt.Println(string(b))
+	}
+	if manager.events != nil {
+		if manager.Opts.RedactReports {
+			manager.events <- redactLeak(leak)
+		} else {
+			manager.events <- leak
 		}
-		manager.leakWG.Done()
+	}
+	if manager.Opts.Verbose {
+		var b []byte
+		if manager.Opts.PrettyPrint {
+			b, _ = json.MarshalIndent(leak, "", "	")
+		} else {
+			b, _ = json.Marshal(leak)
+		}
+		fmt.Println(string(b))
 	}
 }
 
 // GetMetadata returns the metadata. TODO this may not need to be private
 func (manager *Manager) GetMetadata() Metadata {
 	manager.metaWG.Wait()
-	return manager.metadata
+	metadata := manager.metadata
+	metadata.RegexTime = manager.regexTimes()
+	return metadata
 }
 
 // receiveMetadata is where the messages sent to the metadata channel get consumed. You can view metadata
@@ -217,8 +556,6 @@ func (manager *Manager) receiveMetadata() {
 			manager.metadata.ScanTime += int64(ti)
 		case PatchTime:
 			manager.metadata.patchTime += int64(ti)
-		case RegexTime:
-			manager.metadata.RegexTime[ti.Regex] = manager.metadata.RegexTime[ti.Regex] + ti.Time
 		}
 		manager.metaWG.Done()
 	}
@@ -231,12 +568,64 @@ func (manager *Manager) IncrementCommits(i int) {
 	manager.metadata.mux.Unlock()
 }
 
-// RecordTime accepts an interface and sends it to the manager's time channel
+// IncrementRepoCommits increments the commits scanned in repo, and the total commits of the scan, by i
+func (manager *Manager) IncrementRepoCommits(repo string, i int) {
+	manager.metadata.mux.Lock()
+	manager.metadata.Commits += i
+	manager.metadata.RepoCommits[repo] += i
+	manager.metadata.mux.Unlock()
+}
+
+// IncrementSampledOut increments the commits left out of the scan by --sample by i
+func (manager *Manager) IncrementSampledOut(i int) {
+	manager.metadata.mux.Lock()
+	manager.metadata.SampledOut += i
+	manager.metadata.mux.Unlock()
+}
+
+// IncrementSkippedFiles counts a file skipped instead of scanned for reason
+func (manager *Manager) IncrementSkippedFiles(reason string) {
+	manager.metadata.mux.Lock()
+	manager.metadata.Skipped[reason]++
+	manager.metadata.mux.Unlock()
+}
+
+// SkippedFiles returns the number of files skipped instead of scanned by the reason they were skipped for
+func (manager *Manager) SkippedFiles() map[string]int {
+	manager.metadata.mux.Lock()
+	defer manager.metadata.mux.Unlock()
+	skipped := make(map[string]int, len(manager.metadata.Skipped))
+	for reason, n := range manager.metadata.Skipped {
+		skipped[reason] = n
+	}
+	return skipped
+}
+
+// RecordTime accepts an interface and sends it to the manager's time channel. Regex times are added to their
+// totals right away.
 func (manager *Manager) RecordTime(t interface{}) {
+	if ti, ok := t.(RegexTime); ok {
+		total, loaded := manager.metadata.regexTimes.Load(ti.Regex)
+		if !loaded {
+			total, _ = manager.metadata.regexTimes.LoadOrStore(ti.Regex, new(int64))
+		}
+		atomic.AddInt64(total.(*int64), ti.Time)
+		return
+	}
 	manager.metaWG.Add(1)
 	manager.metadata.timings <- t
 }
 
+// regexTimes returns the time spent matching each regex, by regex
+func (manager *Manager) regexTimes() map[string]int64 {
+	times := make(map[string]int64)
+	manager.metadata.regexTimes.Range(func(regex, total interface{}) bool {
+		times[regex.(string)] = atomic.LoadInt64(total.(*int64))
+		return true
+	})
+	return times
+}
+
 // DebugOutput logs metadata and other messages that occurred during a gitleaks scan
 func (manager *Manager) DebugOutput() {
 	log.Debugf("-------------------------\n")
@@ -253,7 +642,7 @@ func (manager *Manager) DebugOutput() {
 	log.Debugf("--------------------------\n")
 	log.Debugf("| Individual Regexes Times |\n")
 	log.Debugf("--------------------------\n")
-	for k, v := range manager.metadata.RegexTime {
+	for k, v := range manager.regexTimes() {
 		_, _ = fmt.Fprintf(w, "%s\t%s\n", k, durafmt.Parse(time.Duration(v)*time.Nanosecond))
 	}
 	_ = w.Flush()
@@ -0,0 +1,230 @@
+package manager
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/version"
+)
+
+const defaultNATSPort = "4222"
+
+// natsPublisher publishes leak events to a nats subject. Only publishing is needed, which takes a handful
+// of commands of the nats text protocol: CONNECT once, PUB for every event and PING to wait for the
+// server to have processed what was sent. The server's PINGs are answered so long scans aren't
+// disconnected as stale.
+type natsPublisher struct {
+	subject string
+
+	conn net.Conn
+	mu   sync.Mutex
+	w    *bufio.Writer
+
+	pongs chan struct{}
+
+	errMu sync.Mutex
+	err   error
+}
+
+// dialNATS connects to the nats server at rawURL, nats://[user:password@|token@]host[:port]. tls:// urls, and
+// servers requiring tls, connect with tls, trusting the roots of tlsConfig if it's set.
+func dialNATS(rawURL, subject string, tlsConfig *tls.Config) (*natsPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("unsupported nats url scheme %q, must be nats or tls", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultNATSPort)
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.Dial("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	// the server greets with its INFO in plain text, the connection is upgraded to tls after it
+	r := bufio.NewReader(conn)
+	greeting, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected nats greeting %q", strings.TrimSpace(greeting))
+	}
+	var info struct {
+		TLSRequired  bool `json:"tls_required"`
+		TLSAvailable bool `json:"tls_available"`
+	}
+	if err := json.Unmarshal([]byte(greeting[len("INFO "):]), &info); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to parse the nats server info: %v", err)
+	}
+	if u.Scheme == "tls" || info.TLSRequired {
+		if !info.TLSRequired && !info.TLSAvailable {
+			conn.Close()
+			return nil, fmt.Errorf("nats server %s doesn't support tls", host)
+		}
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		config.ServerName = u.Hostname()
+		tlsConn := tls.Client(conn, config)
+		tlsConn.SetDeadline(time.Now().Add(10 * time.Second))
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("nats tls handshake: %v", err)
+		}
+		tlsConn.SetDeadline(time.Time{})
+		conn, r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	connect := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "gitleaks",
+		"lang":     "go",
+		"version":  version.Version,
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			connect["user"] = u.User.Username()
+			connect["pass"] = password
+		} else {
+			connect["auth_token"] = u.User.Username()
+		}
+	}
+	connectJSON, err := json.Marshal(connect)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	p := &natsPublisher{
+		subject: subject,
+		conn:    conn,
+		w:       bufio.NewWriter(conn),
+		pongs:   make(chan struct{}, 1),
+	}
+	go p.read(r)
+
+	p.mu.Lock()
+	_, err = fmt.Fprintf(p.w, "CONNECT %s\r\n", connectJSON)
+	p.mu.Unlock()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// authentication errors are only reported after the CONNECT
+	if err := p.flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// read handles the commands sent by the server
+func (p *natsPublisher) read(r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			p.setErr(err)
+			close(p.pongs)
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			p.mu.Lock()
+			p.w.WriteString("PONG\r\n")
+			err := p.w.Flush()
+			p.mu.Unlock()
+			if err != nil {
+				p.setErr(err)
+			}
+		case strings.HasPrefix(line, "PONG"):
+			p.pongs <- struct{}{}
+		case strings.HasPrefix(line, "-ERR"):
+			p.setErr(fmt.Errorf("nats: %s", strings.Trim(strings.TrimSpace(line[4:]), "'")))
+		}
+	}
+}
+
+func (p *natsPublisher) publish(events []event) error {
+	if err := p.error(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	for _, e := range events {
+		if _, err := fmt.Fprintf(p.w, "PUB %s %d\r\n%s\r\n", p.subject, len(e.value), e.value); err != nil {
+			p.mu.Unlock()
+			return err
+		}
+	}
+	p.mu.Unlock()
+	return p.flush()
+}
+
+// flush sends a PING and waits for the server's PONG, by which time all commands sent before were processed
+func (p *natsPublisher) flush() error {
+	p.mu.Lock()
+	p.w.WriteString("PING\r\n")
+	err := p.w.Flush()
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-p.pongs:
+	case <-time.After(10 * time.Second):
+		return fmt.Errorf("nats: timed out waiting for the server")
+	}
+	return p.error()
+}
+
+// error returns the first error of the connection, like an -ERR of the server or the connection closing
+func (p *natsPublisher) error() error {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	return p.err
+}
+
+func (p *natsPublisher) setErr(err error) {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// clientTLSConfig returns a copy of the tls config of client, set by --ca-cert and --client-cert, or nil if
+// client is the default client
+func clientTLSConfig(client *http.Client) *tls.Config {
+	if client == nil {
+		return nil
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport.TLSClientConfig == nil {
+		return nil
+	}
+	return transport.TLSClientConfig.Clone()
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,44 @@
+package manager
+
+import "time"
+
+// uniqueLeak is a leak of v2 json reports (--report-schema=v2). A secret found more than once in the same file
+// of a repo by the same rule is reported once, with the fields of its first occurrence, and lists where it
+// occurs in Occurrences.
+type uniqueLeak struct {
+	Leak
+	Occurrences []occurrence `json:"occurrences"`
+}
+
+// occurrence is a commit and line a unique leak was found at
+type occurrence struct {
+	Commit     string    `json:"commit"`
+	LineNumber int       `json:"lineNumber"`
+	Date       time.Time `json:"date"`
+}
+
+// uniqueLeaks gathers the occurrences of leaks into unique leaks, in the order of their first occurrence in leaks
+func uniqueLeaks(leaks []Leak) []uniqueLeak {
+	type key struct {
+		repo, file, rule, secret string
+	}
+	unique := []uniqueLeak{}
+	index := make(map[key]int)
+	for _, leak := range leaks {
+		// the offenders of leaks may be redacted, their secrets are told apart by the hash of their secret
+		secret := leak.secretHash
+		if secret == "" {
+			secret = secretHash(leak.Offender)
+		}
+		k := key{repo: leak.Repo, file: leak.File, rule: leakRuleID(leak), secret: secret}
+		i, ok := index[k]
+		if !ok {
+			i = len(unique)
+			index[k] = i
+			unique = append(unique, uniqueLeak{Leak: leak})
+		}
+		unique[i].Occurrences = append(unique[i].Occurrences,
+			occurrence{Commit: leak.Commit, LineNumber: leak.LineNumber, Date: leak.Date})
+	}
+	return unique
+}
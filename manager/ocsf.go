@@ -0,0 +1,208 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/version"
+)
+
+// ocsfFinding is a leak as an OCSF Detection Finding event, written with --report-format=ocsf
+// See https://schema.ocsf.io/1.1.0/classes/detection_finding
+type ocsfFinding struct {
+	ActivityID   int    `json:"activity_id"`
+	ActivityName string `json:"activity_name"`
+	CategoryUID  int    `json:"category_uid"`
+	CategoryName string `json:"category_name"`
+	ClassUID     int    `json:"class_uid"`
+	ClassName    string `json:"class_name"`
+	TypeUID      int    `json:"type_uid"`
+	TypeName     string `json:"type_name"`
+	SeverityID   int    `json:"severity_id"`
+	Severity     string `json:"severity"`
+	StatusID     int    `json:"status_id"`
+	Status       string `json:"status"`
+	Time         int64  `json:"time"`
+	Message      string `json:"message"`
+
+	Metadata    ocsfMetadata      `json:"metadata"`
+	FindingInfo ocsfFindingInfo   `json:"finding_info"`
+	Resources   []ocsfResource    `json:"resources"`
+	Unmapped    map[string]string `json:"unmapped"`
+}
+
+// ocsfScanActivity is the OCSF Scan Activity event of a scan stopped early, as the cancel activity of the
+// scan, which is added to the events of the report so the findings aren't taken for all there is
+// See https://schema.ocsf.io/1.1.0/classes/scan_activity
+type ocsfScanActivity struct {
+	ActivityID   int    `json:"activity_id"`
+	ActivityName string `json:"activity_name"`
+	CategoryUID  int    `json:"category_uid"`
+	CategoryName string `json:"category_name"`
+	ClassUID     int    `json:"class_uid"`
+	ClassName    string `json:"class_name"`
+	TypeUID      int    `json:"type_uid"`
+	TypeName     string `json:"type_name"`
+	SeverityID   int    `json:"severity_id"`
+	Severity     string `json:"severity"`
+	Time         int64  `json:"time"`
+	Message      string `json:"message"`
+
+	Metadata ocsfMetadata `json:"metadata"`
+	Scan     ocsfScan     `json:"scan"`
+}
+
+type ocsfScan struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	TypeID int    `json:"type_id"`
+}
+
+type ocsfMetadata struct {
+	Version string      `json:"version"`
+	Product ocsfProduct `json:"product"`
+}
+
+type ocsfProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+	Version    string `json:"version,omitempty"`
+}
+
+type ocsfFindingInfo struct {
+	UID         string   `json:"uid"`
+	Title       string   `json:"title"`
+	Desc        string   `json:"desc"`
+	Types       []string `json:"types"`
+	CreatedTime int64    `json:"created_time,omitempty"`
+	SrcURL      string   `json:"src_url,omitempty"`
+}
+
+type ocsfResource struct {
+	Name  string            `json:"name"`
+	Type  string            `json:"type"`
+	Group *ocsfGroup        `json:"group,omitempty"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+type ocsfGroup struct {
+	Name string `json:"name"`
+}
+
+// the ids of the OCSF Detection Finding class, of the Create activity of a new finding
+const (
+	ocsfVersion          = "1.1.0"
+	ocsfCategoryFindings = 2
+	ocsfClassDetection   = 2004
+	ocsfActivityCreate   = 1
+	ocsfStatusNew        = 1
+)
+
+// the ids of the OCSF Scan Activity class, of the Cancelled activity of a scan stopped early
+const (
+	ocsfCategoryApplication = 6
+	ocsfClassScan           = 6007
+	ocsfActivityCancelled   = 3
+	ocsfScanTypeOther       = 99
+)
+
+// ocsfSeverityIDs maps the severities of rules to the severity ids of OCSF
+var ocsfSeverityIDs = map[string]int{
+	"info":     1,
+	"low":      2,
+	"medium":   3,
+	"high":     4,
+	"critical": 5,
+}
+
+// writeOCSF writes the leaks of the scan as a json array of OCSF Detection Finding events to w, followed by a
+// Scan Activity event if the scan was stopped early
+func (manager *Manager) writeOCSF(w io.Writer) error {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	events := []interface{}{}
+	for _, leak := range manager.reportLeaks() {
+		severity := leakSeverity(leak)
+		finding := ocsfFinding{
+			ActivityID:   ocsfActivityCreate,
+			ActivityName: "Create",
+			CategoryUID:  ocsfCategoryFindings,
+			CategoryName: "Findings",
+			ClassUID:     ocsfClassDetection,
+			ClassName:    "Detection Finding",
+			TypeUID:      ocsfClassDetection*100 + ocsfActivityCreate,
+			TypeName:     "Detection Finding: Create",
+			SeverityID:   ocsfSeverityIDs[severity],
+			Severity:     ocsfSeverityName(severity),
+			StatusID:     ocsfStatusNew,
+			Status:       "New",
+			Time:         now,
+			Message:      fmt.Sprintf("%s secret detected in %s", leak.Rule, leak.File),
+			Metadata: ocsfMetadata{
+				Version: ocsfVersion,
+				Product: ocsfProduct{Name: "Gitleaks", VendorName: "Gitleaks", Version: version.Version},
+			},
+			FindingInfo: ocsfFindingInfo{
+				UID:    leak.lookupHash,
+				Title:  fmt.Sprintf("%s in %s", leak.Rule, leak.File),
+				Desc:   fmt.Sprintf("%s secret detected in commit %s", leak.Rule, leak.Commit),
+				Types:  []string{leak.Rule},
+				SrcURL: leak.URL,
+			},
+			Resources: []ocsfResource{{
+				Name: leak.File,
+				Type: "File",
+				Data: map[string]string{"line_number": fmt.Sprint(leak.LineNumber), "commit": leak.Commit},
+			}},
+			Unmapped: map[string]string{
+				"offender":  leak.Offender,
+				"line":      leak.Line,
+				"author":    leak.Author,
+				"email":     leak.Email,
+				"tags":      leak.Tags,
+				"operation": leak.Operation,
+			},
+		}
+		if !leak.Date.IsZero() {
+			finding.FindingInfo.CreatedTime = leak.Date.UnixNano() / int64(time.Millisecond)
+		}
+		if leak.Repo != "" {
+			finding.Resources[0].Group = &ocsfGroup{Name: leak.Repo}
+		}
+		events = append(events, finding)
+	}
+	if notice := manager.stopNotice(); notice != "" {
+		events = append(events, ocsfScanActivity{
+			ActivityID:   ocsfActivityCancelled,
+			ActivityName: "Cancelled",
+			CategoryUID:  ocsfCategoryApplication,
+			CategoryName: "Application Activity",
+			ClassUID:     ocsfClassScan,
+			ClassName:    "Scan Activity",
+			TypeUID:      ocsfClassScan*100 + ocsfActivityCancelled,
+			TypeName:     "Scan Activity: Cancelled",
+			SeverityID:   ocsfSeverityIDs["medium"],
+			Severity:     ocsfSeverityName("medium"),
+			Time:         now,
+			Message:      notice,
+			Metadata: ocsfMetadata{
+				Version: ocsfVersion,
+				Product: ocsfProduct{Name: "Gitleaks", VendorName: "Gitleaks", Version: version.Version},
+			},
+			Scan: ocsfScan{Name: "Gitleaks", Type: "Other", TypeID: ocsfScanTypeOther},
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(events)
+}
+
+// ocsfSeverityName returns the OCSF name of severity
+func ocsfSeverityName(severity string) string {
+	if severity == "info" {
+		return "Informational"
+	}
+	return strings.Title(severity)
+}
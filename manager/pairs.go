@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"math"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+)
+
+// waitForLeaks waits for the leaks of the scan to be received, then adds the leaks of the credential pairs they
+// form
+func (manager *Manager) waitForLeaks() {
+	manager.leakWG.Wait()
+	manager.pairOnce.Do(manager.pairLeaks)
+}
+
+// collectPairPart keeps leak if it's a part of a credential pair of the config, returning true if its rule is
+// pair-only and the leak isn't reported on its own
+func (manager *Manager) collectPairPart(leak Leak) bool {
+	part := false
+	for _, pair := range manager.Config.Pairs {
+		if pairPart(pair, leak) >= 0 {
+			part = true
+			break
+		}
+	}
+	if !part {
+		return false
+	}
+	manager.pairParts = append(manager.pairParts, leak)
+	for _, rule := range manager.Config.Rules {
+		if rule.PairOnly && ((rule.ID != "" && rule.ID == leak.RuleID) || rule.Description == leak.Rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// pairPart returns the index of the rule of leak in the rules of pair, or -1 if leak isn't a part of pair
+func pairPart(pair config.Pair, leak Leak) int {
+	for i, rule := range pair.Rules {
+		if (leak.RuleID != "" && rule == leak.RuleID) || rule == leak.Rule {
+			return i
+		}
+	}
+	return -1
+}
+
+// pairLeaks adds a leak of each credential pair formed by the leaks of its rules in the same commit. Each leak of
+// the first rule of a pair is paired with the nearest leaks of the other rules.
+func (manager *Manager) pairLeaks() {
+	sortLeaks(manager.pairParts, "")
+	for _, pair := range manager.Config.Pairs {
+		// the parts of the pair in each commit, by their rule
+		commits := make(map[string][][]Leak)
+		var order []string
+		for _, leak := range manager.pairParts {
+			i := pairPart(pair, leak)
+			if i < 0 {
+				continue
+			}
+			key := leak.Repo + "\x00" + leak.Commit
+			if _, ok := commits[key]; !ok {
+				commits[key] = make([][]Leak, len(pair.Rules))
+				order = append(order, key)
+			}
+			commits[key][i] = append(commits[key][i], leak)
+		}
+
+		for _, key := range order {
+			parts := commits[key]
+			for _, first := range parts[0] {
+				paired := []Leak{first}
+				for _, candidates := range parts[1:] {
+					nearest, ok := nearestPart(first, candidates, pair.MaxLines)
+					if !ok {
+						break
+					}
+					paired = append(paired, nearest)
+				}
+				if len(paired) == len(pair.Rules) {
+					leak := pairLeak(pair, paired)
+					if manager.triage != nil {
+						// the parts may be redacted already, pairs are fingerprinted by the hash of their secret
+						leak.Fingerprint = manager.triage.fingerprint(leakRuleID(leak), leak.File, leak.secretHash)
+					}
+					manager.addLeak(leak)
+				}
+			}
+		}
+	}
+}
+
+// nearestPart returns the leak of candidates nearest to leak, in the same file first, and false if none is within
+// maxLines lines of leak in the same file when maxLines is set
+func nearestPart(leak Leak, candidates []Leak, maxLines int) (Leak, bool) {
+	var nearest Leak
+	best := math.MaxInt64
+	for _, candidate := range candidates {
+		distance := math.MaxInt32
+		if candidate.File == leak.File {
+			distance = candidate.LineNumber - leak.LineNumber
+			if distance < 0 {
+				distance = -distance
+			}
+		}
+		if maxLines > 0 && distance > maxLines {
+			continue
+		}
+		if distance < best {
+			nearest, best = candidate, distance
+		}
+	}
+	return nearest, best != math.MaxInt64
+}
+
+// pairSeparator joins the offenders of the parts of a credential pair into the offender of the pair
+const pairSeparator = " + "
+
+// pairLeak returns the leak of pair formed by parts, found where its first part was
+func pairLeak(pair config.Pair, parts []Leak) Leak {
+	leak := parts[0]
+	leak.Rule = pair.Description
+	leak.RuleID = pair.ID
+	leak.RuleRegex = ""
+	leak.Severity = pair.Severity
+	leak.ReportOnly = false
+	leak.Tags = "pair"
+	leak.Score = 0
+	leak.Verdict = ""
+
+	leak.partOffenders = nil
+	leak.Groups = make(map[string]string)
+	var secrets []string
+	for i, part := range parts {
+		leak.partOffenders = append(leak.partOffenders, part.Offender)
+		leak.Groups[pair.Rules[i]] = part.Offender
+		secrets = append(secrets, part.secretHash)
+	}
+	leak.Offender = strings.Join(leak.partOffenders, pairSeparator)
+	// the parts may be redacted already, the pair's secret is that of its parts
+	leak.secretHash = secretHash(strings.Join(secrets, pairSeparator))
+	leak.lookupHash = lookupHash(leak)
+	return leak
+}
@@ -0,0 +1,127 @@
+package manager
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/version"
+
+	// registers the postgres database/sql driver
+	_ "github.com/lib/pq"
+)
+
+// postgresSchema is created in the database set by --postgres-dsn if it doesn't exist yet. Many scans, like
+// the CI jobs of all repos of a company, can write to the same database. Findings are keyed by their
+// fingerprint so a leak found by many scans is a single finding, run_findings records which scan runs
+// found it. Columns added after the first release are added to the findings of older databases.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS scan_runs (
+	id BIGSERIAL PRIMARY KEY,
+	started_at TIMESTAMPTZ NOT NULL,
+	finished_at TIMESTAMPTZ NOT NULL,
+	version TEXT NOT NULL,
+	target TEXT NOT NULL,
+	commits INTEGER NOT NULL,
+	leaks INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS findings (
+	fingerprint TEXT PRIMARY KEY,
+	repo TEXT NOT NULL,
+	rule TEXT NOT NULL,
+	commit_sha TEXT NOT NULL,
+	file TEXT NOT NULL,
+	old_file TEXT NOT NULL,
+	line_number INTEGER NOT NULL,
+	line TEXT NOT NULL,
+	offender TEXT NOT NULL,
+	commit_message TEXT NOT NULL,
+	author TEXT NOT NULL,
+	email TEXT NOT NULL,
+	date TIMESTAMPTZ NOT NULL,
+	tags TEXT NOT NULL,
+	operation TEXT NOT NULL,
+	merge_parent TEXT NOT NULL,
+	first_seen_run BIGINT NOT NULL REFERENCES scan_runs(id),
+	last_seen_run BIGINT NOT NULL REFERENCES scan_runs(id)
+);
+CREATE TABLE IF NOT EXISTS run_findings (
+	run_id BIGINT NOT NULL REFERENCES scan_runs(id),
+	fingerprint TEXT NOT NULL REFERENCES findings(fingerprint),
+	PRIMARY KEY (run_id, fingerprint)
+);
+ALTER TABLE findings ADD COLUMN IF NOT EXISTS entropy DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE findings ADD COLUMN IF NOT EXISTS rule_regex TEXT NOT NULL DEFAULT '';
+ALTER TABLE findings ADD COLUMN IF NOT EXISTS match_start INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE findings ADD COLUMN IF NOT EXISTS match_end INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE findings ADD COLUMN IF NOT EXISTS groups JSONB NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS findings_repo ON findings(repo);
+CREATE INDEX IF NOT EXISTS run_findings_fingerprint ON run_findings(fingerprint);
+`
+
+// writePostgres records the scan run and upserts its leaks into the findings of the postgres database at dsn
+func (manager *Manager) writePostgres(dsn string) error {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(postgresSchema); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	leaks := manager.reportLeaks()
+	metadata := manager.GetMetadata()
+	var runID int64
+	err = tx.QueryRow(`INSERT INTO scan_runs (started_at, finished_at, version, target, commits, leaks)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		manager.startTime, time.Now(), version.Version, manager.Opts.Target(), metadata.Commits, len(leaks)).Scan(&runID)
+	if err != nil {
+		return err
+	}
+
+	upsert, err := tx.Prepare(`INSERT INTO findings (fingerprint, repo, rule, commit_sha, file, old_file, line_number,
+		line, offender, commit_message, author, email, date, tags, operation, merge_parent, first_seen_run, last_seen_run,
+		entropy, rule_regex, match_start, match_end, groups)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $17, $18, $19, $20, $21, $22)
+		ON CONFLICT (fingerprint) DO UPDATE SET last_seen_run = excluded.last_seen_run, rule = excluded.rule,
+		tags = excluded.tags, entropy = excluded.entropy, rule_regex = excluded.rule_regex,
+		match_start = excluded.match_start, match_end = excluded.match_end, groups = excluded.groups`)
+	if err != nil {
+		return err
+	}
+	defer upsert.Close()
+	seen, err := tx.Prepare(`INSERT INTO run_findings (run_id, fingerprint) VALUES ($1, $2) ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer seen.Close()
+
+	for _, leak := range leaks {
+		_, err := upsert.Exec(leak.lookupHash, leak.Repo, leak.Rule, leak.Commit, leak.File, leak.OldFile,
+			leak.LineNumber, leak.Line, leak.Offender, leak.Message, leak.Author, leak.Email, leak.Date,
+			leak.Tags, leak.Operation, leak.MergeParent, runID, leak.Entropy, leak.RuleRegex, leak.MatchStart, leak.MatchEnd,
+			postgresGroups(leak.Groups))
+		if err != nil {
+			return err
+		}
+		if _, err := seen.Exec(runID, leak.lookupHash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// postgresGroups encodes the named groups of a leak for the jsonb groups column
+func postgresGroups(groups map[string]string) string {
+	if len(groups) == 0 {
+		return "{}"
+	}
+	return encodeGroups(groups)
+}
@@ -0,0 +1,170 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+	"github.com/zricethezav/gitleaks/v6/version"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Provenance describes how a report was made, written next to the report with --provenance. It holds the digest
+// of the report so a signed provenance vouches for the report too.
+type Provenance struct {
+	Tool       string `json:"tool"`
+	Version    string `json:"version"`
+	ConfigHash string `json:"configHash"`
+	RepoConfig bool   `json:"repoConfig,omitempty"`
+	Target     string `json:"target"`
+
+	// the commit range of the scan as set by the options, Heads holds the commit the history of each repo was
+	// walked from
+	Branch      string            `json:"branch,omitempty"`
+	Commit      string            `json:"commit,omitempty"`
+	CommitFrom  string            `json:"commitFrom,omitempty"`
+	CommitTo    string            `json:"commitTo,omitempty"`
+	CommitSince string            `json:"commitSince,omitempty"`
+	CommitUntil string            `json:"commitUntil,omitempty"`
+	Depth       int               `json:"depth,omitempty"`
+	Heads       map[string]string `json:"heads,omitempty"`
+
+	Commits    int              `json:"commits"`
+	Leaks      int              `json:"leaks"`
+	StartedAt  time.Time        `json:"startedAt"`
+	FinishedAt time.Time        `json:"finishedAt"`
+	Report     ProvenanceReport `json:"report"`
+}
+
+// ProvenanceReport identifies the report a provenance is for
+type ProvenanceReport struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	SHA256 string `json:"sha256"`
+}
+
+// RecordHead records the commit the history of repo is walked from
+func (manager *Manager) RecordHead(repo, commit string) {
+	manager.metadata.mux.Lock()
+	manager.metadata.RepoHeads[repo] = commit
+	manager.metadata.mux.Unlock()
+}
+
+// attestReport writes the provenance of the report written to path with --provenance and signs the report, and
+// the provenance, with --sign-report. Signatures are armored and detached, written to the path of the signed
+// file with .asc appended.
+func (manager *Manager) attestReport(path string) error {
+	report, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if manager.Opts.Provenance {
+		provenance, err := manager.provenance(path, report)
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(provenance, "", " ")
+		if err != nil {
+			return err
+		}
+		if err := manager.writeAttestation(path+".provenance.json", b); err != nil {
+			return err
+		}
+	}
+	if manager.signingKey != nil {
+		return manager.sign(path+".asc", report)
+	}
+	return nil
+}
+
+// writeAttestation writes b to path, signing it with --sign-report
+func (manager *Manager) writeAttestation(path string, b []byte) error {
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return err
+	}
+	if manager.signingKey != nil {
+		return manager.sign(path+".asc", b)
+	}
+	return nil
+}
+
+// sign writes the armored detached signature of b with the key of --sign-report to path
+func (manager *Manager) sign(path string, b []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := openpgp.ArmoredDetachSign(f, manager.signingKey, bytes.NewReader(b), nil); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// provenance returns the provenance of the report written to path
+func (manager *Manager) provenance(path string, report []byte) (Provenance, error) {
+	configHash, err := manager.ConfigHash()
+	if err != nil {
+		return Provenance{}, err
+	}
+	metadata := manager.GetMetadata()
+	heads := make(map[string]string)
+	metadata.mux.Lock()
+	for repo, head := range metadata.RepoHeads {
+		heads[repo] = head
+	}
+	metadata.mux.Unlock()
+
+	sum := sha256.Sum256(report)
+	return Provenance{
+		Tool:        "gitleaks",
+		Version:     version.Version,
+		ConfigHash:  configHash,
+		RepoConfig:  manager.Opts.RepoConfig,
+		Target:      manager.Opts.Target(),
+		Branch:      manager.Opts.Branch,
+		Commit:      manager.Opts.Commit,
+		CommitFrom:  manager.Opts.CommitFrom,
+		CommitTo:    manager.Opts.CommitTo,
+		CommitSince: manager.Opts.CommitSince,
+		CommitUntil: manager.Opts.CommitUntil,
+		Depth:       manager.Opts.Depth,
+		Heads:       heads,
+		Commits:     metadata.Commits,
+		Leaks:       manager.LeakCount(),
+		StartedAt:   manager.startTime.UTC(),
+		FinishedAt:  time.Now().UTC(),
+		Report: ProvenanceReport{
+			Name:   filepath.Base(path),
+			Format: manager.Opts.ReportFormat,
+			SHA256: hex.EncodeToString(sum[:]),
+		},
+	}, nil
+}
+
+// ConfigHash returns the sha256 of the config file or policy bundle of the scan, or of the default config if
+// neither is set. State saved to skip what was scanned before keeps it, what was scanned with another config is
+// scanned again.
+func (manager *Manager) ConfigHash() (string, error) {
+	b := []byte(config.DefaultConfig)
+	// scans with a policy run with the config of the policy bundle
+	file := manager.Opts.Config
+	if manager.Opts.Policy != "" {
+		file = manager.Opts.Policy
+	}
+	if file != "" {
+		var err error
+		if b, err = ioutil.ReadFile(file); err != nil {
+			return "", err
+		}
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
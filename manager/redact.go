@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"strings"
+)
+
+// redacted replaces the secrets of leaks redacted with --redact or --redact-report-only
+const redacted = "REDACTED"
+
+// redactLeak returns leak with its offender replaced by REDACTED everywhere it shows, the line and the offsets
+// of the match in it, the named groups, the commit message and the patch context. The offenders of the parts of
+// credential pairs are redacted one by one. The groups are copied so the leak redacted from is left as it is.
+func redactLeak(leak Leak) Leak {
+	if leak.Offender == "" || leak.Offender == redacted {
+		return leak
+	}
+	secrets := []string{leak.Offender}
+	if len(leak.partOffenders) != 0 {
+		// the offender of a pair joins the offenders of its parts, it's never found as it is
+		secrets = leak.partOffenders
+	}
+	if expression := obfuscatedExpression(leak, secrets[0]); expression != "" {
+		// the secrets of obfuscated leaks are reassembled from the expression the leak spans, the pieces of the
+		// secret in it are redacted with the whole expression
+		leak.Line = leak.Line[:leak.MatchStart] + redacted + leak.Line[leak.MatchStart+len(expression):]
+		leak.MatchEnd = leak.MatchStart + len(redacted)
+		leak.Hunk = strings.ReplaceAll(leak.Hunk, expression, redacted)
+	} else if leak.MatchEnd > leak.MatchStart && leak.MatchStart <= len(leak.Line) {
+		// the offsets move by the difference in length of every redacted offender before the match
+		shift := strings.Count(leak.Line[:leak.MatchStart], secrets[0]) * (len(redacted) - len(secrets[0]))
+		leak.MatchStart += shift
+		leak.MatchEnd = leak.MatchStart + len(redacted)
+	}
+	leak.Line = strings.ReplaceAll(leak.Line, secrets[0], redacted)
+	for _, secret := range secrets[1:] {
+		// the other parts of a pair may be on the line of the first, before its match
+		if leak.MatchStart <= len(leak.Line) {
+			shift := strings.Count(leak.Line[:leak.MatchStart], secret) * (len(redacted) - len(secret))
+			leak.MatchStart += shift
+			leak.MatchEnd += shift
+		}
+		leak.Line = strings.ReplaceAll(leak.Line, secret, redacted)
+	}
+
+	groups := make(map[string]string, len(leak.Groups))
+	for name, value := range leak.Groups {
+		groups[name] = value
+	}
+	for _, secret := range secrets {
+		leak.Message = strings.ReplaceAll(leak.Message, secret, redacted)
+		leak.DiffHeader = strings.ReplaceAll(leak.DiffHeader, secret, redacted)
+		leak.HunkHeader = strings.ReplaceAll(leak.HunkHeader, secret, redacted)
+		leak.Hunk = strings.ReplaceAll(leak.Hunk, secret, redacted)
+		for name, value := range groups {
+			groups[name] = strings.ReplaceAll(value, secret, redacted)
+		}
+	}
+	if leak.Groups != nil {
+		leak.Groups = groups
+	}
+
+	if len(leak.partOffenders) != 0 {
+		parts := make([]string, len(leak.partOffenders))
+		for i := range parts {
+			parts[i] = redacted
+		}
+		leak.Offender = strings.Join(parts, pairSeparator)
+		leak.partOffenders = parts
+	} else {
+		leak.Offender = redacted
+	}
+	return leak
+}
+
+// obfuscatedExpression returns the expression of the line of leak the leak spans if offender isn't in it,
+// like the concatenated literals an obfuscated secret is reassembled from (--deobfuscate)
+func obfuscatedExpression(leak Leak, offender string) string {
+	if leak.MatchStart < 0 || leak.MatchStart >= leak.MatchEnd || leak.MatchStart >= len(leak.Line) {
+		return ""
+	}
+	end := leak.MatchEnd
+	if end > len(leak.Line) {
+		// lines cut short before they're redacted with --redact-report-only
+		end = len(leak.Line)
+	}
+	expression := leak.Line[leak.MatchStart:end]
+	if strings.Contains(expression, offender) {
+		return ""
+	}
+	return expression
+}
+
+// IsRedacted returns true if the offender of leak, read from a report, was redacted
+func IsRedacted(leak Leak) bool {
+	return strings.Contains(leak.Offender, redacted)
+}
+
+// reportLeaks returns the leaks of the scan as they are written to reports, databases and event streams. With
+// --redact-report-only the leaks are kept in full for the terminal and redacted here.
+func (manager *Manager) reportLeaks() []Leak {
+	return manager.redactReport(manager.GetLeaks())
+}
+
+// redactReport returns leaks redacted with --redact-reports
+func (manager *Manager) redactReport(leaks []Leak) []Leak {
+	if !manager.Opts.RedactReports || manager.Opts.Redact {
+		return leaks
+	}
+	report := make([]Leak, len(leaks))
+	for i, leak := range leaks {
+		report[i] = redactLeak(leak)
+	}
+	return report
+}
+
+// MaskSecret keeps the first characters of long secrets to tell them apart and masks the rest, without giving away
+// the length of the secret. Secrets redacted with --redact are left as they are.
+func MaskSecret(secret string) string {
+	if secret == redacted {
+		return secret
+	}
+	if runes := []rune(secret); len(runes) >= 12 {
+		return string(runes[:4]) + "****"
+	}
+	return "****"
+}
@@ -3,75 +3,295 @@ package manager
 import (
 	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/zricethezav/gitleaks/v6/options"
 	"github.com/zricethezav/gitleaks/v6/version"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// Report saves gitleaks leaks to a json specified by --report={report.json}
+// Report saves gitleaks leaks to a json specified by --report={report.json}. The functions added with AfterReport
+// run once the leaks are reported.
 func (manager *Manager) Report() error {
+	if err := manager.report(); err != nil {
+		return err
+	}
+	manager.afterReportMux.Lock()
+	defer manager.afterReportMux.Unlock()
+	for _, f := range manager.afterReport {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AfterReport adds f to the functions run once the leaks of the scan are reported, like saving what was scanned
+// for the next scan. They don't run if the report fails, so the leaks are reported again by the next scan.
+func (manager *Manager) AfterReport(f func() error) {
+	manager.afterReportMux.Lock()
+	manager.afterReport = append(manager.afterReport, f)
+	manager.afterReportMux.Unlock()
+}
+
+func (manager *Manager) report() error {
+	// an interrupt after the report no longer concerns this manager
+	signal.Stop(manager.stopChan)
 	close(manager.leakChan)
 	close(manager.metadata.timings)
 
 	if log.IsLevelEnabled(log.DebugLevel) {
 		manager.DebugOutput()
 	}
+	if cloneErrors := manager.GetCloneErrors(); len(cloneErrors) != 0 {
+		log.Warnf("%d repos could not be cloned and were not scanned", len(cloneErrors))
+		for _, cloneErr := range cloneErrors {
+			log.Warnf("%s: %s", cloneErr.Repo, cloneErr.Error)
+		}
+	}
 
-	if manager.Opts.Report != "" {
-		if len(manager.GetLeaks()) == 0 {
+	if manager.events != nil {
+		// all leaks are queued once they are received
+		manager.GetLeaks()
+		close(manager.events)
+		if err := <-manager.eventsDone; err != nil {
+			return fmt.Errorf("unable to publish leak events: %v", err)
+		}
+		log.Infof("leak events published")
+	}
+
+	manager.shutdownTracing()
+
+	if dsn := options.GetPostgresDSN(manager.Opts); dsn != "" {
+		if err := manager.writePostgres(dsn); err != nil {
+			return fmt.Errorf("unable to store findings in postgres: %v", err)
+		}
+		log.Infof("findings stored in postgres")
+	}
+
+	if manager.Opts.Elasticsearch != "" {
+		if err := manager.writeElasticsearch(manager.Opts.Elasticsearch); err != nil {
+			return fmt.Errorf("unable to index leaks into elasticsearch: %v", err)
+		}
+		log.Infof("leaks indexed into elasticsearch")
+	}
+
+	if manager.Opts.Report == "" {
+		switch {
+		case manager.Opts.CountOnly:
+			// nothing but the count is printed
+		case isAnnotationFormat(manager.Opts.ReportFormat):
+			// CI service messages are only picked up when printed to stdout
+			return manager.writeReport(os.Stdout)
+		case manager.Opts.Quiet:
+			// the report is printed even without leaks so pipelines always get one to parse
+			return manager.writeReport(os.Stdout)
+		default:
+			return manager.writeTable(os.Stdout, !manager.Opts.NoColor)
+		}
+	} else if manager.stream != nil {
+		written, err := manager.closeReportStream()
+		if err != nil {
+			return fmt.Errorf("unable to write the report: %v", err)
+		}
+		if !written {
 			log.Infof("no leaks found, skipping writing report")
-			return nil
+		} else {
+			if err := manager.attestReport(manager.Opts.Report); err != nil {
+				return err
+			}
+			log.Infof("report written to %s", manager.Opts.Report)
+		}
+	} else if manager.Opts.ReportFormat == "sqlite" && !isRegistered("sqlite") {
+		// scans without leaks are still added to sqlite databases to keep the history of scans
+		if err := manager.writeSQLite(manager.Opts.Report); err != nil {
+			return err
 		}
+		if err := manager.attestReport(manager.Opts.Report); err != nil {
+			return err
+		}
+		log.Infof("report written to %s", manager.Opts.Report)
+	} else if len(manager.GetLeaks()) == 0 && manager.Opts.ReportFormat != "json-by-repo" && !manager.Stopped() &&
+		(manager.Opts.ReportFormat != "sarif" || (len(manager.GetCloneErrors()) == 0 &&
+			len(manager.suppressedLeaks()) == 0)) {
+		// reports are still written when the scan stopped early so that is reported, sarif reports also when
+		// repos could not be cloned or with suppressed leaks only, reports by repo are always written as they
+		// list the repos scanned without leaks
+		log.Infof("no leaks found, skipping writing report")
+	} else {
 		file, err := os.Create(manager.Opts.Report)
 		if err != nil {
 			return err
 		}
-
-		switch manager.Opts.ReportFormat {
-		case "json":
-			encoder := json.NewEncoder(file)
-			encoder.SetIndent("", " ")
-			err = encoder.Encode(manager.leaks)
-			if err != nil {
-				return err
-			}
-		case "csv":
-			w := csv.NewWriter(file)
-			_ = w.Write([]string{"repo", "line", "commit", "offender", "rule", "tags", "commitMsg", "author", "email", "file", "date"})
-			for _, leak := range manager.GetLeaks() {
-				w.Write([]string{leak.Repo, leak.Line, leak.Commit, leak.Offender, leak.Rule, leak.Tags, leak.Message, leak.Author, leak.Email, leak.File, leak.Date.Format(time.RFC3339)})
-			}
-			w.Flush()
-		case "sarif":
-			s := Sarif{
-				Schema:  "https://schemastore.azurewebsites.net/schemas/json/sarif-2.1.0-rtm.5.json",
-				Version: "2.1.0",
-				Runs: []Runs{
-					{
-						Tool: Tool{
-							Driver: Driver{
-								Name:            "Gitleaks",
-								SemanticVersion: version.Version,
-								Rules:           manager.configToRules(),
-							},
-						},
-						Results: manager.leaksToResults(),
-					},
-				},
-			}
-			encoder := json.NewEncoder(file)
-			encoder.SetIndent("", " ")
-			err = encoder.Encode(s)
-			if err != nil {
-				return err
-			}
+		if manager.reportKeys != nil {
+			err = manager.writeEncryptedReport(file)
+		} else {
+			err = manager.writeReport(file)
 		}
 		_ = file.Close()
-
+		if err != nil {
+			return err
+		}
+		if err := manager.attestReport(manager.Opts.Report); err != nil {
+			return err
+		}
 		log.Infof("report written to %s", manager.Opts.Report)
 	}
+
+	if manager.Opts.CountOnly {
+		_, err := fmt.Fprintln(os.Stdout, manager.FailingLeakCount())
+		return err
+	}
 	return nil
 }
+
+// writeReport writes the report of the scan in --report-format to w with the ReportWriter registered for the
+// format. sqlite reports are written by writeSQLite, unless a writer is registered for sqlite.
+func (manager *Manager) writeReport(w io.Writer) error {
+	format := manager.Opts.ReportFormat
+	if format == "" {
+		// the default of --report-format, options built by applications embedding gitleaks may not set it
+		format = "json"
+	}
+	writer, ok := reportWriter(format)
+	if !ok {
+		return fmt.Errorf("unknown --report-format %s, the formats are %s", format, strings.Join(ReportFormats(), ", "))
+	}
+	return writer.WriteReport(manager, w)
+}
+
+// jsonReport is the json report of scans that may stop early, the leaks of the scan and why the scan was
+// stopped if it was
+type jsonReport struct {
+	Leaks     interface{} `json:"leaks"`
+	Truncated string      `json:"truncated,omitempty"`
+}
+
+// writeJSON writes the leaks of the scan as a json array, or the unique secrets with --report-schema=v2. The
+// array is the leaks of a jsonReport for scans that may stop early.
+func (manager *Manager) writeJSON(w io.Writer) error {
+	leaks := manager.reportLeaks()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	var report interface{} = leaks
+	if manager.Opts.ReportSchema == "v2" {
+		report = uniqueLeaks(leaks)
+	} else if leaks == nil {
+		report = []Leak{}
+	}
+	if manager.mayStop() {
+		report = jsonReport{Leaks: report, Truncated: manager.StopReason()}
+	}
+	return encoder.Encode(report)
+}
+
+// writeReposJSON writes the leaks of the scan grouped by repo
+func (manager *Manager) writeReposJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(manager.reposReport())
+}
+
+// writeHeatmapJSON writes the leak counts of the scan per directory and file extension
+func (manager *Manager) writeHeatmapJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(manager.heatmapReport())
+}
+
+// writeCSV writes a csv record of each leak of the scan
+func (manager *Manager) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write(manager.csvHeader())
+	for _, leak := range manager.reportLeaks() {
+		cw.Write(manager.csvRecord(leak))
+	}
+	if record := manager.csvStopRecord(); record != nil {
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeSarif writes the leaks of the scan as a sarif log
+func (manager *Manager) writeSarif(w io.Writer) error {
+	s := Sarif{
+		Schema:  "https://schemastore.azurewebsites.net/schemas/json/sarif-2.1.0-rtm.5.json",
+		Version: "2.1.0",
+		Runs: []Runs{
+			{
+				Tool: Tool{
+					Driver: Driver{
+						Name:            "Gitleaks",
+						SemanticVersion: version.Version,
+						Rules:           manager.configToRules(),
+					},
+				},
+				Results:           manager.leaksToResults(),
+				Invocations:       manager.invocations(),
+				AutomationDetails: manager.automationDetails(),
+			},
+		},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(s)
+}
+
+// csvHeader is the header of csv reports, naming the fields of csvRecord
+var csvHeader = []string{"repo", "line", "commit", "offender", "rule", "tags", "commitMsg", "author", "email", "file", "date", "entropy", "ruleRegex", "matchStart", "matchEnd", "groups", "url"}
+
+// csvHeader returns the header of the csv report. Scans that may stop early have a truncated column, which is
+// empty for leaks and set to why the scan was stopped in the last record of scans stopped early.
+func (manager *Manager) csvHeader() []string {
+	if manager.mayStop() {
+		return append(append([]string(nil), csvHeader...), "truncated")
+	}
+	return csvHeader
+}
+
+// csvRecord returns the record of leak in the csv report
+func (manager *Manager) csvRecord(leak Leak) []string {
+	if manager.mayStop() {
+		return append(csvRecord(leak), "")
+	}
+	return csvRecord(leak)
+}
+
+// csvStopRecord returns the last record of the csv report of a scan stopped early, or nil if the scan wasn't
+// stopped
+func (manager *Manager) csvStopRecord() []string {
+	reason := manager.StopReason()
+	if reason == "" || !manager.mayStop() {
+		return nil
+	}
+	record := make([]string, len(csvHeader)+1)
+	record[len(csvHeader)] = reason
+	return record
+}
+
+// csvRecord returns the record of leak in csv reports
+func csvRecord(leak Leak) []string {
+	return []string{leak.Repo, leak.Line, leak.Commit, leak.Offender, leak.Rule, leak.Tags, leak.Message, leak.Author, leak.Email, leak.File, leak.Date.Format(time.RFC3339),
+		strconv.FormatFloat(leak.Entropy, 'f', -1, 64), leak.RuleRegex, strconv.Itoa(leak.MatchStart), strconv.Itoa(leak.MatchEnd), encodeGroups(leak.Groups), leak.URL}
+}
+
+// encodeGroups encodes the named groups of a leak as a json object for the report formats with flat fields,
+// or returns an empty string if the leak has none
+func encodeGroups(groups map[string]string) string {
+	if len(groups) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(groups)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"sort"
+)
+
+// reposReport is the report written with --report-format=json-by-repo. Scans of many repos, like host and
+// owner scans, get a section per repo with the repo's leaks and a summary of them, and a summary of the
+// whole scan. Repos scanned without leaks are listed too so the report shows what was covered.
+type reposReport struct {
+	Summary     reposSummary           `json:"summary"`
+	Repos       map[string]*repoReport `json:"repos"`
+	CloneErrors []CloneError           `json:"cloneErrors,omitempty"`
+
+	// Truncated is set to why the scan stopped early if it did, the report only holds the leaks found until then
+	Truncated string `json:"truncated,omitempty"`
+}
+
+type reposSummary struct {
+	Repos          int            `json:"repos"`
+	ReposWithLeaks int            `json:"reposWithLeaks"`
+	Commits        int            `json:"commits"`
+	Leaks          int            `json:"leaks"`
+	Rules          map[string]int `json:"rules"`
+
+	// SampledOut counts the commits left out by --sample, Commits only counts the commits scanned
+	SampledOut int `json:"sampledOut,omitempty"`
+
+	// SkippedFiles counts the files skipped instead of scanned by the reason they were skipped for
+	SkippedFiles map[string]int `json:"skippedFiles,omitempty"`
+}
+
+type repoReport struct {
+	Summary repoSummary `json:"summary"`
+	Leaks   []Leak      `json:"leaks"`
+
+	// RemovedNotRotated holds the leaks found in lines the repo's commits removed, see CategoryRemovedNotRotated.
+	// They are counted in the summary with the other leaks.
+	RemovedNotRotated []Leak `json:"removedNotRotated,omitempty"`
+}
+
+type repoSummary struct {
+	Commits int            `json:"commits"`
+	Leaks   int            `json:"leaks"`
+	Files   int            `json:"files"`
+	Rules   map[string]int `json:"rules"`
+}
+
+// reposReport groups the leaks of the scan by repo
+func (manager *Manager) reposReport() reposReport {
+	metadata := manager.GetMetadata()
+	report := reposReport{
+		Summary: reposSummary{
+			Commits:      metadata.Commits,
+			Rules:        make(map[string]int),
+			SampledOut:   metadata.SampledOut,
+			SkippedFiles: manager.SkippedFiles(),
+		},
+		Repos:       make(map[string]*repoReport),
+		CloneErrors: manager.GetCloneErrors(),
+		Truncated:   manager.StopReason(),
+	}
+	section := func(name string) *repoReport {
+		r, ok := report.Repos[name]
+		if !ok {
+			r = &repoReport{
+				Summary: repoSummary{Rules: make(map[string]int)},
+				Leaks:   []Leak{},
+			}
+			report.Repos[name] = r
+		}
+		return r
+	}
+
+	metadata.mux.Lock()
+	for name, commits := range metadata.RepoCommits {
+		section(name).Summary.Commits = commits
+	}
+	metadata.mux.Unlock()
+
+	files := make(map[string]map[string]bool)
+	for _, leak := range manager.reportLeaks() {
+		r := section(leak.Repo)
+		if leak.Category == CategoryRemovedNotRotated {
+			r.RemovedNotRotated = append(r.RemovedNotRotated, leak)
+		} else {
+			r.Leaks = append(r.Leaks, leak)
+		}
+		r.Summary.Leaks++
+		r.Summary.Rules[leak.Rule]++
+		if files[leak.Repo] == nil {
+			files[leak.Repo] = make(map[string]bool)
+		}
+		files[leak.Repo][leak.File] = true
+
+		report.Summary.Leaks++
+		report.Summary.Rules[leak.Rule]++
+	}
+
+	for name, r := range report.Repos {
+		r.Summary.Files = len(files[name])
+		if r.Summary.Leaks != 0 {
+			report.Summary.ReposWithLeaks++
+		}
+		sortRepoLeaks(r.Leaks)
+		sortRepoLeaks(r.RemovedNotRotated)
+	}
+	report.Summary.Repos = len(report.Repos)
+	return report
+}
+
+// sortRepoLeaks sorts the leaks of a repo by commit, file and line. Leaks are received in the order the scan
+// workers found them.
+func sortRepoLeaks(leaks []Leak) {
+	sort.SliceStable(leaks, func(i, j int) bool {
+		if leaks[i].Commit != leaks[j].Commit {
+			return leaks[i].Commit < leaks[j].Commit
+		}
+		if leaks[i].File != leaks[j].File {
+			return leaks[i].File < leaks[j].File
+		}
+		return leaks[i].LineNumber < leaks[j].LineNumber
+	})
+}
@@ -2,6 +2,7 @@ package manager
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -52,8 +53,10 @@ type ArtifactLocation struct {
 
 //Region ...
 type Region struct {
-	StartLine int     `json:"startLine"`
-	Snippet   Snippet `json:"snippet"`
+	StartLine   int     `json:"startLine"`
+	StartColumn int     `json:"startColumn,omitempty"`
+	EndColumn   int     `json:"endColumn,omitempty"`
+	Snippet     Snippet `json:"snippet"`
 }
 
 //Snippet ...
@@ -74,34 +77,80 @@ type Locations struct {
 
 //Results ...
 type Results struct {
+	RuleID     string           `json:"ruleId"`
+	Level      string           `json:"level,omitempty"`
 	Message    Message          `json:"message"`
 	Properties ResultProperties `json:"properties"`
 	Locations  []Locations      `json:"locations"`
+
+	Suppressions []Suppression `json:"suppressions,omitempty"`
+}
+
+// Suppression tells why a result isn't an issue, results with a suppression are shown as dismissed by code
+// scanning
+type Suppression struct {
+	Kind          string `json:"kind"`
+	Status        string `json:"status"`
+	Justification string `json:"justification,omitempty"`
 }
 
 //ResultProperties ...
 type ResultProperties struct {
 	Commit        string    `json:"commit"`
 	Offender      string    `json:"offender"`
+	Entropy       float64   `json:"entropy"`
+	RuleRegex     string    `json:"ruleRegex"`
+	Tags          string    `json:"tags"`
 	Date          time.Time `json:"date"`
 	Author        string    `json:"author"`
 	Email         string    `json:"email"`
 	CommitMessage string    `json:"commitMessage"`
 	Operation     string    `json:"gitOperation"`
 	Repo          string    `json:"repo"`
+
+	Groups map[string]string `json:"groups,omitempty"`
+	URL    string            `json:"url,omitempty"`
+
+	// Score is the risk score of the leak with --score
+	Score float64 `json:"score,omitempty"`
 }
 
 //Runs ...
 type Runs struct {
-	Tool    Tool      `json:"tool"`
-	Results []Results `json:"results"`
+	Tool        Tool         `json:"tool"`
+	Results     []Results    `json:"results"`
+	Invocations []Invocation `json:"invocations,omitempty"`
+
+	AutomationDetails *AutomationDetails `json:"automationDetails,omitempty"`
+}
+
+// AutomationDetails identifies the run of a sarif report. GitHub code scanning takes everything up to the last
+// slash of ID as the category of the analysis and only replaces the results of analyses of the same category.
+type AutomationDetails struct {
+	ID string `json:"id"`
+}
+
+//Invocation ...
+type Invocation struct {
+	ExecutionSuccessful        bool           `json:"executionSuccessful"`
+	ToolExecutionNotifications []Notification `json:"toolExecutionNotifications,omitempty"`
+}
+
+//Notification ...
+type Notification struct {
+	Level   string  `json:"level"`
+	Message Message `json:"message"`
 }
 
 func (manager *Manager) configToRules() []Rules {
 	var rules []Rules
 	for _, rule := range manager.Config.Rules {
+		id := rule.ID
+		if id == "" {
+			id = rule.Description
+		}
 		rules = append(rules, Rules{
-			ID:   rule.Description,
+			ID:   id,
 			Name: rule.Description,
 		})
 	}
@@ -110,42 +159,117 @@ func (manager *Manager) configToRules() []Rules {
 
 func (manager *Manager) leaksToResults() []Results {
 	var results []Results
-	for _, leak := range manager.leaks {
-		results = append(results, Results{
+	for _, leak := range manager.reportLeaks() {
+		results = append(results, leakToResult(leak))
+	}
+	// false positives reported as suppressed with --sarif-suppressions
+	for _, leak := range manager.suppressedLeaks() {
+		markedAt := manager.triage.Verdicts[leak.Fingerprint].MarkedAt
+		result := leakToResult(leak)
+		result.Suppressions = []Suppression{{
+			Kind:          "external",
+			Status:        "accepted",
+			Justification: "marked as a false positive with gitleaks mark on " + markedAt.Format("2006-01-02"),
+		}}
+		results = append(results, result)
+	}
+	return results
+}
+
+// leakToResult returns the sarif result of leak
+func leakToResult(leak Leak) Results {
+	// results without a level are warnings, the leaks of report-only rules are notes
+	level := ""
+	if leak.ReportOnly {
+		level = "note"
+	}
+	return Results{
+		RuleID: leakRuleID(leak),
+		Level:  level,
+		Message: Message{
+			Text: fmt.Sprintf("%s secret detected", leak.Rule),
+		},
+		Properties: ResultProperties{
+			Commit:        leak.Commit,
+			Offender:      leak.Offender,
+			Entropy:       leak.Entropy,
+			RuleRegex:     leak.RuleRegex,
+			Tags:          leak.Tags,
+			Groups:        leak.Groups,
+			URL:           leak.URL,
+			Date:          leak.Date,
+			Author:        leak.Author,
+			Email:         leak.Email,
+			CommitMessage: leak.Message,
+			Operation:     leak.Operation,
+			Repo:          leak.Repo,
+			Score:         leak.Score,
+		},
+		Locations: leakToLocation(leak),
+	}
+}
+
+// invocations reports the repos that could not be cloned as notifications of a failed invocation, and
+// warns of scans stopped early that their results are incomplete
+func (manager *Manager) invocations() []Invocation {
+	cloneErrors := manager.GetCloneErrors()
+	reason := manager.StopReason()
+	if len(cloneErrors) == 0 && reason == "" {
+		return nil
+	}
+	var notifications []Notification
+	if reason != "" {
+		notifications = append(notifications, Notification{
+			Level:   "warning",
+			Message: Message{Text: "the scan was stopped early: " + reason},
+		})
+	}
+	for _, cloneErr := range cloneErrors {
+		notifications = append(notifications, Notification{
+			Level: "error",
 			Message: Message{
-				Text: fmt.Sprintf("%s secret detected", leak.Rule),
-			},
-			Properties: ResultProperties{
-				Commit:        leak.Commit,
-				Offender:      leak.Offender,
-				Date:          leak.Date,
-				Author:        leak.Author,
-				Email:         leak.Email,
-				CommitMessage: leak.Message,
-				Operation:     leak.Operation,
-				Repo:          leak.Repo,
+				Text: fmt.Sprintf("unable to clone %s: %s", cloneErr.Repo, cloneErr.Error),
 			},
-			Locations: leakToLocation(leak),
 		})
 	}
-
-	return results
+	return []Invocation{
+		{
+			ExecutionSuccessful:        len(cloneErrors) == 0,
+			ToolExecutionNotifications: notifications,
+		},
+	}
 }
 
 func leakToLocation(leak Leak) []Locations {
+	region := Region{
+		StartLine: leak.LineNumber,
+		Snippet: Snippet{
+			Text: leak.Line,
+		},
+	}
+	// sarif columns are 1-based and the end column is the first one after the offender
+	if leak.MatchEnd > leak.MatchStart {
+		region.StartColumn = leak.MatchStart + 1
+		region.EndColumn = leak.MatchEnd + 1
+	}
 	return []Locations{
 		{
 			PhysicalLocation: PhysicalLocation{
 				ArtifactLocation: ArtifactLocation{
 					URI: leak.File,
 				},
-				Region: Region{
-					StartLine: leak.LineNumber,
-					Snippet: Snippet{
-						Text: leak.Line,
-					},
-				},
+				Region: region,
 			},
 		},
 	}
 }
+
+// automationDetails returns the automation details of the run of the scan: its --sarif-category and the time it
+// started, which identifies the run within its category. Reports without --sarif-category have none.
+func (manager *Manager) automationDetails() *AutomationDetails {
+	category := strings.Trim(manager.Opts.SarifCategory, "/")
+	if category == "" {
+		return nil
+	}
+	return &AutomationDetails{ID: category + "/" + manager.startTime.UTC().Format(time.RFC3339)}
+}
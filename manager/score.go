@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"math"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Scorer scores the risk of leaks with --score, from 0 for no risk to 100. The Scorer of the manager can be
+// replaced by applications embedding gitleaks to rank leaks their own way.
+type Scorer interface {
+	Score(risk Risk) float64
+}
+
+// Verifier tells whether the secret of leak is live, by trying it with its provider. The manager has no Verifier
+// unless an application embedding gitleaks sets one, the leaks of scans without one aren't verified.
+type Verifier func(leak Leak) (bool, error)
+
+// Risk holds what the risk of a leak is scored from
+type Risk struct {
+	Leak Leak
+
+	// Severity is the severity of the rule of the leak, see leakSeverity
+	Severity string
+
+	// Verified is whether the secret of the leak is live as told by the Verifier of the manager, or nil if it
+	// wasn't verified
+	Verified *bool
+
+	// AtHead is set if the secret is still in the file at the HEAD of the repo, Age is how long ago the
+	// commit of the leak was made
+	AtHead bool
+	Age    time.Duration
+}
+
+// DefaultScorer scores leaks mostly by the severity of their rule, raised for secrets that look random, are
+// live, are still at HEAD and were committed recently
+type DefaultScorer struct{}
+
+const (
+	// entropyOfRandomSecrets is the entropy from which secrets get the full entropy weight, base64 encoded
+	// random secrets have an entropy around 5 to 6
+	entropyOfRandomSecrets = 5.0
+
+	// ageHalfLife is the age at which the recency weight of a leak is halved
+	ageHalfLife = 90 * 24 * time.Hour
+)
+
+// Score returns the weighted sum of the risk factors of risk. Leaks that weren't verified get half the weight
+// of verified live secrets and secrets verified to be revoked none.
+func (DefaultScorer) Score(risk Risk) float64 {
+	severity := float64(severityRank(risk.Severity)+1) / float64(len(config.Severities))
+	entropy := math.Min(risk.Leak.Entropy/entropyOfRandomSecrets, 1)
+	verified := 0.5
+	if risk.Verified != nil {
+		verified = 0
+		if *risk.Verified {
+			verified = 1
+		}
+	}
+	atHead := 0.0
+	if risk.AtHead {
+		atHead = 1
+	}
+	recency := math.Exp2(-math.Max(risk.Age.Hours(), 0) / ageHalfLife.Hours())
+
+	score := 100 * (0.4*severity + 0.15*entropy + 0.2*verified + 0.15*atHead + 0.1*recency)
+	return math.Round(score*10) / 10
+}
+
+// scoreLeak sets the score of leak with the Scorer of the manager
+func (manager *Manager) scoreLeak(leak *Leak) {
+	risk := Risk{
+		Leak:     *leak,
+		Severity: leakSeverity(*leak),
+		AtHead:   leak.AtHead,
+	}
+	if !leak.Date.IsZero() {
+		risk.Age = manager.startTime.Sub(leak.Date)
+	}
+	if manager.Verifier != nil {
+		live, err := manager.Verifier(*leak)
+		if err != nil {
+			log.Debugf("unable to verify the leak of %s in %s: %v", leak.Rule, leak.File, err)
+		} else {
+			risk.Verified = &live
+		}
+	}
+	leak.Score = manager.Scorer.Score(risk)
+}
@@ -0,0 +1,24 @@
+package manager
+
+// defaultSeverity is the severity of the leaks of rules that don't set one
+const defaultSeverity = "high"
+
+// leakSeverity returns the severity of leak for the report formats that need one. Leaks of rules without a
+// severity are high, or info if the rule is report-only.
+func leakSeverity(leak Leak) string {
+	if leak.Severity != "" {
+		return leak.Severity
+	}
+	if leak.ReportOnly {
+		return "info"
+	}
+	return defaultSeverity
+}
+
+// leakRuleID returns the id of the rule of leak, or its description if the rule has no id
+func leakRuleID(leak Leak) string {
+	if leak.RuleID != "" {
+		return leak.RuleID
+	}
+	return leak.Rule
+}
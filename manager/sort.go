@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"sort"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+)
+
+// sortLeaks sorts leaks by the key of --sort. Leaks are received in the order the scan workers found them, so
+// leaks of the same key, or all leaks if by is empty, are sorted by where they were found to report them in
+// the same order on every run.
+func sortLeaks(leaks []Leak, by string) {
+	sort.SliceStable(leaks, func(i, j int) bool {
+		a, b := leaks[i], leaks[j]
+		switch by {
+		case "commit-date":
+			if !a.Date.Equal(b.Date) {
+				return a.Date.After(b.Date)
+			}
+		case "file":
+			if a.File != b.File {
+				return a.File < b.File
+			}
+		case "rule":
+			if a.Rule != b.Rule {
+				return a.Rule < b.Rule
+			}
+		case "score":
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+		case "severity":
+			if sa, sb := severityRank(leakSeverity(a)), severityRank(leakSeverity(b)); sa != sb {
+				return sa > sb
+			}
+		}
+		return leakLess(a, b)
+	})
+}
+
+// leakLess orders leaks by where they were found
+func leakLess(a, b Leak) bool {
+	switch {
+	case a.Repo != b.Repo:
+		return a.Repo < b.Repo
+	case a.Commit != b.Commit:
+		return a.Commit < b.Commit
+	case a.File != b.File:
+		return a.File < b.File
+	case a.LineNumber != b.LineNumber:
+		return a.LineNumber < b.LineNumber
+	case a.MatchStart != b.MatchStart:
+		return a.MatchStart < b.MatchStart
+	case a.Rule != b.Rule:
+		return a.Rule < b.Rule
+	}
+	return a.lookupHash < b.lookupHash
+}
+
+// severityRank returns the rank of severity in config.Severities, least severe first
+func severityRank(severity string) int {
+	for i, s := range config.Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
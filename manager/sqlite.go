@@ -0,0 +1,178 @@
+package manager
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/version"
+
+	// registers the sqlite database/sql driver, a pure go build of sqlite so static builds without cgo can write
+	// sqlite reports
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema is created in new report databases. Every scan writing to the database adds a scan run, so a
+// single database collects the results of many scans. Leaks found again by a later scan have the same
+// fingerprint, which makes it possible to tell new leaks from known ones and to follow them over time.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS scan_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP NOT NULL,
+	version TEXT NOT NULL,
+	target TEXT NOT NULL,
+	commits INTEGER NOT NULL,
+	leaks INTEGER NOT NULL,
+	truncated TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS rules (
+	description TEXT PRIMARY KEY,
+	regex TEXT NOT NULL,
+	tags TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS leaks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	run_id INTEGER NOT NULL REFERENCES scan_runs(id),
+	fingerprint TEXT NOT NULL,
+	repo TEXT NOT NULL,
+	rule TEXT NOT NULL,
+	commit_sha TEXT NOT NULL,
+	file TEXT NOT NULL,
+	old_file TEXT NOT NULL,
+	line_number INTEGER NOT NULL,
+	line TEXT NOT NULL,
+	offender TEXT NOT NULL,
+	commit_message TEXT NOT NULL,
+	author TEXT NOT NULL,
+	email TEXT NOT NULL,
+	date TIMESTAMP NOT NULL,
+	tags TEXT NOT NULL,
+	operation TEXT NOT NULL,
+	merge_parent TEXT NOT NULL,
+	entropy REAL NOT NULL DEFAULT 0,
+	match_start INTEGER NOT NULL DEFAULT 0,
+	match_end INTEGER NOT NULL DEFAULT 0,
+	groups TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS leaks_fingerprint ON leaks(fingerprint);
+CREATE INDEX IF NOT EXISTS leaks_repo ON leaks(repo);
+CREATE INDEX IF NOT EXISTS leaks_run_id ON leaks(run_id);
+`
+
+// sqliteColumns are the columns added to the tables after they were first released. They are added to
+// databases created by older versions.
+var sqliteColumns = []struct{ table, name, definition string }{
+	{"leaks", "entropy", "REAL NOT NULL DEFAULT 0"},
+	{"leaks", "match_start", "INTEGER NOT NULL DEFAULT 0"},
+	{"leaks", "match_end", "INTEGER NOT NULL DEFAULT 0"},
+	{"leaks", "groups", "TEXT NOT NULL DEFAULT ''"},
+	{"scan_runs", "truncated", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// writeSQLite adds the scan run, the rules of the config and the leaks found to the sqlite database at path.
+// The database is created if it doesn't exist.
+func (manager *Manager) writeSQLite(path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	if err := migrateSQLite(db); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	leaks := manager.reportLeaks()
+	metadata := manager.GetMetadata()
+	run, err := tx.Exec(`INSERT INTO scan_runs (started_at, finished_at, version, target, commits, leaks, truncated)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		manager.startTime.UTC(), time.Now().UTC(), version.Version, manager.Opts.Target(), metadata.Commits, len(leaks),
+		manager.StopReason())
+	if err != nil {
+		return err
+	}
+	runID, err := run.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range manager.Config.Rules {
+		regex := ""
+		if rule.Regex != nil {
+			regex = rule.Regex.String()
+		}
+		_, err := tx.Exec(`INSERT INTO rules (description, regex, tags) VALUES (?, ?, ?)
+			ON CONFLICT(description) DO UPDATE SET regex = excluded.regex, tags = excluded.tags`,
+			rule.Description, regex, strings.Join(rule.Tags, ", "))
+		if err != nil {
+			return err
+		}
+	}
+
+	insert, err := tx.Prepare(`INSERT INTO leaks (run_id, fingerprint, repo, rule, commit_sha, file, old_file,
+		line_number, line, offender, commit_message, author, email, date, tags, operation, merge_parent,
+		entropy, match_start, match_end, groups)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for _, leak := range leaks {
+		_, err := insert.Exec(runID, leak.lookupHash, leak.Repo, leak.Rule, leak.Commit, leak.File, leak.OldFile,
+			leak.LineNumber, leak.Line, leak.Offender, leak.Message, leak.Author, leak.Email, leak.Date.UTC(),
+			leak.Tags, leak.Operation, leak.MergeParent, leak.Entropy, leak.MatchStart, leak.MatchEnd,
+			encodeGroups(leak.Groups))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateSQLite adds the columns of sqliteColumns missing from the tables
+func migrateSQLite(db *sql.DB) error {
+	existing := make(map[string]bool)
+	for _, table := range []string{"leaks", "scan_runs"} {
+		rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var (
+				cid, notNull, pk int
+				name, colType    string
+				defaultValue     sql.NullString
+			)
+			if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+				rows.Close()
+				return err
+			}
+			existing[table+"."+name] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, column := range sqliteColumns {
+		if existing[column.table+"."+column.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column.table, column.name, column.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
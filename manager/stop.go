@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Stop stops the scan early. Scans check Stopped as they go and wind down, reporting the leaks found so far.
+// reason is logged and noted in the report. Only the first reason is kept.
+func (manager *Manager) Stop(reason string) {
+	manager.stopOnce.Do(func() {
+		manager.stopReason.Store(reason)
+		log.Warnf("stopping the scan early: %s", reason)
+	})
+}
+
+// Stopped returns true once the scan was stopped early
+func (manager *Manager) Stopped() bool {
+	return manager.StopReason() != ""
+}
+
+// StopReason returns why the scan was stopped early, or "" if it wasn't
+func (manager *Manager) StopReason() string {
+	reason, _ := manager.stopReason.Load().(string)
+	return reason
+}
+
+// mayStop returns true if the scan is stopped early once it's past --max-total-bytes or --max-findings. The
+// json and csv reports of these scans have room for why the scan was stopped whether it was or not, so their
+// shape doesn't depend on how the scan ends and reports streamed with --report-batch-size can have it too.
+func (manager *Manager) mayStop() bool {
+	return manager.Opts.MaxTotalBytes > 0 || manager.Opts.MaxFindings > 0
+}
+
+// stopNotice returns the notice of reports of a scan stopped early, or "" if the scan wasn't stopped
+func (manager *Manager) stopNotice() string {
+	if reason := manager.StopReason(); reason != "" {
+		return "the scan was stopped early: " + reason
+	}
+	return ""
+}
+
+// AddScannedBytes adds n bytes to the content scanned so far. It returns false, stopping the scan, if the
+// content would exceed --max-total-bytes.
+func (manager *Manager) AddScannedBytes(n int) bool {
+	if manager.Opts.MaxTotalBytes <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&manager.scannedBytes, int64(n)) > manager.Opts.MaxTotalBytes {
+		manager.Stop(fmt.Sprintf("the content scanned exceeded --max-total-bytes=%d, the report is incomplete", manager.Opts.MaxTotalBytes))
+		return false
+	}
+	return true
+}
+
+// countFinding counts leak towards --max-findings and stops the scan once the limit is reached. It returns
+// false for leaks received past the limit, from scans still winding down, which are left out of the report.
+// Leaks of report-only rules don't fail the scan and aren't counted.
+func (manager *Manager) countFinding(leak Leak) bool {
+	if manager.Opts.MaxFindings <= 0 || leak.ReportOnly {
+		return true
+	}
+	if manager.findings >= manager.Opts.MaxFindings {
+		return false
+	}
+	manager.findings++
+	if manager.findings == manager.Opts.MaxFindings {
+		manager.Stop(fmt.Sprintf("%d leaks found, reaching --max-findings, more leaks may not be reported", manager.findings))
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// reportStream writes the leaks of the scan to --report in batches of --report-batch-size as they are received,
+// so scans finding many leaks don't keep them all until the end of the scan. The report is created with the
+// first batch, scans without leaks don't write one.
+type reportStream struct {
+	batch []Leak
+
+	file *os.File
+	// w buffers the writes to the report, encrypted is set with --encrypt-report and cw for csv reports
+	w         *bufio.Writer
+	encrypted io.WriteCloser
+	cw        *csv.Writer
+
+	written int
+	now     time.Time
+	err     error
+}
+
+// streamLeak adds leak to the batch of leaks to write to the report, writing the batch once it's full
+func (manager *Manager) streamLeak(leak Leak) {
+	stream := manager.stream
+	stream.batch = append(stream.batch, leak)
+	if len(stream.batch) >= manager.Opts.ReportBatch {
+		manager.flushBatch()
+	}
+}
+
+// flushBatch writes the batch of leaks to the report. A report that can't be written stops the scan, the error
+// is returned by closeReportStream.
+func (manager *Manager) flushBatch() {
+	stream := manager.stream
+	batch := stream.batch
+	stream.batch = stream.batch[:0]
+	if stream.err != nil || len(batch) == 0 {
+		return
+	}
+	if err := manager.writeBatch(batch); err != nil {
+		stream.err = err
+		manager.Stop(fmt.Sprintf("unable to write the report: %v", err))
+	}
+}
+
+func (manager *Manager) writeBatch(batch []Leak) error {
+	stream := manager.stream
+	if stream.file == nil {
+		if err := manager.openReportStream(); err != nil {
+			return err
+		}
+	}
+
+	// leaks are sorted within their batch, the order of the batches is the order the leaks were found in
+	sortLeaks(batch, manager.Opts.Sort)
+	for _, leak := range batch {
+		if manager.Opts.RedactReports && !manager.Opts.Redact {
+			leak = redactLeak(leak)
+		}
+		var err error
+		switch manager.Opts.ReportFormat {
+		case "json":
+			// leaks are written as the elements of the array written by writeReport
+			opening, indent := manager.jsonStreamArray()
+			separator := ",\n" + indent
+			if stream.written == 0 {
+				separator = opening + "\n" + indent
+			}
+			var b []byte
+			if b, err = json.MarshalIndent(leak, indent, " "); err == nil {
+				_, err = stream.w.WriteString(separator + string(b))
+			}
+		case "csv":
+			err = stream.cw.Write(manager.csvRecord(leak))
+		case "cef":
+			_, err = stream.w.WriteString(cefEvent(leak, stream.now))
+		}
+		if err != nil {
+			return err
+		}
+		stream.written++
+	}
+	if stream.cw != nil {
+		stream.cw.Flush()
+		if err := stream.cw.Error(); err != nil {
+			return err
+		}
+	}
+	return stream.w.Flush()
+}
+
+// jsonStreamArray returns the opening of the array of leaks of streamed json reports and the indent of its
+// elements, the array is the leaks of a jsonReport for scans that may stop early
+func (manager *Manager) jsonStreamArray() (string, string) {
+	if manager.mayStop() {
+		return "{\n \"leaks\": [", "  "
+	}
+	return "[", " "
+}
+
+// openReportStream creates the report leaks are streamed to
+func (manager *Manager) openReportStream() error {
+	stream := manager.stream
+	file, err := os.Create(manager.Opts.Report)
+	if err != nil {
+		return err
+	}
+	stream.file = file
+	var w io.Writer = file
+	if manager.reportKeys != nil {
+		if stream.encrypted, err = manager.encryptReport(file); err != nil {
+			return err
+		}
+		w = stream.encrypted
+	}
+	stream.w = bufio.NewWriter(w)
+	if manager.Opts.ReportFormat == "csv" {
+		stream.cw = csv.NewWriter(stream.w)
+		return stream.cw.Write(manager.csvHeader())
+	}
+	return nil
+}
+
+// closeReportStream writes the last batch of leaks once all leaks are received and finishes the report. It
+// returns false if the scan found no leaks and no report was written.
+func (manager *Manager) closeReportStream() (bool, error) {
+	manager.waitForLeaks()
+	manager.flushBatch()
+	stream := manager.stream
+	if stream.file == nil && (stream.err != nil || !manager.Stopped()) {
+		return false, stream.err
+	}
+	if stream.file == nil {
+		// the report of a scan stopped early without leaks is still written, to note that it was stopped
+		if err := manager.openReportStream(); err != nil {
+			return false, err
+		}
+	}
+	defer stream.file.Close()
+	if stream.err != nil {
+		return true, stream.err
+	}
+	switch manager.Opts.ReportFormat {
+	case "json":
+		opening, indent := manager.jsonStreamArray()
+		closing := ""
+		if stream.written == 0 {
+			closing = opening
+		}
+		closing += "\n" + indent[1:] + "]"
+		if manager.mayStop() {
+			if reason := manager.StopReason(); reason != "" {
+				truncated, _ := json.Marshal(reason)
+				closing += ",\n \"truncated\": " + string(truncated)
+			}
+			closing += "\n}"
+		}
+		if _, err := stream.w.WriteString(closing + "\n"); err != nil {
+			return true, err
+		}
+	case "csv":
+		if record := manager.csvStopRecord(); record != nil {
+			stream.cw.Write(record)
+			stream.cw.Flush()
+			if err := stream.cw.Error(); err != nil {
+				return true, err
+			}
+		}
+	case "cef":
+		if event := manager.cefStopEvent(stream.now); event != "" {
+			if _, err := stream.w.WriteString(event); err != nil {
+				return true, err
+			}
+		}
+	}
+	if err := stream.w.Flush(); err != nil {
+		return true, err
+	}
+	if stream.encrypted != nil {
+		if err := stream.encrypted.Close(); err != nil {
+			return true, err
+		}
+	}
+	return true, stream.file.Close()
+}
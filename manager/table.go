@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ansi escape codes of the colors of the table, see tableColumns
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+	ansiFaint  = "\x1b[2m"
+)
+
+// tableColumn is a column of the leak table, color is the ansi escape code its cells are printed in
+type tableColumn struct {
+	header string
+	color  string
+	cell   func(leak Leak) string
+}
+
+var tableColumns = []tableColumn{
+	{"RULE", ansiRed, func(leak Leak) string { return leak.Rule }},
+	{"LOCATION", ansiCyan, func(leak Leak) string { return leak.File + ":" + strconv.Itoa(leak.LineNumber) }},
+	{"COMMIT", ansiYellow, func(leak Leak) string { return ShortSha(leak.Commit) }},
+	{"SECRET", ansiFaint, func(leak Leak) string { return MaskSecret(leak.Offender) }},
+}
+
+// removedColumns are the columns of the table of removed-not-rotated leaks, the commit is the one that removed
+// the secret
+var removedColumns = append(append([]tableColumn(nil), tableColumns...),
+	tableColumn{"INTRODUCED", ansiYellow, func(leak Leak) string { return ShortSha(leak.IntroducedCommit) }})
+
+// writeTable writes the leaks of the scan as a table to w, the output of scans without --report. Secrets are
+// masked so the table can be shared, the report has them in full. Cells are colored unless color is false.
+// Leaks in removed lines are listed in a table of their own after the others, see CategoryRemovedNotRotated.
+func (manager *Manager) writeTable(w io.Writer, color bool) error {
+	var leaks, removed []Leak
+	for _, leak := range manager.GetLeaks() {
+		if leak.Category == CategoryRemovedNotRotated {
+			removed = append(removed, leak)
+		} else {
+			leaks = append(leaks, leak)
+		}
+	}
+	if len(leaks) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	if len(leaks) != 0 {
+		if err := writeLeakTable(w, leaks, tableColumns, color); err != nil {
+			return err
+		}
+	}
+	if len(removed) != 0 {
+		heading := "REMOVED, NOT ROTATED: these secrets were deleted but are still in the history, rotate them"
+		if color {
+			heading = ansiBold + heading + ansiReset
+		}
+		if len(leaks) != 0 {
+			heading = "\n" + heading
+		}
+		if _, err := io.WriteString(w, heading+"\n"); err != nil {
+			return err
+		}
+		if err := writeLeakTable(w, removed, removedColumns, color); err != nil {
+			return err
+		}
+	}
+	if reason := manager.StopReason(); reason != "" {
+		_, err := fmt.Fprintf(w, "the scan was stopped early: %s\n", reason)
+		return err
+	}
+	return nil
+}
+
+// writeLeakTable writes leaks as a table of columns to w
+func writeLeakTable(w io.Writer, leaks []Leak, columns []tableColumn, color bool) error {
+	rows := make([][]string, len(leaks))
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(column.header)
+	}
+	for i, leak := range leaks {
+		rows[i] = make([]string, len(columns))
+		for j, column := range columns {
+			rows[i][j] = column.cell(leak)
+			if n := utf8.RuneCountInString(rows[i][j]); n > widths[j] {
+				widths[j] = n
+			}
+		}
+	}
+
+	// the escape codes take no room on the terminal, so cells are padded to the width of the column before they
+	// are colored
+	writeRow := func(cells []string, colorOf func(column tableColumn) string) error {
+		var b strings.Builder
+		for i, cell := range cells {
+			if i != 0 {
+				b.WriteString("  ")
+			}
+			if i != len(cells)-1 {
+				cell += strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			}
+			if color {
+				b.WriteString(colorOf(columns[i]) + cell + ansiReset)
+			} else {
+				b.WriteString(cell)
+			}
+		}
+		b.WriteString("\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.header
+	}
+	if err := writeRow(headers, func(tableColumn) string { return ansiBold }); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writeRow(row, func(column tableColumn) string { return column.color }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
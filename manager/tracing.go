@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v6/options"
+	"github.com/zricethezav/gitleaks/v6/version"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracerName is the instrumentation scope of gitleaks' spans
+const tracerName = "github.com/zricethezav/gitleaks"
+
+// newTracerProvider returns the tracer provider exporting spans to the OTLP/HTTP endpoint set by --otlp-endpoint,
+// or nil if tracing is disabled. The headers of OTEL_EXPORTER_OTLP_HEADERS are sent with every export, and the
+// certificates of --ca-cert and --client-cert are used for https endpoints.
+func newTracerProvider(opts options.Options, client *http.Client) (*sdktrace.TracerProvider, error) {
+	endpoint := options.GetOTLPEndpoint(opts)
+	if endpoint == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid --otlp-endpoint %q, must be a url like http://localhost:4318", endpoint)
+	}
+	exporterOpts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + "/v1/traces"),
+	}
+	if u.Scheme == "http" {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithInsecure())
+	} else if tlsConfig := clientTLSConfig(client); tlsConfig != nil {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "gitleaks"),
+			attribute.String("service.version", version.Version),
+		)),
+	), nil
+}
+
+// shutdownTracing exports the spans that haven't been exported yet. Spans that can't be exported don't
+// fail the scan.
+func (manager *Manager) shutdownTracing() {
+	if manager.tracerProvider == nil {
+		return
+	}
+	if err := manager.tracerProvider.Shutdown(context.Background()); err != nil {
+		log.Warnf("unable to export traces: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package manager
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Trend counts the leaks of a repo and rule found by a scan run against the previous run of the same target.
+// New leaks weren't found by the previous run, resolved leaks were found by the previous run but not this
+// one and persisting leaks were found by both. The first run of a target only has new leaks.
+type Trend struct {
+	Run        int64     `json:"run"`
+	Time       time.Time `json:"time"`
+	Target     string    `json:"target"`
+	Repo       string    `json:"repo"`
+	Rule       string    `json:"rule"`
+	New        int       `json:"new"`
+	Resolved   int       `json:"resolved"`
+	Persisting int       `json:"persisting"`
+}
+
+// trendKey identifies the leaks a trend counts
+type trendKey struct {
+	repo, rule string
+}
+
+// Trends reads the scan runs of the sqlite database at path, written with --report-format=sqlite, and returns
+// the trends of every run, oldest run first. Runs only compare to runs of the same target, and leaks are told
+// apart by their fingerprints. Runs that only scan new commits, like the runs of the daemon, never find the
+// leaks of earlier runs again, so their leaks are new or resolved but not persisting.
+func Trends(path string) ([]Trend, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	type run struct {
+		id       int64
+		time     time.Time
+		target   string
+		leaks    map[trendKey]map[string]bool
+		previous *run
+	}
+	var runs []*run
+	byID := make(map[int64]*run)
+	last := make(map[string]*run)
+
+	rows, err := db.Query(`SELECT id, finished_at, target FROM scan_runs ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read scan runs of %s: %v", path, err)
+	}
+	for rows.Next() {
+		r := &run{leaks: make(map[trendKey]map[string]bool)}
+		if err := rows.Scan(&r.id, &r.time, &r.target); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.previous = last[r.target]
+		last[r.target] = r
+		runs = append(runs, r)
+		byID[r.id] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT run_id, repo, rule, fingerprint FROM leaks`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read leaks of %s: %v", path, err)
+	}
+	for rows.Next() {
+		var (
+			runID                   int64
+			repo, rule, fingerprint string
+		)
+		if err := rows.Scan(&runID, &repo, &rule, &fingerprint); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r, ok := byID[runID]
+		if !ok {
+			continue
+		}
+		key := trendKey{repo, rule}
+		if r.leaks[key] == nil {
+			r.leaks[key] = make(map[string]bool)
+		}
+		r.leaks[key][fingerprint] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var trends []Trend
+	for _, r := range runs {
+		var previous map[trendKey]map[string]bool
+		if r.previous != nil {
+			previous = r.previous.leaks
+		}
+		keys := make(map[trendKey]bool)
+		for key := range r.leaks {
+			keys[key] = true
+		}
+		for key := range previous {
+			keys[key] = true
+		}
+
+		var runTrends []Trend
+		for key := range keys {
+			t := Trend{Run: r.id, Time: r.time, Target: r.target, Repo: key.repo, Rule: key.rule}
+			for fingerprint := range r.leaks[key] {
+				if previous[key][fingerprint] {
+					t.Persisting++
+				} else {
+					t.New++
+				}
+			}
+			for fingerprint := range previous[key] {
+				if !r.leaks[key][fingerprint] {
+					t.Resolved++
+				}
+			}
+			runTrends = append(runTrends, t)
+		}
+		sort.Slice(runTrends, func(i, j int) bool {
+			if runTrends[i].Repo != runTrends[j].Repo {
+				return runTrends[i].Repo < runTrends[j].Repo
+			}
+			return runTrends[i].Rule < runTrends[j].Rule
+		})
+		trends = append(trends, runTrends...)
+	}
+	return trends, nil
+}
+
+// WriteTrends writes trends as a table, or as json if format is json, with the times of the runs in loc. Tables
+// default to the local timezone.
+func WriteTrends(w io.Writer, trends []Trend, format string, loc *time.Location) error {
+	if format == "json" {
+		report := make([]Trend, len(trends))
+		for i, t := range trends {
+			if loc != nil {
+				t.Time = t.Time.In(loc)
+			}
+			report[i] = t
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", " ")
+		return encoder.Encode(report)
+	}
+
+	if loc == nil {
+		loc = time.Local
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tTIME\tTARGET\tREPO\tRULE\tNEW\tRESOLVED\tPERSISTING")
+	for _, t := range trends {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n", t.Run, t.Time.In(loc).Format(time.RFC3339),
+			t.Target, t.Repo, t.Rule, t.New, t.Resolved, t.Persisting)
+	}
+	return tw.Flush()
+}
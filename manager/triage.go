@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Verdicts of triaged leaks, recorded with `gitleaks mark`. Leaks marked as false positives are reported as
+// report-only by scans with --triage-store, or left out with --suppress-fp.
+const (
+	VerdictFalsePositive = "fp"
+	VerdictTruePositive  = "tp"
+)
+
+// TriageStore is the store of the verdicts of triaged leaks (--triage-store), a json file of the verdicts by
+// the fingerprints of their leaks. Fingerprints leave the commit out so a false positive stays one in the
+// commits after the one it was marked in.
+type TriageStore struct {
+	path string
+
+	// Key is the secret key of the HMACs fingerprints are, generated with the store. Fingerprints are written
+	// to reports, redacted or not, so they can't be the plain hash of the secret anyone could confirm a
+	// guessed secret with.
+	Key      string                   `json:"key"`
+	Verdicts map[string]TriageVerdict `json:"verdicts"`
+}
+
+// TriageVerdict is the verdict of a leak. The rule, file and offender of the leak are recorded when the leak is
+// marked from a report, false positives without an offender can't be exported to the allowlist.
+type TriageVerdict struct {
+	Verdict  string    `json:"verdict"`
+	Rule     string    `json:"rule,omitempty"`
+	File     string    `json:"file,omitempty"`
+	Offender string    `json:"offender,omitempty"`
+	MarkedAt time.Time `json:"markedAt"`
+}
+
+// LoadTriageStore reads the triage store at path. A store that doesn't exist yet is created with a new key, so
+// the fingerprints of the leaks of the scan creating it are those they are marked by.
+func LoadTriageStore(path string) (*TriageStore, error) {
+	store := &TriageStore{path: path, Verdicts: make(map[string]TriageVerdict)}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	} else if err == nil {
+		if err := json.Unmarshal(b, store); err != nil {
+			return nil, fmt.Errorf("unable to read triage store %s: %v", path, err)
+		}
+		if store.Verdicts == nil {
+			store.Verdicts = make(map[string]TriageVerdict)
+		}
+	}
+	if store.Key == "" {
+		if err := store.generateKey(); err != nil {
+			return nil, err
+		}
+		if err := store.Save(); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// generateKey generates the key of a new store, or of a store written before stores had keys. The verdicts of
+// those stores are moved to the fingerprints of the leak recorded with them, verdicts marked without
+// --from-report can't be and are left to mark again.
+func (store *TriageStore) generateKey() error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	store.Key = hex.EncodeToString(key)
+
+	verdicts := make(map[string]TriageVerdict, len(store.Verdicts))
+	for fingerprint, v := range store.Verdicts {
+		if v.Offender == "" {
+			log.Warnf("verdict of %s in %s was marked without --from-report, mark it again", fingerprint, store.path)
+			verdicts[fingerprint] = v
+			continue
+		}
+		verdicts[store.fingerprint(v.Rule, v.File, v.Offender)] = v
+	}
+	store.Verdicts = verdicts
+	return nil
+}
+
+// Mark records verdict for the leak of fingerprint, or removes its verdict if verdict is "clear". leak is the
+// leak of fingerprint read from a report, or nil if it wasn't.
+func (store *TriageStore) Mark(fingerprint, verdict string, leak *Leak) {
+	if verdict == "clear" {
+		delete(store.Verdicts, fingerprint)
+		return
+	}
+	v := TriageVerdict{Verdict: verdict, MarkedAt: time.Now().UTC()}
+	if leak != nil {
+		v.Rule, v.File, v.Offender = leakRuleID(*leak), leak.File, leak.Offender
+	} else if previous, ok := store.Verdicts[fingerprint]; ok {
+		v.Rule, v.File, v.Offender = previous.Rule, previous.File, previous.Offender
+	}
+	store.Verdicts[fingerprint] = v
+}
+
+// Save writes the store back to its file
+func (store *TriageStore) Save() error {
+	b, err := json.MarshalIndent(store, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(store.path, b, 0644)
+}
+
+// ExportAllowlist returns a config of the global allowlist entries allowlisting the offenders of the false
+// positives of the store, to add to the config scans run with
+func (store *TriageStore) ExportAllowlist() ([]byte, error) {
+	var fingerprints []string
+	for fingerprint, v := range store.Verdicts {
+		// verdicts marked from redacted reports by earlier versions would allowlist REDACTED
+		if v.Verdict == VerdictFalsePositive && v.Offender != "" && !strings.Contains(v.Offender, redacted) {
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+	sort.Strings(fingerprints)
+	cfg := config.Config{Allowlist: config.AllowList{Description: "false positives marked with gitleaks mark"}}
+	for _, fingerprint := range fingerprints {
+		re := regexp.MustCompile(regexp.QuoteMeta(store.Verdicts[fingerprint].Offender))
+		cfg.Allowlist.Regexes = append(cfg.Allowlist.Regexes, re)
+	}
+	return config.Export(cfg)
+}
+
+// fingerprint returns the fingerprint the leaks of rule with secret in file are triaged by, the HMAC of the
+// three keyed with the key of the store
+func (store *TriageStore) fingerprint(rule, file, secret string) string {
+	mac := hmac.New(sha256.New, []byte(store.Key))
+	mac.Write([]byte(rule + "\x00" + file + "\x00" + secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// applyVerdict sets the verdict of the triage store on leak, returning false if the leak is a false positive to
+// leave out with --suppress-fp or to report as suppressed with --sarif-suppressions. False positives are
+// reported as report-only otherwise.
+func (manager *Manager) applyVerdict(leak *Leak) bool {
+	v, ok := manager.triage.Verdicts[leak.Fingerprint]
+	if !ok {
+		return true
+	}
+	leak.Verdict = v.Verdict
+	if v.Verdict != VerdictFalsePositive {
+		return true
+	}
+	if manager.Opts.SarifSuppress {
+		manager.suppressed = append(manager.suppressed, *leak)
+		return false
+	}
+	if manager.Opts.SuppressFP {
+		return false
+	}
+	leak.ReportOnly = true
+	return true
+}
+
+// suppressedLeaks returns the false positives reported as suppressed with --sarif-suppressions, sorted and
+// redacted like the leaks of reports
+func (manager *Manager) suppressedLeaks() []Leak {
+	manager.waitForLeaks()
+	sortLeaks(manager.suppressed, manager.Opts.Sort)
+	return manager.redactReport(manager.suppressed)
+}
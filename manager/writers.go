@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"io"
+	"sort"
+	"sync"
+)
+
+// ReportWriter writes the report of a scan in a --report-format. Applications embedding gitleaks add formats
+// of their own, like the schemas of their organization, with RegisterReportWriter.
+type ReportWriter interface {
+	// WriteReport writes the report of the leaks of the scan of m to w
+	WriteReport(m *Manager, w io.Writer) error
+}
+
+// ReportWriterFunc is a function writing the report of a scan as a ReportWriter
+type ReportWriterFunc func(m *Manager, w io.Writer) error
+
+// WriteReport calls f(m, w)
+func (f ReportWriterFunc) WriteReport(m *Manager, w io.Writer) error {
+	return f(m, w)
+}
+
+// reportWriters holds the writers of the report formats by format, the built-in formats and the formats
+// registered with RegisterReportWriter. sqlite reports are databases updated in place, not written by a
+// ReportWriter unless one is registered for sqlite. registered holds the formats registered with
+// RegisterReportWriter.
+var (
+	reportWriters = map[string]ReportWriter{
+		"json":            ReportWriterFunc((*Manager).writeJSON),
+		"json-by-repo":    ReportWriterFunc((*Manager).writeReposJSON),
+		"heatmap":         ReportWriterFunc((*Manager).writeHeatmapJSON),
+		"heatmap-html":    ReportWriterFunc((*Manager).writeHeatmapHTML),
+		"html":            ReportWriterFunc((*Manager).writeHTML),
+		"defectdojo":      ReportWriterFunc((*Manager).writeDefectDojo),
+		"ocsf":            ReportWriterFunc((*Manager).writeOCSF),
+		"cef":             ReportWriterFunc((*Manager).writeCEF),
+		"csv":             ReportWriterFunc((*Manager).writeCSV),
+		"sarif":           ReportWriterFunc((*Manager).writeSarif),
+		"github-actions":  ReportWriterFunc((*Manager).writeGithubActions),
+		"teamcity":        ReportWriterFunc((*Manager).writeTeamCity),
+		"azure-pipelines": ReportWriterFunc((*Manager).writeAzurePipelines),
+	}
+	registered       = make(map[string]bool)
+	reportWritersMux sync.RWMutex
+)
+
+// RegisterReportWriter registers writer as the writer of --report-format=format. Registering a format that's
+// already registered replaces its writer, built-in formats included.
+func RegisterReportWriter(format string, writer ReportWriter) {
+	reportWritersMux.Lock()
+	reportWriters[format] = writer
+	registered[format] = true
+	reportWritersMux.Unlock()
+}
+
+// ReportFormats returns the report formats with a registered writer, sorted
+func ReportFormats() []string {
+	reportWritersMux.RLock()
+	defer reportWritersMux.RUnlock()
+	formats := make([]string, 0, len(reportWriters))
+	for format := range reportWriters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// isRegistered returns whether a writer was registered for format with RegisterReportWriter, replacing how
+// gitleaks writes it
+func isRegistered(format string) bool {
+	reportWritersMux.RLock()
+	defer reportWritersMux.RUnlock()
+	return registered[format]
+}
+
+// reportWriter returns the writer registered for format
+func reportWriter(format string) (ReportWriter, bool) {
+	reportWritersMux.RLock()
+	defer reportWritersMux.RUnlock()
+	writer, ok := reportWriters[format]
+	return writer, ok
+}
@@ -0,0 +1,46 @@
+package options
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// CredentialHelperAuth asks the git credential helpers configured on this system for the credentials
+// of the http(s) url, the same way `git clone` would. Prompting is disabled so a missing credential
+// results in an error instead of blocking the scan.
+func CredentialHelperAuth(url string) (*http.BasicAuth, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("url=%s\n\n", url))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git credential helper has no credentials for %s: %v %s", url, err, strings.TrimSpace(stderr.String()))
+	}
+
+	auth := &http.BasicAuth{}
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "username":
+			auth.Username = kv[1]
+		case "password":
+			auth.Password = kv[1]
+		}
+	}
+	if auth.Password == "" {
+		return nil, fmt.Errorf("git credential helper has no credentials for %s", url)
+	}
+	return auth, nil
+}
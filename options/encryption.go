@@ -0,0 +1,78 @@
+package options
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// ReportKeys returns the public keys set by --encrypt-report that reports are encrypted to, or nil if reports
+// aren't encrypted. --encrypt-report is gpg: followed by the path of an armored or binary public key file,
+// every key of the file is a recipient.
+func (opts Options) ReportKeys() (openpgp.EntityList, error) {
+	if opts.EncryptReport == "" {
+		return nil, nil
+	}
+	return readKeyRing("--encrypt-report", opts.EncryptReport)
+}
+
+// SigningKey returns the private key set by --sign-report that reports are signed with, or nil if reports aren't
+// signed. --sign-report is gpg: followed by the path of an armored or binary private key file, the first private
+// key of the file signs. Keys protected by a passphrase are decrypted with GITLEAKS_SIGNING_KEY_PASSPHRASE.
+func (opts Options) SigningKey() (*openpgp.Entity, error) {
+	if opts.SignReport == "" {
+		return nil, nil
+	}
+	keys, err := readKeyRing("--sign-report", opts.SignReport)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.PrivateKey == nil {
+			continue
+		}
+		if key.PrivateKey.Encrypted {
+			passphrase := os.Getenv("GITLEAKS_SIGNING_KEY_PASSPHRASE")
+			if passphrase == "" {
+				return nil, fmt.Errorf("the key of --sign-report is protected by a passphrase, set GITLEAKS_SIGNING_KEY_PASSPHRASE")
+			}
+			if err := key.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("unable to decrypt the key of --sign-report: %v", err)
+			}
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("no private key found in --sign-report %s", strings.TrimPrefix(opts.SignReport, "gpg:"))
+}
+
+// PolicyKeys returns the public keys set by --policy-key that policy bundles must be signed by
+func (opts Options) PolicyKeys() (openpgp.EntityList, error) {
+	return readKeyRing("--policy-key", opts.PolicyKey)
+}
+
+// readKeyRing reads the keys of the file set by flag, as gpg: followed by the path of an armored or binary key file
+func readKeyRing(flag, value string) (openpgp.EntityList, error) {
+	path := strings.TrimPrefix(value, "gpg:")
+	if path == value || path == "" {
+		return nil, fmt.Errorf("invalid %s %q, must be gpg: followed by the path of a key file", flag, value)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+	if err != nil {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the keys of %s %s: %v", flag, path, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found in %s %s", flag, path)
+	}
+	return keys, nil
+}
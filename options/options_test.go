@@ -1 +1,184 @@
 package options
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPClient(t *testing.T) {
+	client, err := Options{}.HTTPClient()
+	if client != nil || err != nil {
+		t.Errorf("expected the default client without transport options, got %v %v", client, err)
+	}
+
+	client, err = Options{Proxy: "socks5://localhost:1080"}.HTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "https://github.com", nil)
+	proxyURL, err := client.Transport.(*http.Transport).Proxy(req)
+	if err != nil || proxyURL.String() != "socks5://localhost:1080" {
+		t.Errorf("expected requests to go through socks5://localhost:1080, got %v %v", proxyURL, err)
+	}
+
+	if _, err := (Options{Proxy: "ftp://localhost"}).HTTPClient(); err == nil {
+		t.Error("expected an error for an unsupported proxy scheme")
+	}
+
+	dir, err := ioutil.TempDir("", "gitleaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caCert := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caCert, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Options{CACert: caCert}).HTTPClient(); err == nil {
+		t.Error("expected an error for a ca-cert without certificates")
+	}
+}
+
+func TestCredentialHelperAuth(t *testing.T) {
+	home, err := ioutil.TempDir("", "gitleaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	gitconfig := "[credential]\n\thelper = \"!f() { echo username=gitleaks; echo password=secret; }; f\"\n"
+	if err := ioutil.WriteFile(filepath.Join(home, ".gitconfig"), []byte(gitconfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	auth, err := CredentialHelperAuth("https://github.com/zricethezav/gitleaks.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.Username != "gitleaks" || auth.Password != "secret" {
+		t.Errorf("expected credentials gitleaks:secret, got %s:%s", auth.Username, auth.Password)
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	tests := []struct {
+		sample  string
+		rate    float64
+		wantErr bool
+	}{
+		{sample: "", rate: 1},
+		{sample: "1/10", rate: 0.1},
+		{sample: "1/1", rate: 1},
+		{sample: "25%", rate: 0.25},
+		{sample: "0.5%", rate: 0.005},
+		{sample: "0%", wantErr: true},
+		{sample: "150%", wantErr: true},
+		{sample: "1/0", wantErr: true},
+		{sample: "10", wantErr: true},
+	}
+	for _, test := range tests {
+		rate, err := Options{Sample: test.sample}.SampleRate()
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("expected an error for --sample=%s", test.sample)
+			}
+			continue
+		}
+		if err != nil || rate != test.rate {
+			t.Errorf("expected --sample=%s to sample %v, got %v %v", test.sample, test.rate, rate, err)
+		}
+	}
+}
+
+func TestParseThreads(t *testing.T) {
+	tests := []struct {
+		threads string
+		want    int
+		auto    bool
+		wantErr bool
+	}{
+		{threads: ""},
+		{threads: "4", want: 4},
+		{threads: "auto", auto: true},
+		{threads: "-1", wantErr: true},
+		{threads: "many", wantErr: true},
+	}
+	for _, test := range tests {
+		opts := Options{ThreadsOpt: test.threads}
+		err := opts.parseThreads()
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("expected an error for --threads=%s", test.threads)
+			}
+			continue
+		}
+		if err != nil || opts.Threads != test.want || opts.AutoThreads != test.auto {
+			t.Errorf("expected --threads=%s to set %d threads, auto %v, got %d %v %v",
+				test.threads, test.want, test.auto, opts.Threads, opts.AutoThreads, err)
+		}
+	}
+}
+
+func TestReportLocation(t *testing.T) {
+	if loc, err := (Options{}).ReportLocation(); loc != nil || err != nil {
+		t.Errorf("expected no timezone without --report-timezone, got %v %v", loc, err)
+	}
+	if loc, err := (Options{ReportTZ: "UTC"}).ReportLocation(); err != nil || loc.String() != "UTC" {
+		t.Errorf("expected UTC, got %v %v", loc, err)
+	}
+	if loc, err := (Options{ReportTZ: "Europe/Berlin"}).ReportLocation(); err != nil || loc.String() != "Europe/Berlin" {
+		t.Errorf("expected Europe/Berlin, got %v %v", loc, err)
+	}
+	if err := (Options{ReportTZ: "Mars/Olympus_Mons"}).Guard(); err == nil {
+		t.Error("expected an error for an unknown timezone")
+	}
+}
+
+func TestRepoConfigAllow(t *testing.T) {
+	opts := Options{RepoConfig: true, RepoCfgAllow: "rules, allowlist-paths"}
+	if err := opts.Guard(); err != nil {
+		t.Fatal(err)
+	}
+	if allowed := opts.RepoConfigAllowed(); len(allowed) != 2 || allowed[1] != "allowlist-paths" {
+		t.Errorf("expected rules and allowlist-paths, got %v", allowed)
+	}
+	if err := (Options{RepoConfig: true, RepoCfgAllow: "everything"}).Guard(); err == nil {
+		t.Error("expected an error for an unknown change")
+	}
+	if err := (Options{RepoCfgAllow: "rules"}).Guard(); err == nil {
+		t.Error("expected --repo-config-allow to require --repo-config")
+	}
+}
+
+func TestSkipFiles(t *testing.T) {
+	opts := Options{SkipExtension: "png, .MIN.JS,lock", SkipMIME: "image,font"}
+	if err := opts.Guard(); err != nil {
+		t.Fatal(err)
+	}
+	for path, skipped := range map[string]bool{
+		"assets/logo.PNG":     true,
+		"dist/app.min.js":     true,
+		"yarn.lock":           true,
+		"src/app.js":          false,
+		"docs/png":            false,
+		"config/unlock.toml":  false,
+		"dist/app.min.js.map": false,
+	} {
+		if opts.SkipsExtension(path) != skipped {
+			t.Errorf("%s: expected skipped %v", path, skipped)
+		}
+	}
+	if kinds := opts.SkippedMIME(); len(kinds) != 2 || kinds[1] != "font" {
+		t.Errorf("expected image and font, got %v", kinds)
+	}
+	if err := (Options{SkipMIME: "image,spreadsheet"}).Guard(); err == nil {
+		t.Error("expected an error for an unknown kind")
+	}
+}
@@ -0,0 +1,91 @@
+package options
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// customTransport returns true if any option requires a custom http transport
+func (opts Options) customTransport() bool {
+	return opts.Proxy != "" || opts.CACert != "" || opts.ClientCert != ""
+}
+
+// HTTPClient returns the http client used for cloning over http(s) and for calls to host apis. It routes
+// requests through --proxy, trusts --ca-cert in addition to the system roots and presents --client-cert.
+// nil is returned if none of these options are set, in which case the default client is used, which
+// honors the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func (opts Options) HTTPClient() (*http.Client, error) {
+	if !opts.customTransport() {
+		return nil, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --proxy %q: %v", opts.Proxy, err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("invalid --proxy %q, supported schemes: http, https, socks5", opts.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{}
+	if opts.CACert != "" {
+		pem, err := ioutil.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, err
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in --ca-cert %s", opts.CACert)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if opts.ClientCert != "" {
+		keyFile := opts.ClientKey
+		if keyFile == "" {
+			// the key may be part of the certificate file
+			keyFile = opts.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load --client-cert: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// GitConfig returns the git config equivalent to the transport options for commands run with the git binary.
+// git trusts only the certificates of http.sslCAInfo so the CA file should include the public roots when
+// the git binary is used, for example by --partial-clone.
+func (opts Options) GitConfig() map[string]string {
+	config := make(map[string]string)
+	if opts.Proxy != "" {
+		config["http.proxy"] = opts.Proxy
+	}
+	if opts.CACert != "" {
+		config["http.sslCAInfo"] = opts.CACert
+	}
+	if opts.ClientCert != "" {
+		config["http.sslCert"] = opts.ClientCert
+		config["http.sslKey"] = opts.ClientCert
+		if opts.ClientKey != "" {
+			config["http.sslKey"] = opts.ClientKey
+		}
+	}
+	return config
+}
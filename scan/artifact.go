@@ -0,0 +1,249 @@
+package scan
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	log "github.com/sirupsen/logrus"
+)
+
+// The decompressed size of the files of artifacts is limited so archives that decompress to much more than their
+// size, like zip bombs, can't exhaust the memory of gitleaks. Nested archives count against the limits of the
+// artifact.
+var (
+	// artifactMaxFileSize is the size of the largest file of an artifact that is scanned, larger files are skipped
+	artifactMaxFileSize int64 = 100 * 1024 * 1024
+	// artifactMaxSize is the total size of the files of an artifact, the scan fails once it's exceeded
+	artifactMaxSize int64 = 1024 * 1024 * 1024
+)
+
+// artifactScanner scans the files of a package artifact (--artifact), like an npm tarball or a python wheel
+type artifactScanner struct {
+	repo *Repo
+
+	// size is the decompressed size of the files read from the artifact so far
+	size int64
+
+	semaphore chan bool
+	wg        sync.WaitGroup
+}
+
+// scanArtifact scans the files packed in the artifact file (--artifact). npm tarballs, python sdists and other tar,
+// tar.gz and tgz archives are read as well as zip archives like wheels and eggs. Leaks are reported by their path
+// in the package, without the top directory npm and sdist archives pack every file in.
+func (repo *Repo) scanArtifact(artifact string) error {
+	if err := repo.setupTimeout(); err != nil {
+		return err
+	}
+	if repo.cancel != nil {
+		defer repo.cancel()
+	}
+	scanTimeStart := time.Now()
+
+	f, err := os.Open(artifact)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	s := &artifactScanner{
+		repo:      repo,
+		semaphore: make(chan bool, howManyThreads(repo.Manager.Opts.Threads, repo.Manager.Opts.AutoThreads)),
+	}
+	err = s.scanArchive(f, info.Size(), "", 0)
+	s.wg.Wait()
+
+	repo.Manager.RecordTime(manager.ScanTime(howLong(scanTimeStart)))
+	if err != nil {
+		return fmt.Errorf("unable to read artifact %s: %v", artifact, err)
+	}
+	return nil
+}
+
+// scanArchive scans the files of the archive of size bytes read from ra. Archives nested in it, like the jars of a
+// war, are scanned too down to --artifact-depth levels, their files reported by paths like
+// WEB-INF/lib/app.jar!/config.properties. prefix is the path of a nested archive and depth how deep it is nested.
+// The artifact itself is read as it's walked, only its files and nested archives are read into memory.
+func (s *artifactScanner) scanArchive(ra io.ReaderAt, size int64, prefix string, depth int) error {
+	// the top directory is left out of the paths of leaks if every file is in it. Only the names of the files
+	// are read to find it.
+	var top string
+	if prefix == "" {
+		first := true
+		err := walkArchive(ra, size, func(name string, _ int64, _ io.Reader) error {
+			dir := ""
+			if i := strings.Index(name, "/"); i != -1 {
+				dir = name[:i+1]
+			}
+			if first {
+				top, first = dir, false
+			} else if dir != top {
+				top = ""
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return walkArchive(ra, size, func(name string, size int64, r io.Reader) error {
+		if s.repo.timeoutReached() {
+			return errStopWalk
+		}
+		rel := prefix + strings.TrimPrefix(name, top)
+		if size > artifactMaxFileSize {
+			log.Warnf("skipping %s, it's larger than %d bytes", rel, artifactMaxFileSize)
+			return nil
+		}
+		if s.size += size; s.size > artifactMaxSize {
+			return errArtifactTooLarge
+		}
+		// zip and tar readers fail on entries larger than their headers say, the limit only guards against
+		// readers that don't
+		content, err := ioutil.ReadAll(io.LimitReader(r, size))
+		if err != nil {
+			return err
+		}
+		if depth < s.repo.Manager.Opts.ArtifactDepth && isArchive(content) {
+			err := s.scanArchive(bytes.NewReader(content), int64(len(content)), rel+"!/", depth+1)
+			if err == errArtifactTooLarge {
+				return err
+			} else if err != nil {
+				// a file that only looks like an archive is scanned as is
+				log.Debugf("unable to read nested archive %s, scanning it as a file: %v", rel, err)
+				s.scanFile(rel, content)
+			}
+			return nil
+		}
+		s.scanFile(rel, content)
+		return nil
+	})
+}
+
+// scanFile scans the content of the file of the archive at path rel
+func (s *artifactScanner) scanFile(rel string, content []byte) {
+	if s.repo.skipPath(rel) || s.repo.skipContent(rel, sniffHead(content), false) {
+		return
+	}
+	s.wg.Add(1)
+	s.semaphore <- true
+	go func() {
+		defer func() {
+			<-s.semaphore
+			s.wg.Done()
+		}()
+		c := emptyCommit()
+		c.Message = "***ARTIFACT***"
+		s.repo.CheckRules(&Bundle{
+			Content:   string(content),
+			FilePath:  rel,
+			Commit:    c,
+			Operation: fdiff.Add,
+			scanType:  uncommittedScan,
+			startLine: 1,
+		})
+	}()
+}
+
+// errStopWalk stops walkArchive without an error
+var errStopWalk = errors.New("stop walking the archive")
+
+// errArtifactTooLarge is returned when the files of an artifact exceed artifactMaxSize
+var errArtifactTooLarge = errors.New("its files are larger than the decompressed size limit of artifacts")
+
+// walkArchive calls fn with the name, size and content of every regular file of the zip, tar or gzipped tar
+// archive of size bytes read from ra
+func walkArchive(ra io.ReaderAt, size int64, fn func(name string, size int64, r io.Reader) error) error {
+	err := walkArchiveFiles(ra, size, fn)
+	if err == errStopWalk {
+		return nil
+	}
+	return err
+}
+
+// isArchive reports whether b starts like a zip, gzip or tar archive, which jars, wars, ears and wheels are
+func isArchive(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("PK\x03\x04")) || bytes.HasPrefix(b, []byte("PK\x05\x06")) ||
+		bytes.HasPrefix(b, []byte{0x1f, 0x8b}) || (len(b) > 262 && string(b[257:262]) == "ustar")
+}
+
+func walkArchiveFiles(ra io.ReaderAt, size int64, fn func(name string, size int64, r io.Reader) error) error {
+	head := make([]byte, 263)
+	n, err := ra.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	b := head[:n]
+	switch {
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")), bytes.HasPrefix(b, []byte("PK\x05\x06")):
+		zr, err := zip.NewReader(ra, size)
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = fn(cleanArchivePath(f.Name), int64(f.UncompressedSize64), rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(io.NewSectionReader(ra, 0, size))
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return walkTar(tar.NewReader(gz), fn)
+	case len(b) > 262 && string(b[257:262]) == "ustar":
+		return walkTar(tar.NewReader(io.NewSectionReader(ra, 0, size)), fn)
+	}
+	return fmt.Errorf("not a zip, tar or tar.gz archive")
+}
+
+func walkTar(tr *tar.Reader, fn func(name string, size int64, r io.Reader) error) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err := fn(cleanArchivePath(hdr.Name), hdr.Size, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// cleanArchivePath returns the slash separated path of an archive entry, relative to the archive root
+func cleanArchivePath(name string) string {
+	return path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))[1:]
+}
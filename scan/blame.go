@@ -0,0 +1,189 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+// blameLine is a line of a blamed file and the commit that last changed it
+type blameLine struct {
+	hash plumbing.Hash
+	text string
+}
+
+// blameLeak attributes a leak found by scanning a whole file, with --files-at-commit, --files-at-head or the
+// uncommitted changes of a repo, to the commit that last changed its line (--blame), setting the commit, author,
+// date and message of the leak to that commit's. Leaks found at a commit are blamed at that commit, leaks found
+// in the worktree at HEAD, looking up their line by its text. Lines that aren't committed yet keep the empty
+// commit they were found with. It returns the commit the leak is attributed to.
+func (repo *Repo) blameLeak(leak *manager.Leak, bundle *Bundle) *object.Commit {
+	if !repo.Manager.Opts.Blame || repo.Repository == nil || bundle.scanType == patchScan || leak.LineNumber < 1 {
+		return bundle.Commit
+	}
+	rev := "HEAD"
+	if !bundle.Commit.Hash.IsZero() {
+		rev = bundle.Commit.Hash.String()
+	}
+	lines := repo.blame(rev, bundle.FilePath)
+
+	var line *blameLine
+	if n := leak.LineNumber; n <= len(lines) && lines[n-1].text == leak.Line {
+		line = &lines[n-1]
+	} else if bundle.Commit.Hash.IsZero() {
+		// the lines of the worktree may have moved since HEAD
+		for i := range lines {
+			if lines[i].text == leak.Line {
+				line = &lines[i]
+				break
+			}
+		}
+	}
+	if line == nil {
+		return bundle.Commit
+	}
+	c, err := repo.CommitObject(line.hash)
+	if err != nil {
+		log.Debugf("unable to read blamed commit %s: %v", line.hash, err)
+		return bundle.Commit
+	}
+	leak.Commit = c.Hash.String()
+	leak.Author = c.Author.Name
+	leak.Email = c.Author.Email
+	leak.Date = c.Author.When
+	leak.Message = c.Message
+	return c
+}
+
+// blame returns the lines of the file at path at rev with the commit that last changed each, or nil if it can't
+// be blamed. Files of repos on disk are blamed with `git blame`, others, like repos cloned in memory, with
+// go-git, which is much slower. Blames are cached by revision and path, up to maxBlames files.
+func (repo *Repo) blame(rev, path string) []blameLine {
+	key := rev + ":" + path
+	if lines, ok := repo.blames.get(key); ok {
+		return lines
+	}
+	var (
+		lines []blameLine
+		err   error
+	)
+	if fsStorer, ok := repo.fsStorage(); ok && gitAvailable() {
+		cmd := exec.Command("git", "--git-dir", fsStorer.Filesystem().Root(), "blame", "--porcelain", rev, "--", path)
+		cmd.Env = append(os.Environ(), repo.gitEnv...)
+		var out []byte
+		if out, err = cmd.Output(); err == nil {
+			lines = parseBlame(out)
+		}
+	} else {
+		lines, err = repo.goGitBlame(rev, path)
+	}
+	if err != nil {
+		log.Debugf("unable to blame %s at %s: %v", path, rev, err)
+	}
+	repo.blames.add(key, lines)
+	return lines
+}
+
+// goGitBlame blames the file at path at rev with go-git
+func (repo *Repo) goGitBlame(rev, path string) ([]blameLine, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+	c, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	result, err := git.Blame(c, path)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]blameLine, len(result.Lines))
+	for i, line := range result.Lines {
+		lines[i] = blameLine{hash: line.Hash, text: line.Text}
+	}
+	return lines, nil
+}
+
+// maxBlames is the number of blamed files kept by a blameCache
+const maxBlames = 256
+
+// blameCache holds the blames of the most recently blamed files, by revision and path. The zero value is an
+// empty cache.
+type blameCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   list.List
+}
+
+type blameEntry struct {
+	key   string
+	lines []blameLine
+}
+
+func (c *blameCache) get(key string) ([]blameLine, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*blameEntry).lines, true
+}
+
+// add adds the blame of key, evicting the least recently used blame once the cache holds maxBlames
+func (c *blameCache) add(key string, lines []blameLine) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&blameEntry{key: key, lines: lines})
+	if c.order.Len() > maxBlames {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*blameEntry).key)
+	}
+}
+
+// parseBlame parses the output of `git blame --porcelain`. Each line of the file is preceded by a header
+// starting with the hash of its commit, followed by the fields of the commit the first time it's blamed.
+func parseBlame(out []byte) []blameLine {
+	var (
+		lines []blameLine
+		hash  plumbing.Hash
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(out)+1)
+	header := true
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			lines = append(lines, blameLine{hash: hash, text: text[1:]})
+			header = true
+		case header:
+			if fields := strings.Fields(text); len(fields) >= 3 && len(fields[0]) == 40 {
+				hash = plumbing.NewHash(fields[0])
+				header = false
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,54 @@
+package scan
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	log "github.com/sirupsen/logrus"
+)
+
+// scanFilesAtHead scans the tracked files of the checkout (--files-at-head) as they are in the worktree,
+// without walking any history. Untracked and ignored files are left out. Repos without a worktree, like
+// remote repos cloned in memory, have the files of the HEAD commit scanned instead.
+func (repo *Repo) scanFilesAtHead() error {
+	wt, err := repo.Worktree()
+	if err == git.ErrIsBareRepository {
+		return scanCommit("latest", repo, scanFilesAtCommit)
+	} else if err != nil {
+		return err
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	scanTimeStart := time.Now()
+	walker := newDirWalker(repo)
+	for _, entry := range idx.Entries {
+		if repo.timeoutReached() {
+			break
+		}
+		path := filepath.Join(wt.Filesystem.Root(), filepath.FromSlash(entry.Name))
+		switch entry.Mode {
+		case filemode.Submodule:
+			continue
+		case filemode.Symlink:
+			if repo.Manager.Opts.FollowSymlinks {
+				walker.scanSymlink(path, entry.Name)
+			} else {
+				log.Debugf("skipping symlink %s, use --follow-symlinks to scan its target", entry.Name)
+			}
+			continue
+		}
+		// tracked files deleted from the worktree are skipped by scanFile
+		walker.scanFile(path, entry.Name)
+	}
+	walker.wg.Wait()
+
+	repo.Manager.RecordTime(manager.ScanTime(howLong(scanTimeStart)))
+	return nil
+}
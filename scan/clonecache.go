@@ -0,0 +1,133 @@
+package scan
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// cachedHeadsSuffix is appended to the path of a cached clone for the file holding the branch heads of its
+// last scan
+const cachedHeadsSuffix = ".heads.json"
+
+// cachedClonePath returns the path of the clone of the repo at url in the clone cache directory cacheDir
+func cachedClonePath(cacheDir, url string) string {
+	return filepath.Join(cacheDir, fmt.Sprintf("%x", sha1.Sum([]byte(url))))
+}
+
+// FetchClone fetches the bare clone at path of the repo cloned with cloneOpts, or clones it if there is no
+// clone at path yet. Clones kept between scans are only sent the objects pushed since they were last fetched.
+func FetchClone(path string, cloneOpts *git.CloneOptions) (*git.Repository, error) {
+	repository, err := git.PlainOpen(path)
+	if err == git.ErrRepositoryNotExists {
+		log.Infof("cloning... %s", cloneOpts.URL)
+		repository, err = git.PlainClone(path, true, cloneOpts)
+		if err != nil {
+			// don't leave a partial clone behind for the next run to fetch into
+			os.RemoveAll(path)
+		}
+		return repository, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	log.Infof("fetching... %s", cloneOpts.URL)
+	err = repository.Fetch(&git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   []gitconfig.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		Auth:       cloneOpts.Auth,
+		Progress:   cloneOpts.Progress,
+		Force:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+	return repository, nil
+}
+
+// scansWholeHistory returns true if a scan with logOpts walks every commit of the repo, only those scans can
+// be picked up by the next scan of a cached clone
+func (repo *Repo) scansWholeHistory(logOpts *git.LogOptions) bool {
+	opts := repo.Manager.Opts
+	rate, _ := opts.SampleRate()
+	return logOpts.All && opts.CommitFrom == "" && opts.CommitTo == "" && opts.CommitSince == "" &&
+		opts.CommitUntil == "" && opts.Depth == 0 && rate >= 1
+}
+
+// cachedHeads are the heads of the last scan of a cached clone and the ConfigHash of its config
+type cachedHeads struct {
+	Heads  []string `json:"heads"`
+	Config string   `json:"config"`
+}
+
+// UnmarshalJSON reads the heads of a cached clone, or the heads alone saved before the config was kept
+func (c *cachedHeads) UnmarshalJSON(b []byte) error {
+	if len(b) != 0 && b[0] == '[' {
+		return json.Unmarshal(b, &c.Heads)
+	}
+	type heads cachedHeads
+	return json.Unmarshal(b, (*heads)(c))
+}
+
+// skipCachedHeads makes the scan of a cached clone (--clone-cache-dir) skip the commits reachable from the
+// heads of its last scan and returns the heads of the clone now, saved by saveCachedHeads for the next scan.
+// Commits scanned with another config are scanned again.
+func (repo *Repo) skipCachedHeads() ([]string, error) {
+	heads, err := repo.Heads()
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(repo.cachePath + cachedHeadsSuffix)
+	if os.IsNotExist(err) {
+		return heads, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var scanned cachedHeads
+	if err := json.Unmarshal(b, &scanned); err != nil {
+		return nil, fmt.Errorf("unable to read the heads of the last scan of %s: %v", repo.Name, err)
+	}
+	configHash, err := repo.Manager.ConfigHash()
+	if err != nil {
+		return nil, err
+	}
+	if scanned.Config != configHash {
+		log.Infof("scanning every commit of %s, its last scan was with another config", repo.Name)
+		return heads, nil
+	}
+	if err := repo.SkipReachable(scanned.Heads); err != nil {
+		return nil, err
+	}
+	return heads, nil
+}
+
+// saveCachedHeads saves heads as the heads of the last scan of the cached clone once the leaks of the scan are
+// reported. Scans that failed, timed out or were interrupted are scanned again by the next scan.
+func (repo *Repo) saveCachedHeads(heads []string, scanErr error) {
+	if scanErr != nil || repo.TimedOut() || repo.Manager.Stopped() {
+		return
+	}
+	path := repo.cachePath + cachedHeadsSuffix
+	repo.Manager.AfterReport(func() error {
+		configHash, err := repo.Manager.ConfigHash()
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(cachedHeads{Heads: heads, Config: configHash}, "", " ")
+		if err != nil {
+			return err
+		}
+		// written to a temporary file first so an interrupted write can't lose the heads
+		if err := ioutil.WriteFile(path+".tmp", b, 0600); err != nil {
+			return err
+		}
+		return os.Rename(path+".tmp", path)
+	})
+}
@@ -0,0 +1,51 @@
+package scan
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// scissorsLine marks the end of the message in the file of `git commit --verbose`, git drops it and everything below
+const scissorsLine = "------------------------ >8 ------------------------"
+
+// scanCommitMessage scans the message of a commit being made, read from the file at path that git passes to the
+// commit-msg hook (--commit-msg-file). Comment lines, which git strips from the message, aren't scanned but
+// are kept as empty lines so the line numbers of leaks match the file.
+func (repo *Repo) scanCommitMessage(path string) error {
+	start := time.Now()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(string(b), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			if strings.Contains(line, scissorsLine) {
+				lines = lines[:i]
+				break
+			}
+			lines[i] = ""
+		}
+	}
+
+	c := emptyCommit()
+	// the message isn't repeated in leaks, it would hold the secret even with --redact
+	c.Message = "***COMMIT MESSAGE***"
+	repo.CheckRules(&Bundle{
+		Content:   strings.Join(lines, "\n"),
+		FilePath:  filepath.Base(path),
+		Commit:    c,
+		Operation: fdiff.Add,
+		scanType:  uncommittedScan,
+		startLine: 1,
+	})
+	repo.Manager.RecordTime(manager.ScanTime(howLong(start)))
+	return nil
+}
@@ -0,0 +1,96 @@
+package scan
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	stringLiteralPattern = `"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'`
+	charCodePattern      = `0[xX][0-9a-fA-F]+|\d+`
+)
+
+var (
+	// obfuscationPart matches the parts strings are built from to hide them: string literals, calls building a
+	// char from its code, like chr(115) in python and php, Chr(115) in vb and [char]115 in powershell, and
+	// String.fromCharCode(115, 107) in javascript
+	obfuscationPart = `(?:` + stringLiteralPattern +
+		`|\bString\.fromCharCode\(\s*(?:` + charCodePattern + `)(?:\s*,\s*(?:` + charCodePattern + `))*\s*\)` +
+		`|\b(?:chr|Chr|ChrW)\(\s*(?:` + charCodePattern + `)\s*\)` +
+		`|\[char\](?:` + charCodePattern + `))`
+
+	// obfuscationRe matches parts concatenated on a line with +, . (php), .. (lua) or & (vb)
+	obfuscationRe     = regexp.MustCompile(obfuscationPart + `(?:[ \t]*(?:\+|\.\.|\.|&)[ \t]*` + obfuscationPart + `)*`)
+	obfuscationPartRe = regexp.MustCompile(obfuscationPart)
+	charCodeRe        = regexp.MustCompile(charCodePattern)
+)
+
+// obfuscatedString is a string reassembled from an expression of the content of a bundle concatenating string
+// literals or building it from char codes
+type obfuscatedString struct {
+	// start and end are the offsets of the expression in the content
+	start, end int
+	value      string
+}
+
+// deobfuscate returns the strings of content split into concatenated literals, like "sk_" + "live_" + "...",
+// or built from char codes, reassembled. Only expressions on a single line of literals and char codes are
+// reassembled, strings built from variables or over several lines aren't.
+func deobfuscate(content string) []obfuscatedString {
+	var reassembled []obfuscatedString
+	for _, loc := range obfuscationRe.FindAllStringIndex(content, -1) {
+		parts := obfuscationPartRe.FindAllString(content[loc[0]:loc[1]], -1)
+		// a single literal isn't obfuscated, a string built from char codes is
+		if len(parts) < 2 && !strings.HasPrefix(parts[0], "String.fromCharCode") {
+			continue
+		}
+		var value strings.Builder
+		ok := true
+		for _, part := range parts {
+			s, partOK := deobfuscatePart(part)
+			if !partOK {
+				ok = false
+				break
+			}
+			value.WriteString(s)
+		}
+		if ok {
+			reassembled = append(reassembled, obfuscatedString{start: loc[0], end: loc[1], value: value.String()})
+		}
+	}
+	return reassembled
+}
+
+// deobfuscatePart returns the string of a part of an obfuscated expression, or false if a char code isn't a
+// valid code point
+func deobfuscatePart(part string) (string, bool) {
+	if quote := part[0]; quote == '"' || quote == '\'' {
+		return unescapeLiteral(part[1 : len(part)-1]), true
+	}
+	var s strings.Builder
+	for _, code := range charCodeRe.FindAllString(part, -1) {
+		r, err := strconv.ParseInt(code, 0, 32)
+		if err != nil || r <= 0 || r > 0x10FFFF {
+			return "", false
+		}
+		s.WriteRune(rune(r))
+	}
+	return s.String(), true
+}
+
+// unescapeLiteral returns the body of a string literal with its backslash escapes of quotes and backslashes
+// resolved. Other escapes are kept as they are, secrets don't contain them.
+func unescapeLiteral(body string) string {
+	if !strings.Contains(body, `\`) {
+		return body
+	}
+	var s strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] == '\\' && i+1 < len(body) && strings.IndexByte(`"'\`, body[i+1]) >= 0 {
+			i++
+		}
+		s.WriteByte(body[i])
+	}
+	return s.String()
+}
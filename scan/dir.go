@@ -0,0 +1,240 @@
+package scan
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	log "github.com/sirupsen/logrus"
+)
+
+// dirWalker scans the files of a directory tree. It is used for --no-git scans and for symlinked
+// directories of uncommitted scans when --follow-symlinks is set.
+type dirWalker struct {
+	repo     *Repo
+	patterns []gitignore.Pattern
+
+	// visited holds the real paths of the directories and files already walked when following symlinks.
+	// Symlinks pointing to an ancestor directory would otherwise be walked forever and symlinks pointing
+	// inside the scanned tree would be scanned twice.
+	visited map[string]bool
+
+	semaphore chan bool
+	wg        sync.WaitGroup
+}
+
+func newDirWalker(repo *Repo) *dirWalker {
+	return &dirWalker{
+		repo:      repo,
+		visited:   make(map[string]bool),
+		semaphore: make(chan bool, howManyThreads(repo.Manager.Opts.Threads, repo.Manager.Opts.AutoThreads)),
+	}
+}
+
+// scanDir scans the files of a plain directory (--no-git), ignoring any git history. .git directories are
+// never scanned. Directories that are git repositories of their own are skipped with --nested-repos=skip and
+// files matched by .gitignore patterns are skipped with --gitignore.
+func (repo *Repo) scanDir(root string) error {
+	if err := repo.setupTimeout(); err != nil {
+		return err
+	}
+	if repo.cancel != nil {
+		defer repo.cancel()
+	}
+	scanTimeStart := time.Now()
+
+	w := newDirWalker(repo)
+	w.markVisited(root)
+	if repo.Manager.Opts.Gitignore {
+		w.patterns = readGitignore(root, nil)
+	}
+	err := w.walk(root, nil)
+	w.wg.Wait()
+
+	repo.Manager.RecordTime(manager.ScanTime(howLong(scanTimeStart)))
+	return err
+}
+
+// walk scans the entries of dir. parts is the path of dir relative to the scan root.
+func (w *dirWalker) walk(dir string, parts []string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	// walk symlinks last so files are reported by their real path when a symlink points into the scanned tree
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Mode()&os.ModeSymlink == 0 && entries[j].Mode()&os.ModeSymlink != 0
+	})
+	for _, info := range entries {
+		if w.repo.timeoutReached() {
+			return nil
+		}
+		path := filepath.Join(dir, info.Name())
+		childParts := append(append([]string{}, parts...), info.Name())
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !w.repo.Manager.Opts.FollowSymlinks {
+				log.Debugf("skipping symlink %s, use --follow-symlinks to scan its target", path)
+				continue
+			}
+			if info, err = os.Stat(path); err != nil {
+				log.Debugf("skipping broken symlink %s: %v", path, err)
+				continue
+			}
+			if !w.markVisited(path) {
+				log.Debugf("skipping symlink %s, its target has already been scanned", path)
+				continue
+			}
+		} else if w.repo.Manager.Opts.FollowSymlinks && !w.markVisited(path) {
+			continue
+		}
+
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				continue
+			}
+			if w.repo.Manager.Opts.NestedRepos == "skip" && isGitDir(path) {
+				log.Debugf("skipping nested repo %s", path)
+				continue
+			}
+			if w.ignored(childParts, true) {
+				continue
+			}
+			n := len(w.patterns)
+			if w.repo.Manager.Opts.Gitignore {
+				w.patterns = append(w.patterns, readGitignore(path, childParts)...)
+			}
+			if err := w.walk(path, childParts); err != nil {
+				log.Debug(err)
+			}
+			// patterns of a .gitignore only apply below the directory it is in
+			w.patterns = w.patterns[:n]
+			continue
+		}
+
+		if info.Mode().IsRegular() && !w.ignored(childParts, false) {
+			w.scanFile(path, strings.Join(childParts, "/"))
+		}
+	}
+	return nil
+}
+
+// markVisited records the real path of path and returns false if it had been visited before
+func (w *dirWalker) markVisited(path string) bool {
+	if !w.repo.Manager.Opts.FollowSymlinks {
+		return true
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	if real, err = filepath.Abs(real); err != nil {
+		return false
+	}
+	if w.visited[real] {
+		return false
+	}
+	w.visited[real] = true
+	return true
+}
+
+// ignored returns true if --gitignore is set and the path is matched by a .gitignore pattern
+func (w *dirWalker) ignored(parts []string, isDir bool) bool {
+	return w.repo.Manager.Opts.Gitignore && gitignore.NewMatcher(w.patterns).Match(parts, isDir)
+}
+
+// scanFile scans the contents of the file at path. rel is the path reported for leaks.
+func (w *dirWalker) scanFile(path, rel string) {
+	if w.repo.skipPath(rel) {
+		return
+	}
+	w.wg.Add(1)
+	w.semaphore <- true
+	go func() {
+		defer func() {
+			<-w.semaphore
+			w.wg.Done()
+		}()
+		f, err := os.Open(path)
+		if err != nil {
+			log.Debug(err)
+			return
+		}
+		buf := getBuffer()
+		defer putBuffer(buf)
+		_, err = buf.ReadFrom(f)
+		f.Close()
+		if err != nil {
+			log.Debug(err)
+			return
+		}
+		if w.repo.skipContent(rel, sniffHead(buf.Bytes()), false) {
+			return
+		}
+		w.repo.CheckRules(&Bundle{
+			Content:   buf.String(),
+			FilePath:  rel,
+			Commit:    emptyCommit(),
+			Operation: fdiff.Add,
+			scanType:  uncommittedScan,
+			startLine: 1,
+		})
+	}()
+}
+
+// scanSymlink scans the target of a symlink in the worktree of an uncommitted scan. Targets that are
+// directories are walked, following any further symlinks, with cycles detected by w.
+func (w *dirWalker) scanSymlink(path, rel string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Debugf("skipping broken symlink %s: %v", path, err)
+		return
+	}
+	if !w.markVisited(path) {
+		return
+	}
+	if info.IsDir() {
+		if err := w.walk(path, strings.Split(rel, "/")); err != nil {
+			log.Debug(err)
+		}
+		return
+	}
+	if info.Mode().IsRegular() {
+		w.scanFile(path, rel)
+	}
+}
+
+// isGitDir returns true if dir is the worktree of a git repository
+func isGitDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// readGitignore parses the .gitignore file of dir. domain is the path of dir relative to the scan root.
+func readGitignore(dir string, domain []string) []gitignore.Pattern {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var patterns []gitignore.Pattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, domain))
+	}
+	return patterns
+}
@@ -0,0 +1,200 @@
+package scan
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+)
+
+// doctor gathers how the rules and allowlists of a config fare against the files of a directory
+type doctor struct {
+	cfg config.Config
+
+	// matches counts the matches of each rule and reported the matches that aren't allowlisted
+	matches  []int
+	reported []int
+	// hits counts the files or lines each allowlist regex allowlisted
+	hits map[*regexp.Regexp]int
+}
+
+// Doctor writes the problems of the rules and allowlists of cfg to w (gitleaks config doctor) and returns how
+// many it found. Rules sharing a regex and rules shadowed by file-only rules are found from cfg alone, rules
+// every match of which is allowlisted and the file, path and regex allowlist entries that match nothing are
+// found by checking the rules against the files of dir. Commit and repo allowlists aren't checked, nor is the
+// allowlist entry of the config file, configFile, which every config gets.
+func Doctor(w io.Writer, cfg config.Config, dir, configFile string) (int, error) {
+	problems := 0
+	problem := func(format string, a ...interface{}) {
+		fmt.Fprintf(w, format+"\n", a...)
+		problems++
+	}
+
+	for i, rule := range cfg.Rules {
+		for _, other := range cfg.Rules[:i] {
+			if ruleContainRegex(rule) && rule.Regex.String() == other.Regex.String() && sameFiles(rule, other) {
+				problem("rule %q has the same regex as rule %q", rule.Description, other.Description)
+			}
+		}
+		if !ruleContainRegex(rule) || (!ruleContainFileRegex(rule) && !ruleContainPathRegex(rule)) {
+			continue
+		}
+		for _, other := range cfg.Rules {
+			if !ruleContainRegex(other) && sameFiles(rule, other) {
+				problem("rule %q is shadowed by file-only rule %q, which already reports every file it applies to",
+					rule.Description, other.Description)
+			}
+		}
+	}
+
+	d := &doctor{
+		cfg:      cfg,
+		matches:  make([]int, len(cfg.Rules)),
+		reported: make([]int, len(cfg.Rules)),
+		hits:     make(map[*regexp.Regexp]int),
+	}
+	set := newRuleSet(cfg)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !isBinary(b) {
+			d.checkFile(set, filepath.ToSlash(rel), string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return problems, err
+	}
+
+	for i, rule := range cfg.Rules {
+		if d.matches[i] != 0 && d.reported[i] == 0 {
+			problem("rule %q matches %d times in %s but every match is allowlisted", rule.Description, d.matches[i], dir)
+		}
+	}
+	unused := func(kind string, res []*regexp.Regexp) {
+		for _, re := range res {
+			if d.hits[re] == 0 && !(configFile != "" && re.String() == filepath.Base(configFile)) {
+				problem("%s %q matches nothing in %s", kind, re, dir)
+			}
+		}
+	}
+	unused("global allowlist file", cfg.Allowlist.Files)
+	unused("global allowlist path", cfg.Allowlist.Paths)
+	unused("global allowlist regex", cfg.Allowlist.Regexes)
+	for _, rule := range cfg.Rules {
+		unused(fmt.Sprintf("rule %q allowlist file", rule.Description), rule.AllowList.Files)
+		unused(fmt.Sprintf("rule %q allowlist path", rule.Description), rule.AllowList.Paths)
+		unused(fmt.Sprintf("rule %q allowlist regex", rule.Description), rule.AllowList.Regexes)
+	}
+
+	if problems == 0 {
+		fmt.Fprintln(w, "no problems found")
+	} else {
+		fmt.Fprintf(w, "%d problems found\n", problems)
+	}
+	return problems, nil
+}
+
+// sameFiles returns true if rules a and b apply to the same files and paths
+func sameFiles(a, b config.Rule) bool {
+	return regexString(a.File) == regexString(b.File) && regexString(a.Path) == regexString(b.Path)
+}
+
+func regexString(re *regexp.Regexp) string {
+	if re == nil {
+		return ""
+	}
+	return re.String()
+}
+
+// hit returns true if a regex of res matches target, counting the hits of every regex matching it
+func (d *doctor) hit(target string, res []*regexp.Regexp) bool {
+	matched := false
+	for _, re := range res {
+		if re.FindString(target) != "" {
+			d.hits[re]++
+			matched = true
+		}
+	}
+	return matched
+}
+
+// checkFile checks the rules of set against the file at path. What's allowlisted is decided by the rule set the
+// way CheckRules decides it, the allowlist regexes are only matched again to count their hits.
+func (d *doctor) checkFile(set *ruleSet, path, content string) {
+	dir, filename := config.SplitPath(path)
+	allowListedFile, allowListedPath := d.hit(filename, d.cfg.Allowlist.Files), d.hit(dir, d.cfg.Allowlist.Paths)
+	globallyAllowListed := allowListedFile || allowListedPath
+
+	for i, rule := range set.rules {
+		if ruleContainFileRegex(rule.Rule) && !RegexMatched(filename, rule.File) {
+			continue
+		}
+		if ruleContainPathRegex(rule.Rule) && !RegexMatched(dir, rule.Path) {
+			continue
+		}
+		// matches the entropies, parser or validator of a rule turn down aren't leaks to begin with
+		type ruleMatch struct {
+			match contentMatch
+			leak  matchLeak
+		}
+		var matches []ruleMatch
+		if ruleContainRegex(rule.Rule) {
+			for _, match := range rule.matches(content) {
+				if l, ok := rule.leak(match); ok {
+					matches = append(matches, ruleMatch{match, l})
+				}
+			}
+		} else {
+			matches = []ruleMatch{{}}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		d.matches[i] += len(matches)
+		if globallyAllowListed && !rule.IgnoreGlobalAllowlist {
+			continue
+		}
+		d.hit(filename, rule.AllowList.Files)
+		d.hit(dir, rule.AllowList.Paths)
+		if rule.skipsFile(filename, dir) {
+			continue
+		}
+		if !ruleContainRegex(rule.Rule) {
+			d.reported[i]++
+			continue
+		}
+		for _, m := range matches {
+			d.hit(m.match.line, rule.AllowList.Regexes)
+			if !rule.IgnoreGlobalAllowlist {
+				d.hit(m.match.line, d.cfg.Allowlist.Regexes)
+			}
+			if !rule.allowListed(dir, m.match, m.leak) {
+				d.reported[i]++
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package scan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// envFile is the file leaks in the environment of gitleaks are reported in
+const envFile = "environment"
+
+// scanEnv scans the environment variables of gitleaks, or the dotenv file at path if it's set (gitleaks env). The
+// variables of the environment are scanned as sorted NAME=value lines so rules for dotenv files match them too.
+func (repo *Repo) scanEnv(path string) error {
+	start := time.Now()
+	var content string
+	file := envFile
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		content, file = string(b), filepath.Base(path)
+	} else {
+		env := os.Environ()
+		sort.Strings(env)
+		content = strings.Join(env, "\n")
+	}
+	repo.Name = file
+
+	c := emptyCommit()
+	c.Message = "***ENVIRONMENT***"
+	repo.CheckRules(&Bundle{
+		Content:   content,
+		FilePath:  file,
+		Commit:    c,
+		Operation: fdiff.Add,
+		scanType:  uncommittedScan,
+		startLine: 1,
+	})
+	repo.Manager.RecordTime(manager.ScanTime(howLong(start)))
+	return nil
+}
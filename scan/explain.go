@@ -0,0 +1,195 @@
+package scan
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+)
+
+// Explain writes how the rules of cfg treat line (--explain) to w: the rules matching it, the entropy computed
+// for rules with entropy ranges and the allowlist entries suppressing matches. File and path rules and
+// allowlists are only applied if path (--explain-path) is set. The decisions are the same CheckRules makes.
+// Explain returns true if the line would be reported as a leak that fails the scan.
+func Explain(w io.Writer, cfg config.Config, path, line string) bool {
+	dir, filename := config.SplitPath(path)
+	globallyAllowListed := false
+	if path != "" {
+		checked := "no rules are checked"
+		if cfg.IgnoresGlobalAllowlist() {
+			checked = "only the rules ignoring the global allowlist are checked"
+		}
+		if re := allowListedBy(filename, cfg.Allowlist.Files); re != nil {
+			fmt.Fprintf(w, "%s is allowlisted by global allowlist file %q, %s\n", path, re, checked)
+			globallyAllowListed = true
+		} else if re := allowListedBy(dir, cfg.Allowlist.Paths); re != nil {
+			fmt.Fprintf(w, "%s is allowlisted by global allowlist path %q, %s\n", path, re, checked)
+			globallyAllowListed = true
+		}
+		if globallyAllowListed && !cfg.IgnoresGlobalAllowlist() {
+			return false
+		}
+	}
+
+	reported, failing := false, false
+	unmatched := 0
+	for _, rule := range cfg.Rules {
+		if globallyAllowListed && !rule.IgnoreGlobalAllowlist {
+			continue
+		}
+		if path != "" {
+			if re := allowListedBy(filename, rule.AllowList.Files); re != nil {
+				fmt.Fprintf(w, "rule %q: %s is allowlisted by rule allowlist file %q\n", rule.Description, path, re)
+				continue
+			}
+			if re := allowListedBy(dir, rule.AllowList.Paths); re != nil {
+				fmt.Fprintf(w, "rule %q: %s is allowlisted by rule allowlist path %q\n", rule.Description, path, re)
+				continue
+			}
+		}
+		if ruleContainFileRegex(rule) && !RegexMatched(filename, rule.File) {
+			if path == "" {
+				fmt.Fprintf(w, "rule %q: only applies to files matching %q, set --explain-path to check it\n", rule.Description, rule.File)
+			} else if ruleContainRegex(rule) && rule.Regex.MatchString(line) {
+				fmt.Fprintf(w, "rule %q: matches but only applies to files matching %q\n", rule.Description, rule.File)
+			} else {
+				unmatched++
+			}
+			continue
+		}
+		if ruleContainPathRegex(rule) && !RegexMatched(dir, rule.Path) {
+			if path == "" {
+				fmt.Fprintf(w, "rule %q: only applies to paths matching %q, set --explain-path to check it\n", rule.Description, rule.Path)
+			} else if ruleContainRegex(rule) && rule.Regex.MatchString(line) {
+				fmt.Fprintf(w, "rule %q: matches but only applies to paths matching %q\n", rule.Description, rule.Path)
+			} else {
+				unmatched++
+			}
+			continue
+		}
+
+		if !ruleContainRegex(rule) {
+			fmt.Fprintf(w, "rule %q: %s matches the file rule %s and is reported\n", rule.Description, path, fileRuleRegex(rule))
+			reported = true
+			failing = failing || !explainReportOnly(w, rule)
+			continue
+		}
+
+		locs := rule.Regex.FindAllStringIndex(line, -1)
+		if len(locs) == 0 {
+			unmatched++
+			continue
+		}
+		for _, loc := range locs {
+			if explainMatch(w, cfg, rule, dir, line, line[loc[0]:loc[1]]) {
+				reported = true
+				failing = failing || !explainReportOnly(w, rule)
+			}
+		}
+	}
+
+	if unmatched != 0 {
+		fmt.Fprintf(w, "%d rules don't match\n", unmatched)
+	}
+	switch {
+	case failing:
+		fmt.Fprintln(w, "result: reported as a leak")
+	case reported:
+		fmt.Fprintln(w, "result: reported as a leak of report-only rules, which doesn't fail the scan")
+	default:
+		fmt.Fprintln(w, "result: not reported")
+	}
+	return failing
+}
+
+// explainReportOnly notes that the leaks of report-only rules don't fail the scan, returning true if rule is report-only
+func explainReportOnly(w io.Writer, rule config.Rule) bool {
+	if rule.ReportOnly {
+		fmt.Fprintln(w, "  the rule is report-only, its leaks don't fail the scan")
+	}
+	return rule.ReportOnly
+}
+
+// explainMatch explains the decisions made for a match of rule in line of a file in dir, returning true if it's
+// reported
+func explainMatch(w io.Writer, cfg config.Config, rule config.Rule, dir, line, match string) bool {
+	groups := rule.Regex.FindStringSubmatch(match)
+	fmt.Fprintf(w, "rule %q: matches %q\n", rule.Description, match)
+
+	if re := allowListedBy(line, rule.AllowList.Regexes); re != nil {
+		fmt.Fprintf(w, "  suppressed by rule allowlist regex %q\n", re)
+		return false
+	}
+	if re := allowListedBy(line, cfg.Allowlist.Regexes); re != nil && !rule.IgnoreGlobalAllowlist {
+		fmt.Fprintf(w, "  suppressed by global allowlist regex %q\n", re)
+		return false
+	}
+
+	if len(rule.Entropies) != 0 {
+		for _, e := range rule.Entropies {
+			if len(groups) <= e.Group {
+				fmt.Fprintf(w, "  entropy: the regex has no group %d\n", e.Group)
+				continue
+			}
+			entropy := shannonEntropy(groups[e.Group])
+			verdict := "outside"
+			if entropy >= e.Min && entropy <= e.Max {
+				verdict = "within"
+			}
+			fmt.Fprintf(w, "  entropy of group %d %q is %.4f, %s the range %g-%g\n", e.Group, groups[e.Group], entropy, verdict, e.Min, e.Max)
+		}
+		if !trippedEntropy(groups, rule) {
+			fmt.Fprintln(w, "  suppressed as no entropy range was met")
+			return false
+		}
+		allowances := rule.AllowList.Entropies
+		if !rule.IgnoreGlobalAllowlist {
+			allowances = append(append([]config.EntropyAllowance(nil), rule.AllowList.Entropies...), cfg.Allowlist.Entropies...)
+		}
+		if allowance := allowListedEntropy(groups, rule, dir, allowances); allowance != nil {
+			fmt.Fprintf(w, "  suppressed by allowlist entropy max %g\n", allowance.Max)
+			return false
+		}
+	}
+
+	offender := match
+	if 0 < rule.ReportGroup && rule.ReportGroup < len(groups) {
+		offender = groups[rule.ReportGroup]
+	}
+	named := namedGroups(rule.Regex, groups)
+	if rule.Parse != "" {
+		fields, start, end, ok := config.Parsers[rule.Parse](offender)
+		if !ok {
+			fmt.Fprintf(w, "  suppressed as %q has no secret parsed as a %s\n", offender, rule.Parse)
+			return false
+		}
+		named, offender = fields, offender[start:end]
+	}
+	if rule.MinMatches > 1 {
+		fmt.Fprintf(w, "  the rule only reports its matches in files with at least %d of them\n", rule.MinMatches)
+	}
+	if rule.Validate != "" && !config.Validators[rule.Validate](offender) {
+		fmt.Fprintf(w, "  suppressed as %q fails the %s checksum\n", offender, rule.Validate)
+		return false
+	}
+	if fixture, ok := fixtureOf(offender, rule.AllowList); ok {
+		fmt.Fprintf(w, "  suppressed by rule allowlist fixture %q\n", fixture)
+		return false
+	}
+	if fixture, ok := fixtureOf(offender, cfg.Allowlist); ok && !rule.IgnoreGlobalAllowlist {
+		fmt.Fprintf(w, "  suppressed by global allowlist fixture %q\n", fixture)
+		return false
+	}
+	var fields []string
+	for name, value := range named {
+		fields = append(fields, fmt.Sprintf("%s=%q", name, value))
+	}
+	fmt.Fprintf(w, "  reported with offender %q, entropy %.4f\n", offender, shannonEntropy(offender))
+	if len(fields) != 0 {
+		sort.Strings(fields)
+		fmt.Fprintf(w, "  named groups: %s\n", strings.Join(fields, ", "))
+	}
+	return true
+}
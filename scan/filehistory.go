@@ -0,0 +1,146 @@
+package scan
+
+import (
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	"github.com/go-git/go-git/v5"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	log "github.com/sirupsen/logrus"
+)
+
+// scanFileHistory scans the changes made to a single file (--file-history=) in every commit that touched it.
+// The file is followed back through renames, so older commits are matched against the path the file had at
+// that point in history. History is walked from HEAD, or from --branch/--commit-from if set, along first parents.
+func (repo *Repo) scanFileHistory(logOpts *git.LogOptions) error {
+	logOpts.All = false
+	if repo.Manager.Opts.GitBackend == "cli" {
+		return repo.scanGitLog(logOpts)
+	}
+
+	cIter, err := repo.Log(logOpts)
+	if err != nil {
+		return err
+	}
+
+	filePath := config.NormalizePath(repo.Manager.Opts.FileHistory)
+	cc := 0
+	err = cIter.ForEach(func(c *object.Commit) error {
+		if c == nil || repo.timeoutReached() || repo.depthReached(cc) {
+			return storer.ErrStop
+		}
+		if isCommitAllowListed(c, repo.config.Allowlist) {
+			return nil
+		}
+
+		c, err := repo.ensureBlobs(c, len(c.ParentHashes) == 0)
+		if err != nil {
+			return err
+		}
+
+		if len(c.ParentHashes) == 0 {
+			f, err := c.File(filePath)
+			if err == object.ErrFileNotFound {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			cc++
+			return scanFileAtCommit(f, c, repo)
+		}
+
+		parent, err := c.Parent(0)
+		if err != nil {
+			return err
+		}
+		change, err := fileChange(parent, c, filePath)
+		if err != nil || change == nil {
+			return err
+		}
+		cc++
+
+		// older commits know the file by the name it had before it was renamed
+		if change.From.Name != "" {
+			filePath = change.From.Name
+		}
+
+		defer func() {
+			if err := recover(); err != nil {
+				// sometimes the Patch generation will fail due to a known bug in
+				// sergi's go-diff: https://github.com/sergi/go-diff/issues/89.
+				return
+			}
+		}()
+		start := time.Now()
+		patch, err := change.Patch()
+		if err != nil {
+			log.Errorf("could not generate Patch")
+			return nil
+		}
+		repo.Manager.RecordTime(manager.PatchTime(howLong(start)))
+		scanPatch(patch, c, repo, "")
+
+		if c.Hash.String() == repo.Manager.Opts.CommitTo {
+			return storer.ErrStop
+		}
+		return nil
+	})
+
+	repo.Manager.IncrementRepoCommits(repo.Name, cc)
+	return err
+}
+
+// fileChange returns the change made to filePath between parent and c with renames detected,
+// or nil if c did not touch the file.
+func fileChange(parent, c *object.Commit, filePath string) (*object.Change, error) {
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := parentTree.Diff(tree)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.To.Name == filePath || (change.To.Name == "" && change.From.Name == filePath) {
+			return change, nil
+		}
+	}
+	return nil, nil
+}
+
+// scanFileAtCommit scans the contents of a single file at commit c
+func scanFileAtCommit(f *object.File, c *object.Commit, repo *Repo) error {
+	if repo.skipPath(f.Name) {
+		return nil
+	}
+	head, err := fileHead(f)
+	if err != nil || repo.skipContent(f.Name, head, false) {
+		return err
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return err
+	}
+	if !repo.scanChunk(fdiff.Add, true) {
+		return nil
+	}
+	repo.CheckRules(&Bundle{
+		Content:   content,
+		FilePath:  f.Name,
+		Commit:    c,
+		scanType:  commitScan,
+		Operation: fdiff.Add,
+		startLine: 1,
+	})
+	repo.scanLFS(c, f.Name, content)
+	return nil
+}
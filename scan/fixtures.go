@@ -0,0 +1,62 @@
+package scan
+
+import (
+	"github.com/zricethezav/gitleaks/v6/config"
+)
+
+// fixtureOf returns the fixture of allowLists that offender is at most the fixture distance of its allowlist
+// away from, and false if offender isn't a fixture
+func fixtureOf(offender string, allowLists ...config.AllowList) (string, bool) {
+	for _, allowList := range allowLists {
+		for _, fixture := range allowList.Fixtures {
+			if editDistance(offender, fixture, allowList.FixtureDistance) <= allowList.FixtureDistance {
+				return fixture, true
+			}
+		}
+	}
+	return "", false
+}
+
+// editDistance returns the levenshtein distance of a and b, the number of characters to insert, delete or
+// substitute to turn a into b. Distances above max aren't computed exactly, max+1 is returned for them.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if current[j] < rowMin {
+				rowMin = current[j]
+			}
+		}
+		// distances only grow from row to row
+		if rowMin > max {
+			return max + 1
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,452 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// gitLogFormat separates commits with a record separator and the commit fields with unit separators.
+	// The patch of the commit follows the last unit separator.
+	gitLogFormat    = "format:%x1e%H%x1f%P%x1f%an%x1f%ae%x1f%aI%x1f%B%x1f"
+	recordSeparator = '\x1e'
+	unitSeparator   = "\x1f"
+)
+
+// scanGitLog is an alternative to the go-git history walk in Scan(). It shells out to
+// `git log -p --unified=0` and scans the patches as they stream in. Native git generates patches
+// considerably faster than go-git and the zero context output only contains the lines that changed.
+func (repo *Repo) scanGitLog(logOpts *git.LogOptions) error {
+	fsStorer, ok := repo.fsStorage()
+	if !ok {
+		return fmt.Errorf("--git-backend=cli requires a repo on disk, use --disk when scanning remote repos")
+	}
+
+	if err := checkGitVersion(); err != nil {
+		return err
+	}
+
+	gitDir := fsStorer.Filesystem().Root()
+	args := append(gitPatchArgs(gitDir, "log"), "--diff-merges=first-parent", "--format="+gitLogFormat)
+	if repo.Manager.Opts.Merges == "skip" {
+		args = append(args, "--no-merges")
+	}
+	if repo.Manager.Opts.FileHistory != "" {
+		args = append(args, "--follow")
+	}
+	switch repo.Manager.Opts.Order {
+	case "topo":
+		args = append(args, "--topo-order")
+	case "date":
+		args = append(args, "--date-order")
+	case "reverse":
+		args = append(args, "--reverse")
+	}
+	if logOpts.All && repo.Manager.Opts.Reflog {
+		args = append(args, "--reflog")
+	}
+	args = append(args, gitLogRange(logOpts)...)
+	if len(repo.skipHeads) != 0 {
+		args = append(append(args, "--not"), repo.skipHeads...)
+	}
+	// revisions end at --, anything after it is a path
+	args = append(args, "--")
+	if repo.Manager.Opts.FileHistory != "" {
+		args = append(args, repo.Manager.Opts.FileHistory)
+	}
+
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var (
+		cc        = 0
+		semaphore = make(chan bool, howManyThreads(repo.Manager.Opts.Threads, repo.Manager.Opts.AutoThreads))
+		wg        = sync.WaitGroup{}
+		reader    = bufio.NewReader(stdout)
+
+		// stopped is set if the walk ends before git is done, because of depth, timeout, commit-to or an
+		// error reading its output
+		stopped bool
+		walkErr error
+	)
+	for {
+		record, readErr := reader.ReadString(recordSeparator)
+		record = strings.TrimSuffix(record, string(recordSeparator))
+		if strings.TrimSpace(record) != "" {
+			if repo.timeoutReached() || repo.depthReached(cc) {
+				stopped = true
+				break
+			}
+			c, patch, err := parseGitLogRecord(record)
+			if err != nil {
+				log.Debug(err)
+			} else if isCommitAllowListed(c, repo.config.Allowlist) {
+				log.Debugf("skipping allowlisted commit %s", c.Hash)
+			} else if !repo.sampled(c.Hash) {
+				repo.Manager.IncrementSampledOut(1)
+				if c.Hash.String() == repo.Manager.Opts.CommitTo {
+					stopped = true
+					break
+				}
+			} else {
+				cc++
+				wg.Add(1)
+				semaphore <- true
+				go func(c *object.Commit, patch string) {
+					defer func() {
+						<-semaphore
+						wg.Done()
+					}()
+					var mergeParent string
+					if len(c.ParentHashes) > 1 {
+						mergeParent = repo.mergeParent(c, c.ParentHashes[0])
+					}
+					scanGitLogPatch(patch, c, repo, mergeParent)
+					if mergeParent != "" {
+						repo.scanGitDiffParents(gitDir, c)
+					}
+				}(c, patch)
+
+				if c.Hash.String() == repo.Manager.Opts.CommitTo {
+					stopped = true
+					break
+				}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			stopped, walkErr = true, readErr
+			break
+		}
+	}
+
+	if stopped {
+		// git is stopped instead of writing the rest of the log nobody reads
+		_ = cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+	wg.Wait()
+	repo.Manager.IncrementRepoCommits(repo.Name, cc)
+
+	if walkErr != nil {
+		return walkErr
+	}
+	if waitErr != nil && !stopped {
+		// a bad revision or an object missing from a partial clone fails git, not only the commits after it
+		return fmt.Errorf("git log failed: %v: %s", waitErr, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// minGitVersion is the oldest git the cli backend runs with, --diff-merges was added in git 2.31
+var minGitVersion = [2]int{2, 31}
+
+var (
+	gitVersionOnce sync.Once
+	gitVersionErr  error
+)
+
+// checkGitVersion returns an error if the git on the PATH is older than minGitVersion. git is only asked once.
+func checkGitVersion() error {
+	gitVersionOnce.Do(func() {
+		out, err := exec.Command("git", "version").Output()
+		if err != nil {
+			gitVersionErr = fmt.Errorf("--git-backend=cli requires git: %v", err)
+			return
+		}
+		major, minor, ok := parseGitVersion(string(out))
+		if !ok {
+			log.Debugf("unable to parse the version of git from %q", out)
+			return
+		}
+		if major < minGitVersion[0] || (major == minGitVersion[0] && minor < minGitVersion[1]) {
+			gitVersionErr = fmt.Errorf("--git-backend=cli requires git %d.%d or newer, found %s",
+				minGitVersion[0], minGitVersion[1], strings.TrimSpace(string(out)))
+		}
+	})
+	return gitVersionErr
+}
+
+// parseGitVersion returns the major and minor version of the output of `git version`, like
+// "git version 2.39.2" or "git version 2.37.1 (Apple Git-137.1)"
+func parseGitVersion(out string) (int, int, bool) {
+	fields := strings.Fields(out)
+	if len(fields) < 3 || fields[0] != "git" || fields[1] != "version" {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(fields[2], ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	return major, minor, err1 == nil && err2 == nil
+}
+
+// gitPatchArgs returns the arguments shared by the git commands generating patches for scanGitLogPatch
+func gitPatchArgs(gitDir, command string) []string {
+	return []string{
+		"--git-dir", gitDir,
+		"-c", "core.quotePath=false",
+		command, "-p", "--unified=0", "--no-color", "--no-ext-diff", "--find-renames", "--find-copies",
+	}
+}
+
+// scanGitDiffParents scans the diffs of merge commit c against its parents other than the first parent,
+// which is part of the `git log` output already.
+func (repo *Repo) scanGitDiffParents(gitDir string, c *object.Commit) {
+	for _, parent := range c.ParentHashes[1:] {
+		if repo.timeoutReached() {
+			return
+		}
+		args := append(gitPatchArgs(gitDir, "diff"), parent.String(), c.Hash.String(), "--")
+		out, err := exec.Command("git", args...).Output()
+		if err != nil {
+			log.Errorf("could not generate patch of %s against %s: %v", c.Hash, parent, err)
+			continue
+		}
+		scanGitLogPatch(string(out), c, repo, repo.mergeParent(c, parent))
+	}
+}
+
+// gitLogRange translates the log options used by the go-git walk into `git log` arguments
+func gitLogRange(logOpts *git.LogOptions) []string {
+	var args []string
+	if logOpts.Since != nil {
+		args = append(args, "--since="+logOpts.Since.Format(time.RFC3339))
+	}
+	if logOpts.Until != nil {
+		args = append(args, "--until="+logOpts.Until.Format(time.RFC3339))
+	}
+	if logOpts.All {
+		args = append(args, "--all")
+	} else if !logOpts.From.IsZero() {
+		args = append(args, logOpts.From.String())
+	} else {
+		args = append(args, "HEAD")
+	}
+	return args
+}
+
+// parseGitLogRecord splits a single commit of `git log --format=gitLogFormat -p` output into
+// a commit object and the commit's patch.
+func parseGitLogRecord(record string) (*object.Commit, string, error) {
+	fields := strings.SplitN(record, unitSeparator, 7)
+	if len(fields) != 7 {
+		return nil, "", fmt.Errorf("unable to parse git log record: %q", record)
+	}
+	when, err := time.Parse(time.RFC3339, fields[4])
+	if err != nil {
+		return nil, "", err
+	}
+	var parents []plumbing.Hash
+	for _, p := range strings.Fields(fields[1]) {
+		parents = append(parents, plumbing.NewHash(p))
+	}
+	return &object.Commit{
+		Hash:         plumbing.NewHash(strings.TrimSpace(fields[0])),
+		ParentHashes: parents,
+		Author: object.Signature{
+			Name:  fields[2],
+			Email: fields[3],
+			When:  when,
+		},
+		Message: fields[5],
+	}, strings.TrimPrefix(fields[6], "\n"), nil
+}
+
+// scanGitLogPatch scans the patch of a single commit generated by `git log -p --unified=0`. Added and
+// deleted lines are grouped into chunks the same way go-git chunks patches, and since the hunk headers
+// carry the position of every changed line the line numbers are known without a reverse lookup.
+// mergeParent is the parent the patch was generated against if c is a merge commit.
+func scanGitLogPatch(patch string, c *object.Commit, repo *Repo, mergeParent string) {
+	var (
+		filePath  string
+		oldPath   string
+		skipped   bool
+		checked   bool
+		newFile   bool
+		inHeader  bool
+		chunk     strings.Builder
+		chunkOp   fdiff.Operation
+		chunkLine int
+		oldLine   int
+		newLine   int
+	)
+
+	flush := func() {
+		defer func() {
+			chunk.Reset()
+			chunkOp = fdiff.Equal
+		}()
+		if chunk.Len() == 0 {
+			return
+		}
+		if !checked {
+			// files are skipped by their path and the first changed chunk, as they are in patches of go-git
+			skipped = repo.skipPath(filePath) || repo.skipContent(filePath, chunk.String(), false)
+			checked = true
+		}
+		if !skipped && repo.scanChunk(chunkOp, newFile) {
+			bundle := &Bundle{
+				Commit:      c,
+				Patch:       patch,
+				Content:     chunk.String(),
+				FilePath:    filePath,
+				Operation:   chunkOp,
+				scanType:    patchScan,
+				mergeParent: mergeParent,
+			}
+			if oldPath != filePath {
+				bundle.OldFilePath = oldPath
+			}
+			switch chunkOp {
+			case fdiff.Add:
+				bundle.startLine = chunkLine
+			case fdiff.Delete:
+				bundle.oldStartLine = chunkLine
+			}
+			repo.CheckRules(bundle)
+			if chunkOp == fdiff.Add {
+				repo.scanLFS(c, filePath, bundle.Content)
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(patch))
+	buf := getScanBuffer()
+	defer putScanBuffer(buf)
+	scanner.Buffer(*buf, len(patch)+1)
+	for scanner.Scan() {
+		if repo.timeoutReached() {
+			return
+		}
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			filePath, oldPath, skipped, checked, newFile, inHeader = "", "", false, false, false, true
+		case inHeader && strings.HasPrefix(line, "new file mode "):
+			newFile = true
+		case inHeader && strings.HasPrefix(line, "Binary files "):
+			// binary patches have no chunks, the type of the file is sniffed from its blob
+			path := binaryPatchPath(line)
+			skipped = repo.skipPath(path) || repo.skipContent(path, repo.fileHeadAt(c.Hash, path), true)
+			checked = true
+		case inHeader && strings.HasPrefix(line, "--- "):
+			if p := diffHeaderPath(line); p != "" {
+				filePath, oldPath = p, p
+			}
+		case inHeader && strings.HasPrefix(line, "+++ "):
+			if p := diffHeaderPath(line); p != "" {
+				filePath = p
+			}
+		case strings.HasPrefix(line, "@@ "):
+			flush()
+			inHeader = false
+			oldLine, newLine = hunkOldStart(line), hunkNewStart(line)
+		case inHeader:
+			continue
+		case strings.HasPrefix(line, "+"):
+			if chunkOp != fdiff.Add {
+				flush()
+				chunkOp, chunkLine = fdiff.Add, newLine
+			}
+			chunk.WriteString(line[1:] + "\n")
+			newLine++
+		case strings.HasPrefix(line, "-"):
+			if chunkOp != fdiff.Delete {
+				flush()
+				chunkOp, chunkLine = fdiff.Delete, oldLine
+			}
+			chunk.WriteString(line[1:] + "\n")
+			oldLine++
+		}
+	}
+	flush()
+}
+
+// binaryPatchPath returns the path of the file of a line like "Binary files a/logo.png and b/logo.png differ",
+// the old path if the file was deleted
+func binaryPatchPath(line string) string {
+	paths := strings.SplitN(strings.TrimSuffix(strings.TrimPrefix(line, "Binary files "), " differ"), " and ", 2)
+	if len(paths) != 2 {
+		return ""
+	}
+	if p := diffPath(paths[1]); p != "" {
+		return p
+	}
+	return diffPath(paths[0])
+}
+
+// diffHeaderPath returns the path of a "--- a/path" or "+++ b/path" line of a patch, or "" for /dev/null. git
+// ends these lines with a tab if the path has a space in it.
+func diffHeaderPath(line string) string {
+	return diffPath(strings.TrimSuffix(line[len("--- "):], "\t"))
+}
+
+// diffPath returns the path of a/path or b/path in a patch, or "" for /dev/null. git quotes paths with quotes,
+// backslashes or control characters in them like a C string, which they are unquoted from.
+func diffPath(p string) string {
+	if strings.HasPrefix(p, `"`) {
+		if unquoted, err := strconv.Unquote(p); err == nil {
+			p = unquoted
+		}
+	}
+	if p == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		return p[2:]
+	}
+	return p
+}
+
+// hunkOldStart returns the starting line in the old file of a hunk header like "@@ -3,4 +3 @@"
+func hunkOldStart(header string) int {
+	fields := strings.Fields(strings.TrimPrefix(header, "@@ -"))
+	if len(fields) == 0 {
+		return 0
+	}
+	start, err := strconv.Atoi(strings.Split(fields[0], ",")[0])
+	if err != nil {
+		return 0
+	}
+	return start
+}
+
+// hunkNewStart returns the starting line in the new file of a hunk header like "@@ -3,4 +3 @@"
+func hunkNewStart(header string) int {
+	i := strings.Index(header, " +")
+	if i == -1 {
+		return 0
+	}
+	newRange := strings.Fields(header[i+2:])[0]
+	start, err := strconv.Atoi(strings.Split(newRange, ",")[0])
+	if err != nil {
+		return 0
+	}
+	return start
+}
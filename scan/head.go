@@ -0,0 +1,62 @@
+package scan
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+// headFile is a file of the tree at HEAD, looked up by atHead
+type headFile struct {
+	content string
+	found   bool
+}
+
+// atHead returns whether the secret offender found in the file at path is still in that file at the HEAD of the
+// repo, which --score scores leaks by. An empty offender, as for leaks of rules matching file names, is at HEAD
+// if the file is. Leaks of the worktree and of directories that aren't repos are at HEAD.
+func (repo *Repo) atHead(path, offender string, bundle *Bundle) bool {
+	if !repo.Manager.Opts.Score {
+		return false
+	}
+	if repo.Repository == nil || bundle.Commit.Hash.IsZero() {
+		return true
+	}
+	file := repo.headFile(path)
+	return file.found && strings.Contains(file.content, offender)
+}
+
+// headFile returns the file at path in the tree at HEAD, read once per path
+func (repo *Repo) headFile(path string) headFile {
+	if file, ok := repo.headFiles.Load(path); ok {
+		return file.(headFile)
+	}
+	repo.headTreeOnce.Do(func() {
+		ref, err := repo.Head()
+		if err != nil {
+			log.Debugf("unable to resolve HEAD of %s: %v", repo.Name, err)
+			return
+		}
+		c, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			log.Debugf("unable to read HEAD of %s: %v", repo.Name, err)
+			return
+		}
+		if repo.headTree, err = c.Tree(); err != nil {
+			log.Debugf("unable to read the tree at HEAD of %s: %v", repo.Name, err)
+		}
+	})
+
+	var file headFile
+	if repo.headTree != nil {
+		if f, err := repo.headTree.File(path); err == nil {
+			file.content, err = f.Contents()
+			file.found = err == nil
+		} else if err != object.ErrFileNotFound {
+			log.Debugf("unable to read %s at HEAD of %s: %v", path, repo.Name, err)
+		}
+	}
+	repo.headFiles.Store(path, file)
+	return file
+}
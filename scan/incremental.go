@@ -0,0 +1,90 @@
+package scan
+
+import (
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Heads returns the commits the branches of the repo point at, local and remote-tracking. Passed to
+// SkipReachable for the next scan of the repo they make it scan only the commits added in between.
+func (repo *Repo) Heads() ([]string, error) {
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[plumbing.Hash]bool)
+	var heads []string
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !(ref.Name().IsBranch() || ref.Name().IsRemote()) {
+			return nil
+		}
+		if !seen[ref.Hash()] {
+			seen[ref.Hash()] = true
+			heads = append(heads, ref.Hash().String())
+		}
+		return nil
+	})
+	return heads, err
+}
+
+// SkipReachable makes Scan skip the commits reachable from heads, the branches of an earlier scan of the
+// repo. Heads that no longer exist, like those of force pushed branches that were garbage collected, are
+// ignored.
+func (repo *Repo) SkipReachable(heads []string) error {
+	skip := make(map[plumbing.Hash]bool)
+	for _, head := range heads {
+		c, err := repo.CommitObject(plumbing.NewHash(strings.TrimSpace(head)))
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		// commits already in skip are reachable from an earlier head and aren't walked again
+		err = object.NewCommitPreorderIter(c, skip, nil).ForEach(func(c *object.Commit) error {
+			skip[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		repo.skipHeads = append(repo.skipHeads, c.Hash.String())
+	}
+	repo.skip = skip
+	return nil
+}
+
+// skipCommitIter leaves the commits of a repo's skip set out of a history walk
+type skipCommitIter struct {
+	object.CommitIter
+	skip map[plumbing.Hash]bool
+}
+
+func (iter *skipCommitIter) Next() (*object.Commit, error) {
+	for {
+		c, err := iter.CommitIter.Next()
+		if err != nil || !iter.skip[c.Hash] {
+			return c, err
+		}
+	}
+}
+
+func (iter *skipCommitIter) ForEach(cb func(*object.Commit) error) error {
+	defer iter.Close()
+	for {
+		c, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := cb(c); err == storer.ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
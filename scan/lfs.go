@@ -0,0 +1,146 @@
+package scan
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+	// lfsMaxPointerSize is the size limit of pointer files set by the git lfs spec
+	lfsMaxPointerSize = 1024
+	// defaultLFSMaxSize is used when --lfs-max-size is not set
+	defaultLFSMaxSize = 10 * 1024 * 1024
+)
+
+var (
+	lfsOidRegex  = regexp.MustCompile(`(?m)^oid sha256:([0-9a-f]{64})$`)
+	lfsSizeRegex = regexp.MustCompile(`(?m)^size ([0-9]+)$`)
+)
+
+// lfsPointer is a parsed git lfs pointer file.
+// See https://github.com/git-lfs/git-lfs/blob/master/docs/spec.md
+type lfsPointer struct {
+	oid     string
+	size    int64
+	content string
+}
+
+// parseLFSPointer returns the pointer described by content and true if content is a git lfs pointer file
+func parseLFSPointer(content string) (lfsPointer, bool) {
+	if len(content) > lfsMaxPointerSize || !strings.HasPrefix(content, lfsPointerVersion+"\n") {
+		return lfsPointer{}, false
+	}
+	oid := lfsOidRegex.FindStringSubmatch(content)
+	size := lfsSizeRegex.FindStringSubmatch(content)
+	if oid == nil || size == nil {
+		return lfsPointer{}, false
+	}
+	n, err := strconv.ParseInt(size[1], 10, 64)
+	if err != nil {
+		return lfsPointer{}, false
+	}
+	return lfsPointer{oid: oid[1], size: n, content: content}, true
+}
+
+// scanLFS scans the git lfs object of filePath at commit c if content, the added lines of the file or the
+// whole file, references an lfs object. LFS objects are only scanned when --lfs is set. Objects are read
+// from the repo's local lfs store and otherwise downloaded with `git lfs smudge`. Each object is only scanned once
+// per repo, attributed to the first commit seen that points to it.
+func (repo *Repo) scanLFS(c *object.Commit, filePath, content string) {
+	if !repo.Manager.Opts.LFS || !lfsOidRegex.MatchString(content) {
+		return
+	}
+
+	commit, err := repo.CommitObject(c.Hash)
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	f, err := commit.File(filePath)
+	if err != nil || f.Size > lfsMaxPointerSize {
+		return
+	}
+	pointerContent, err := f.Contents()
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+	pointer, ok := parseLFSPointer(pointerContent)
+	if !ok {
+		return
+	}
+	if _, seen := repo.lfsScanned.LoadOrStore(pointer.oid, true); seen {
+		return
+	}
+
+	maxSize := repo.Manager.Opts.LFSMaxSize
+	if maxSize == 0 {
+		maxSize = defaultLFSMaxSize
+	}
+	if pointer.size > maxSize {
+		log.Debugf("skipping lfs object of %s, %d bytes exceeds --lfs-max-size", filePath, pointer.size)
+		return
+	}
+
+	data, err := repo.lfsObject(pointer)
+	if err != nil {
+		log.Warnf("unable to get lfs object of %s: %v", filePath, err)
+		return
+	}
+	if repo.skipContent(filePath, sniffHead(data), false) {
+		return
+	}
+	repo.CheckRules(&Bundle{
+		Content:   string(data),
+		FilePath:  filePath,
+		Commit:    c,
+		Operation: fdiff.Add,
+		scanType:  commitScan,
+		startLine: 1,
+	})
+}
+
+// lfsObject returns the content of the lfs object described by pointer
+func (repo *Repo) lfsObject(pointer lfsPointer) ([]byte, error) {
+	fsStorer, ok := repo.fsStorage()
+	if !ok {
+		return nil, fmt.Errorf("lfs objects can only be read from repos on disk, use --disk when scanning remote repos")
+	}
+	gitDir := fsStorer.Filesystem().Root()
+
+	localPath := filepath.Join(gitDir, "lfs", "objects", pointer.oid[0:2], pointer.oid[2:4], pointer.oid)
+	if data, err := ioutil.ReadFile(localPath); err == nil {
+		return data, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "lfs", "smudge")
+	cmd.Env = append(append(os.Environ(), "GIT_DIR="+gitDir), repo.gitEnv...)
+	cmd.Stdin = strings.NewReader(pointer.content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git lfs smudge failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// isBinary uses the same heuristic as git, content with a NUL byte in the first 8000 bytes is binary
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
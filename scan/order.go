@@ -0,0 +1,140 @@
+package scan
+
+import (
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// commitLog returns the commits to scan in the order set by --order. topo walks newest commits first and
+// never walks a commit before all of its children, date walks newest commits first by committer date, and
+// reverse walks oldest commits first and never walks a commit before all of its parents.
+// --depth and --commit-to stop the walk, so with reverse they limit the scan to the oldest commits.
+// When --order is not set commits are walked depth-first from each branch tip.
+func (repo *Repo) commitLog(logOpts *git.LogOptions) (object.CommitIter, error) {
+	cIter, err := repo.Log(logOpts)
+	if err == nil && logOpts.All && repo.Manager.Opts.Reflog {
+		cIter = repo.withReflog(cIter)
+	}
+	if err == nil && len(repo.skip) != 0 {
+		cIter = &skipCommitIter{CommitIter: cIter, skip: repo.skip}
+	}
+	if err != nil || repo.Manager.Opts.Order == "" {
+		return cIter, err
+	}
+
+	// go-git only orders the commits reachable from each branch on their own so the
+	// whole history is collected and ordered here
+	var commits []*object.Commit
+	err = cIter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Committer.When.After(commits[j].Committer.When)
+	})
+
+	switch repo.Manager.Opts.Order {
+	case "topo":
+		commits = topoSort(commits)
+	case "reverse":
+		commits = topoSort(commits)
+		for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+			commits[i], commits[j] = commits[j], commits[i]
+		}
+	}
+	return &commitSliceIter{commits: commits}, nil
+}
+
+// topoSort orders commits so that children come before their parents. commits must be sorted newest first,
+// which is used to break ties between commits that are not ancestors of one another.
+func topoSort(commits []*object.Commit) []*object.Commit {
+	children := make(map[plumbing.Hash]int, len(commits))
+	inSet := make(map[plumbing.Hash]bool, len(commits))
+	for _, c := range commits {
+		inSet[c.Hash] = true
+	}
+	for _, c := range commits {
+		for _, p := range c.ParentHashes {
+			if inSet[p] {
+				children[p]++
+			}
+		}
+	}
+
+	index := make(map[plumbing.Hash]int, len(commits))
+	for i, c := range commits {
+		index[c.Hash] = i
+	}
+
+	// ready holds the indexes of commits whose children have all been emitted, newest last
+	var ready []int
+	for i := len(commits) - 1; i >= 0; i-- {
+		if children[commits[i].Hash] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	sorted := make([]*object.Commit, 0, len(commits))
+	for len(ready) != 0 {
+		i := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		c := commits[i]
+		sorted = append(sorted, c)
+		for _, p := range c.ParentHashes {
+			if !inSet[p] {
+				continue
+			}
+			children[p]--
+			if children[p] == 0 {
+				// keep ready sorted by age so the newest ready commit is emitted next
+				j := index[p]
+				k := sort.Search(len(ready), func(k int) bool { return ready[k] < j })
+				ready = append(ready, 0)
+				copy(ready[k+1:], ready[k:])
+				ready[k] = j
+			}
+		}
+	}
+	return sorted
+}
+
+// commitSliceIter implements object.CommitIter over a slice of commits
+type commitSliceIter struct {
+	commits []*object.Commit
+	pos     int
+}
+
+func (iter *commitSliceIter) Next() (*object.Commit, error) {
+	if iter.pos >= len(iter.commits) {
+		return nil, io.EOF
+	}
+	c := iter.commits[iter.pos]
+	iter.pos++
+	return c, nil
+}
+
+func (iter *commitSliceIter) ForEach(cb func(*object.Commit) error) error {
+	for {
+		c, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err := cb(c); err == storer.ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (iter *commitSliceIter) Close() {
+	iter.pos = len(iter.commits)
+}
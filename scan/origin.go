@@ -0,0 +1,71 @@
+package scan
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// originRemote is where a repo was cloned from: the url of its origin and the default branch of the origin.
+// Leaks are attributed to it so reports of many repos don't depend on the names of local directories.
+type originRemote struct {
+	url           string
+	defaultBranch string
+}
+
+// resolveOrigin looks up the origin of the repo and its default branch, once. Repos without an origin, like
+// repos that were never pushed, have none.
+func (repo *Repo) resolveOrigin() *originRemote {
+	repo.originOnce.Do(func() {
+		if repo.Repository == nil {
+			return
+		}
+		remote, err := repo.Remote(git.DefaultRemoteName)
+		if err != nil || len(remote.Config().URLs) == 0 {
+			return
+		}
+		remoteURL := remote.Config().URLs[0]
+		repo.origin = &originRemote{url: redactURL(remoteURL), defaultBranch: repo.defaultBranch()}
+		repo.webRemote = parseWebRemote(remoteURL)
+	})
+	return repo.origin
+}
+
+// defaultBranch returns the branch origin/HEAD points at. Clones without it, like the clones made by
+// gitleaks, have the default branch of the origin checked out.
+func (repo *Repo) defaultBranch() string {
+	originHead := plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName)
+	for _, name := range []plumbing.ReferenceName{originHead, plumbing.HEAD} {
+		ref, err := repo.Storer.Reference(name)
+		if err != nil || ref.Type() != plumbing.SymbolicReference {
+			continue
+		}
+		if target := ref.Target(); target.IsRemote() {
+			return strings.TrimPrefix(target.String(), "refs/remotes/"+git.DefaultRemoteName+"/")
+		} else if target.IsBranch() {
+			return target.Short()
+		}
+	}
+	return ""
+}
+
+// setOrigin attributes leak to the origin of the repo, if it has one
+func (repo *Repo) setOrigin(leak *manager.Leak) {
+	if origin := repo.resolveOrigin(); origin != nil {
+		leak.RemoteURL, leak.DefaultBranch = origin.url, origin.defaultBranch
+	}
+}
+
+// redactURL returns remoteURL without the credentials urls of remotes can hold, like access tokens
+func redactURL(remoteURL string) string {
+	u, err := url.Parse(remoteURL)
+	if err != nil || u.User == nil {
+		return remoteURL
+	}
+	u.User = nil
+	return u.String()
+}
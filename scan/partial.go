@@ -0,0 +1,190 @@
+package scan
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	log "github.com/sirupsen/logrus"
+)
+
+// partialClone clones a repo with `git clone --filter=blob:none` so only commits and trees are downloaded.
+// Blobs are fetched later, and only for the diffs gitleaks actually scans. go-git does not support partial
+// clones so this relies on the git binary.
+func (repo *Repo) partialClone(cloneOption *git.CloneOptions, clonePath string) (*git.Repository, error) {
+	repo.gitEnv = gitEnv(cloneOption, repo.Manager.Opts.GitConfig())
+	cmd := exec.Command("git", "clone", "--quiet", "--filter=blob:none", "--no-checkout", cloneOption.URL, clonePath)
+	cmd.Env = append(os.Environ(), repo.gitEnv...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("partial clone of %s failed: %v %s", cloneOption.URL, err, strings.TrimSpace(string(out)))
+	}
+	repo.partialPath = clonePath
+	return git.PlainOpen(clonePath)
+}
+
+// gitEnv translates the basic auth of clone options and the git config of the transport options into
+// environment variables understood by the git binary. Passing the header through the environment keeps
+// credentials out of the process list.
+func gitEnv(cloneOption *git.CloneOptions, config map[string]string) []string {
+	var env []string
+	if auth, ok := cloneOption.Auth.(*http.BasicAuth); ok && auth != nil {
+		creds := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+		config["http.extraHeader"] = "Authorization: Basic " + creds
+		env = append(env, "GIT_TERMINAL_PROMPT=0")
+	}
+	if len(config) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	env = append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(keys)))
+	for i, key := range keys {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, key), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, config[key]))
+	}
+	return env
+}
+
+// prefetchHistory walks the same commits Scan() will and fetches every blob needed to generate their patches
+// in a single request.
+func (repo *Repo) prefetchHistory(logOpts *git.LogOptions) error {
+	cIter, err := repo.commitLog(logOpts)
+	if err != nil {
+		return err
+	}
+	missing := make(map[plumbing.Hash]bool)
+	cc := 0
+	err = cIter.ForEach(func(c *object.Commit) error {
+		if repo.Manager.Opts.Depth != 0 && cc == repo.Manager.Opts.Depth {
+			return storer.ErrStop
+		}
+		cc++
+		if err := repo.missingBlobs(c, len(c.ParentHashes) == 0, missing); err != nil {
+			return err
+		}
+		if c.Hash.String() == repo.Manager.Opts.CommitTo {
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return repo.fetchBlobs(missing)
+}
+
+// ensureBlobs fetches any blobs of commit c missing from a partial clone. If allFiles is set every file at
+// the commit is fetched, otherwise only the blobs of the diffs against c's parents. go-git caches the
+// packfiles of a repository when it is opened so the commit returned is reloaded from the reopened repository.
+func (repo *Repo) ensureBlobs(c *object.Commit, allFiles bool) (*object.Commit, error) {
+	if repo.partialPath == "" {
+		return c, nil
+	}
+	missing := make(map[plumbing.Hash]bool)
+	if err := repo.missingBlobs(c, allFiles || len(c.ParentHashes) == 0, missing); err != nil {
+		return nil, err
+	}
+	if len(missing) == 0 {
+		return c, nil
+	}
+	if err := repo.fetchBlobs(missing); err != nil {
+		return nil, err
+	}
+	return repo.CommitObject(c.Hash)
+}
+
+// missingBlobs adds the blobs of commit c that are not in the object store to missing. Only trees are
+// read here, which are always present in a blobless clone.
+func (repo *Repo) missingBlobs(c *object.Commit, allFiles bool, missing map[plumbing.Hash]bool) error {
+	add := func(h plumbing.Hash) {
+		if h.IsZero() || missing[h] {
+			return
+		}
+		if repo.Storer.HasEncodedObject(h) != nil {
+			missing[h] = true
+		}
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+	if allFiles {
+		walker := object.NewTreeWalker(tree, true, nil)
+		defer walker.Close()
+		for {
+			_, entry, err := walker.Next()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if entry.Mode.IsFile() {
+				add(entry.Hash)
+			}
+		}
+	}
+
+	return c.Parents().ForEach(func(parent *object.Commit) error {
+		parentTree, err := parent.Tree()
+		if err != nil {
+			return err
+		}
+		changes, err := object.DiffTree(parentTree, tree)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			add(change.From.TreeEntry.Hash)
+			add(change.To.TreeEntry.Hash)
+		}
+		return nil
+	})
+}
+
+// fetchBlobs fetches blobs from the promisor remote of a partial clone and reopens the repository so
+// go-git picks up the new packfile.
+func (repo *Repo) fetchBlobs(missing map[plumbing.Hash]bool) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	var stdin strings.Builder
+	for h := range missing {
+		stdin.WriteString(h.String() + "\n")
+	}
+
+	log.Debugf("fetching %d blobs for %s", len(missing), repo.Name)
+	err := repo.withRetry("fetching blobs for "+repo.Name, func() error {
+		cmd := exec.Command("git", "-c", "fetch.negotiationAlgorithm=noop", "fetch", "--quiet", "origin",
+			"--no-tags", "--no-write-fetch-head", "--recurse-submodules=no", "--filter=blob:none", "--stdin")
+		cmd.Dir = repo.partialPath
+		cmd.Env = append(os.Environ(), repo.gitEnv...)
+		cmd.Stdin = strings.NewReader(stdin.String())
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("could not fetch blobs for %s: %v %s", repo.Name, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	repository, err := git.PlainOpen(repo.partialPath)
+	if err != nil {
+		return err
+	}
+	repo.Repository = repository
+	return nil
+}
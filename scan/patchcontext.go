@@ -0,0 +1,153 @@
+package scan
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	log "github.com/sirupsen/logrus"
+)
+
+// hunkContextLines is the number of lines kept before and after the line of a leak in its Hunk
+const hunkContextLines = 3
+
+// patchContext returns the diff header of the file leak was found in, the header of the hunk containing
+// it and the lines of the hunk around it, looked up in patch (--patch-context). The leak's line is looked
+// up by its content, if it was added more than once in the file the occurrence at the leak's line number
+// is preferred. Patches have no context lines, the unchanged lines around the hunk are read from the lines of the
+// file returned by fileLines.
+func patchContext(patch string, op fdiff.Operation, leak *manager.Leak, fileLines func() []string) (diffHeader, hunkHeader, hunk string) {
+	lines := strings.Split(patch, "\n")
+
+	var (
+		header    []string
+		inHeader  bool
+		file      string
+		newLine   int
+		hunkStart int
+
+		// the first occurrence of the line, used if none is at the leak's line number
+		firstHeader, firstHunkHeader, firstHunk string
+	)
+	deleted := op == fdiff.Delete
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			header, inHeader, file, hunkHeader = []string{line}, true, "", ""
+		case inHeader && strings.HasPrefix(line, "@@ "):
+			inHeader = false
+			hunkHeader, newLine, hunkStart = line, hunkNewStart(line), i
+		case inHeader:
+			header = append(header, line)
+			if strings.HasPrefix(line, "--- ") && file == "" {
+				file = diffHeaderPath(line)
+			} else if strings.HasPrefix(line, "+++ ") {
+				if p := diffHeaderPath(line); p != "" {
+					file = p
+				}
+			}
+		case file != leak.File:
+			continue
+		case strings.HasPrefix(line, "@@ "):
+			hunkHeader, newLine, hunkStart = line, hunkNewStart(line), i
+		case strings.HasPrefix(line, "+"):
+			if !deleted && strings.Contains(line[1:], leak.Line) {
+				if newLine == leak.LineNumber {
+					return strings.Join(header, "\n"), hunkHeader, fileContext(lines, hunkStart, i, fileLines)
+				}
+				if firstHunkHeader == "" {
+					firstHeader, firstHunkHeader, firstHunk = strings.Join(header, "\n"), hunkHeader, fileContext(lines, hunkStart, i, fileLines)
+				}
+			}
+			newLine++
+		case strings.HasPrefix(line, "-"):
+			if deleted && strings.Contains(line[1:], leak.Line) {
+				return strings.Join(header, "\n"), hunkHeader, fileContext(lines, hunkStart, i, fileLines)
+			}
+		case strings.HasPrefix(line, " "):
+			newLine++
+		}
+	}
+	return firstHeader, firstHunkHeader, firstHunk
+}
+
+// fileContext returns line i of the patch lines and up to hunkContextLines lines around it, from the hunk whose
+// header is at hunkStart and the unchanged lines of the file before and after the hunk
+func fileContext(lines []string, hunkStart, i int, fileLines func() []string) string {
+	end := hunkStart + 1
+	for end < len(lines) && inHunk(lines[end]) {
+		end++
+	}
+	var before, after []string
+	if start, count := hunkNewRange(lines[hunkStart]); start != 0 || count != 0 {
+		// ranges of no lines start at the line before them
+		if count == 0 {
+			start++
+		}
+		file := fileLines()
+		for n := start - hunkContextLines; n < start; n++ {
+			if n >= 1 && n <= len(file) {
+				before = append(before, " "+file[n-1])
+			}
+		}
+		for n := start + count; n < start+count+hunkContextLines && n <= len(file); n++ {
+			after = append(after, " "+file[n-1])
+		}
+	}
+	hunk := append(append(before, lines[hunkStart+1:end]...), after...)
+	return hunkContext(hunk, i-hunkStart-1+len(before))
+}
+
+// hunkContext returns line i of the hunk lines and up to hunkContextLines lines of the hunk before and after it
+func hunkContext(lines []string, i int) string {
+	start, end := i, i+1
+	for start > 0 && i-start < hunkContextLines && inHunk(lines[start-1]) {
+		start--
+	}
+	for end < len(lines) && end-i <= hunkContextLines && inHunk(lines[end]) {
+		end++
+	}
+	return strings.Join(lines[start:end], "\n")
+}
+
+func inHunk(line string) bool {
+	return line != "" && strings.IndexByte("+- \\", line[0]) != -1
+}
+
+// hunkNewRange returns the starting line and the number of lines in the new file of a hunk header like
+// "@@ -3,4 +3 @@"
+func hunkNewRange(header string) (start, count int) {
+	i := strings.Index(header, " +")
+	if i == -1 {
+		return 0, 0
+	}
+	newRange := strings.SplitN(strings.Fields(header[i+2:])[0], ",", 2)
+	start, _ = strconv.Atoi(newRange[0])
+	count = 1
+	if len(newRange) == 2 {
+		count, _ = strconv.Atoi(newRange[1])
+	}
+	return start, count
+}
+
+// fileLines returns the lines of the file of bundle at its commit, or none if it can't be read, like for files
+// deleted by the commit
+func (repo *Repo) fileLines(bundle *Bundle) []string {
+	c, err := repo.CommitObject(bundle.Commit.Hash)
+	if err != nil {
+		log.Debugf("unable to read commit %s: %v", bundle.Commit.Hash, err)
+		return nil
+	}
+	f, err := c.File(bundle.FilePath)
+	if err != nil {
+		return nil
+	}
+	content, err := f.Contents()
+	if err != nil {
+		log.Debugf("unable to read %s at %s: %v", bundle.FilePath, bundle.Commit.Hash, err)
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
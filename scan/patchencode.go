@@ -0,0 +1,107 @@
+package scan
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// encodePatch writes patch to w as a unified diff without context lines, like `git diff --unified=0`, so
+// only the changed lines of a patch are kept. The hunks are written here as the hunk headers go-git writes
+// without context lines are off, go-git writes the headers of the files.
+func encodePatch(w io.Writer, patch fdiff.Patch) error {
+	var sb strings.Builder
+	for _, f := range patch.FilePatches() {
+		if err := fdiff.NewUnifiedEncoder(&sb, 0).Encode(headerPatch{f}); err != nil {
+			return err
+		}
+		writeHunks(&sb, f.Chunks())
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeHunks writes the hunks of the changed chunks of a file, a hunk for every run of deleted and added
+// chunks between unchanged ones
+func writeHunks(sb *strings.Builder, chunks []fdiff.Chunk) {
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(chunks); {
+		if chunks[i].Type() == fdiff.Equal {
+			lines := chunkLines(chunks[i].Content())
+			oldLine += lines
+			newLine += lines
+			i++
+			continue
+		}
+		j := i
+		oldCount, newCount := 0, 0
+		for ; j < len(chunks) && chunks[j].Type() != fdiff.Equal; j++ {
+			if chunks[j].Type() == fdiff.Delete {
+				oldCount += chunkLines(chunks[j].Content())
+			} else {
+				newCount += chunkLines(chunks[j].Content())
+			}
+		}
+		sb.WriteString("@@ -" + hunkRange(oldLine, oldCount) + " +" + hunkRange(newLine, newCount) + " @@\n")
+		for _, chunk := range chunks[i:j] {
+			prefix := "+"
+			if chunk.Type() == fdiff.Delete {
+				prefix = "-"
+			}
+			writeChunkLines(sb, prefix, chunk.Content())
+		}
+		oldLine += oldCount
+		newLine += newCount
+		i = j
+	}
+}
+
+// hunkRange returns the range of lines of one side of a hunk header. Like git, ranges of no lines start at
+// the line before them and single line ranges are written without their count.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return strconv.Itoa(start-1) + ",0"
+	case 1:
+		return strconv.Itoa(start)
+	default:
+		return strconv.Itoa(start) + "," + strconv.Itoa(count)
+	}
+}
+
+// writeChunkLines writes the lines of content prefixed with prefix
+func writeChunkLines(sb *strings.Builder, prefix, content string) {
+	for content != "" {
+		line := content
+		if i := strings.IndexByte(content, '\n'); i >= 0 {
+			line, content = content[:i], content[i+1:]
+		} else {
+			content = ""
+			line += "\n\\ No newline at end of file"
+		}
+		sb.WriteString(prefix + line + "\n")
+	}
+}
+
+// headerPatch is a patch of a single file without chunks, go-git encodes only the header of the file of it
+type headerPatch struct {
+	file fdiff.FilePatch
+}
+
+func (p headerPatch) FilePatches() []fdiff.FilePatch {
+	return []fdiff.FilePatch{headerFilePatch{p.file}}
+}
+
+func (p headerPatch) Message() string {
+	return ""
+}
+
+type headerFilePatch struct {
+	fdiff.FilePatch
+}
+
+func (f headerFilePatch) Chunks() []fdiff.Chunk {
+	return nil
+}
@@ -0,0 +1,104 @@
+package scan
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// webRemote is the web interface of a repo's origin on one of the hosts leaks can be linked to
+type webRemote struct {
+	host    string
+	baseURL string
+}
+
+// parseWebRemote returns the web interface of the repo at remote, an http(s), ssh or scp-like git url, or nil
+// if the repo isn't hosted on github, gitlab or bitbucket. Self-hosted github and gitlab instances are
+// recognized by their hostname.
+func parseWebRemote(remote string) *webRemote {
+	remote = strings.TrimSpace(remote)
+	var hostname, repoPath string
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		switch u.Scheme {
+		case "http", "https", "ssh", "git":
+		default:
+			return nil
+		}
+		hostname, repoPath = u.Hostname(), u.Path
+	} else if i := strings.Index(remote, ":"); i > 0 && !strings.Contains(remote[:i], "/") {
+		// scp-like syntax, git@github.com:owner/repo.git
+		hostname, repoPath = remote[:i], remote[i+1:]
+		if at := strings.LastIndex(hostname, "@"); at >= 0 {
+			hostname = hostname[at+1:]
+		}
+	} else {
+		return nil
+	}
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if hostname == "" || !strings.Contains(repoPath, "/") {
+		return nil
+	}
+
+	var host string
+	switch {
+	case hostname == "bitbucket.org":
+		host = "bitbucket"
+	case strings.Contains(hostname, "github"):
+		host = "github"
+	case strings.Contains(hostname, "gitlab"):
+		host = "gitlab"
+	default:
+		return nil
+	}
+	return &webRemote{host: host, baseURL: "https://" + hostname + "/" + repoPath}
+}
+
+// permalink returns the url of file at commit, pointing at lineNumber when it's known. Deleted files link
+// to the commit as the file doesn't exist at it.
+func (w *webRemote) permalink(commit, file string, lineNumber int, operation fdiff.Operation) string {
+	if commit == "" {
+		return ""
+	}
+	if operation == fdiff.Delete {
+		switch w.host {
+		case "github":
+			return fmt.Sprintf("%s/commit/%s", w.baseURL, commit)
+		case "gitlab":
+			return fmt.Sprintf("%s/-/commit/%s", w.baseURL, commit)
+		default:
+			return fmt.Sprintf("%s/commits/%s", w.baseURL, commit)
+		}
+	}
+
+	segments := strings.Split(file, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	file = strings.Join(segments, "/")
+	var link, anchor string
+	switch w.host {
+	case "github":
+		link, anchor = fmt.Sprintf("%s/blob/%s/%s", w.baseURL, commit, file), "#L%d"
+	case "gitlab":
+		link, anchor = fmt.Sprintf("%s/-/blob/%s/%s", w.baseURL, commit, file), "#L%d"
+	default:
+		link, anchor = fmt.Sprintf("%s/src/%s/%s", w.baseURL, commit, file), "#lines-%d"
+	}
+	if lineNumber > 0 {
+		link += fmt.Sprintf(anchor, lineNumber)
+	}
+	return link
+}
+
+// permalink returns the url of leak l, found in bundle, on the web interface of the repo's origin or an empty
+// string if the origin isn't a known host
+func (repo *Repo) permalink(l manager.Leak, bundle *Bundle) string {
+	if repo.resolveOrigin() == nil || repo.webRemote == nil {
+		return ""
+	}
+	return repo.webRemote.permalink(l.Commit, bundle.FilePath, l.LineNumber, bundle.Operation)
+}
@@ -0,0 +1,171 @@
+package scan
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// pipeline scans the commits of a history walk in two stages with their own pools of workers.
+// Patch workers diff commits against their parents and scan workers match the rules against
+// the resulting patches, so slow patch generation no longer holds back rule matching and vice
+// versa. The queues between the stages are bounded, a stage that falls behind blocks the stage
+// feeding it instead of buffering the history in memory.
+//
+// Each stage is traced as one span lasting from the start of the first job to the end of the last,
+// with the number of jobs and the time the workers spent on them as attributes. A span per commit
+// would flood the trace backend on large histories.
+type pipeline struct {
+	// accessed atomically, kept first for 64-bit alignment
+	patchCount, patchTime int64
+	scanCount, scanTime   int64
+
+	patchSpan trace.Span
+	scanSpan  trace.Span
+
+	repo    *Repo
+	patches chan patchJob
+	scans   chan scanJob
+	patchWG sync.WaitGroup
+	scanWG  sync.WaitGroup
+}
+
+// patchJob is a commit to diff against one of its parents
+type patchJob struct {
+	c           *object.Commit
+	parent      *object.Commit
+	mergeParent string
+}
+
+// scanJob is the patch of a commit to match the rules against
+type scanJob struct {
+	c           *object.Commit
+	patch       *object.Patch
+	mergeParent string
+}
+
+// newPipeline starts the workers of both stages. The patch stage is sized by howManyPatchThreads
+// and the scan stage by howManyThreads.
+func newPipeline(repo *Repo) *pipeline {
+	patchThreads := howManyPatchThreads(repo.Manager.Opts.Threads, repo.Manager.Opts.AutoThreads)
+	scanThreads := howManyThreads(repo.Manager.Opts.Threads, repo.Manager.Opts.AutoThreads)
+	p := &pipeline{
+		repo:    repo,
+		patches: make(chan patchJob, patchThreads),
+		scans:   make(chan scanJob, scanThreads),
+	}
+	_, p.patchSpan = repo.startSpan("generate patches", attribute.Int("gitleaks.threads", patchThreads))
+	_, p.scanSpan = repo.startSpan("match rules", attribute.Int("gitleaks.threads", scanThreads))
+	p.patchWG.Add(patchThreads)
+	for i := 0; i < patchThreads; i++ {
+		go p.patchWorker()
+	}
+	p.scanWG.Add(scanThreads)
+	for i := 0; i < scanThreads; i++ {
+		go p.scanWorker()
+	}
+	return p
+}
+
+// add queues commit c to be diffed against parent. It blocks while the patch queue is full.
+func (p *pipeline) add(c, parent *object.Commit) {
+	p.patches <- patchJob{
+		c:           c,
+		parent:      parent,
+		mergeParent: p.repo.mergeParent(c, parent.Hash),
+	}
+}
+
+// wait blocks until every queued commit has been scanned and stops the workers
+func (p *pipeline) wait() {
+	close(p.patches)
+	p.patchWG.Wait()
+	endStageSpan(p.patchSpan, p.patchCount, p.patchTime)
+	close(p.scans)
+	p.scanWG.Wait()
+	endStageSpan(p.scanSpan, p.scanCount, p.scanTime)
+}
+
+// endStageSpan ends the span of a pipeline stage that processed count patches in busy nanoseconds of worker time
+func endStageSpan(span trace.Span, count, busy int64) {
+	span.SetAttributes(
+		attribute.Int64("gitleaks.patches", count),
+		attribute.Int64("gitleaks.worker_time_ms", time.Duration(busy).Milliseconds()),
+	)
+	span.End()
+}
+
+func (p *pipeline) patchWorker() {
+	defer p.patchWG.Done()
+	s := p.repo.workerStorer()
+	for job := range p.patches {
+		// keep draining the queue after a timeout so add() doesn't block
+		if p.repo.timeoutReached() {
+			continue
+		}
+		start := time.Now()
+		patch, err := p.repo.generatePatch(s, job.parent, job.c)
+		atomic.AddInt64(&p.patchTime, int64(time.Since(start)))
+		atomic.AddInt64(&p.patchCount, 1)
+		if err != nil {
+			log.Errorf("could not generate Patch: %v", err)
+			continue
+		}
+		p.scans <- scanJob{c: job.c, patch: patch, mergeParent: job.mergeParent}
+	}
+}
+
+func (p *pipeline) scanWorker() {
+	defer p.scanWG.Done()
+	for job := range p.scans {
+		if p.repo.timeoutReached() {
+			continue
+		}
+		start := time.Now()
+		scanPatch(job.patch, job.c, p.repo, job.mergeParent)
+		atomic.AddInt64(&p.scanTime, int64(time.Since(start)))
+		atomic.AddInt64(&p.scanCount, 1)
+	}
+}
+
+// workerStorer returns the object storage used by a patch worker. go-git's object cache isn't safe
+// for concurrent use so each worker reading from a repo on disk gets a storage with its own cache.
+func (repo *Repo) workerStorer() storer.EncodedObjectStorer {
+	fsStorer, ok := repo.fsStorage()
+	if !ok {
+		return repo.Storer
+	}
+	return filesystem.NewStorage(fsStorer.Filesystem(), cache.NewObjectLRUDefault())
+}
+
+// generatePatch diffs commit c against parent, reading the objects from s, and records the time it took
+func (repo *Repo) generatePatch(s storer.EncodedObjectStorer, parent, c *object.Commit) (patch *object.Patch, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			// sometimes the Patch generation will fail due to a known bug in
+			// sergi's go-diff: https://github.com/sergi/go-diff/issues/89.
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	start := time.Now()
+	if parent, err = object.GetCommit(s, parent.Hash); err != nil {
+		return nil, err
+	}
+	if c, err = object.GetCommit(s, c.Hash); err != nil {
+		return nil, err
+	}
+	patch, err = parent.Patch(c)
+	repo.Manager.RecordTime(manager.PatchTime(howLong(start)))
+	return patch, err
+}
@@ -0,0 +1,50 @@
+package scan
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledSize keeps buffers grown by unusually large files or patches out of the pools so a single
+// large file doesn't pin its memory for the rest of the scan
+const maxPooledSize = 1024 * 1024
+
+// Buffers used for every file, patch and chunk scanned are reused through these pools.
+// Large scans otherwise allocate them from scratch millions of times and spend a measurable share
+// of the scan in the garbage collector.
+var (
+	bufferPool = sync.Pool{
+		New: func() interface{} { return new(bytes.Buffer) },
+	}
+	scanBufferPool = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, 64*1024)
+			return &b
+		},
+	}
+)
+
+// getBuffer returns an empty buffer from the pool. Strings taken from the buffer must be copied,
+// for example with buf.String(), before the buffer is returned with putBuffer.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// getScanBuffer returns a buffer for a bufio.Scanner. Scanners grow their buffer on their own
+// when lines are longer than the pooled buffer.
+func getScanBuffer() *[]byte {
+	return scanBufferPool.Get().(*[]byte)
+}
+
+func putScanBuffer(b *[]byte) {
+	scanBufferPool.Put(b)
+}
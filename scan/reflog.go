@@ -0,0 +1,131 @@
+package scan
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	log "github.com/sirupsen/logrus"
+)
+
+// reflogTips returns the commits recorded in the reflogs of the repo (--include-reflog), the old and new commit of
+// every entry. Amended and rebased commits are only reachable from there until they are pruned. go-git doesn't
+// read reflogs, they are read from the logs directory of the repo on disk.
+func (repo *Repo) reflogTips() []plumbing.Hash {
+	fsStorer, ok := repo.fsStorage()
+	if !ok {
+		return nil
+	}
+	fs := fsStorer.Filesystem()
+	var (
+		tips []plumbing.Hash
+		seen = make(map[plumbing.Hash]bool)
+		walk func(dir string)
+	)
+	walk = func(dir string) {
+		infos, err := fs.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, info := range infos {
+			path := fs.Join(dir, info.Name())
+			if info.IsDir() {
+				walk(path)
+				continue
+			}
+			f, err := fs.Open(path)
+			if err != nil {
+				log.Debugf("unable to read reflog %s: %v", path, err)
+				continue
+			}
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				// <old> <new> <committer> <time> <zone>\t<message>
+				fields := strings.Fields(scanner.Text())
+				if len(fields) < 2 {
+					continue
+				}
+				for _, field := range fields[:2] {
+					hash := plumbing.NewHash(field)
+					if len(field) == 40 && !hash.IsZero() && !seen[hash] {
+						seen[hash] = true
+						tips = append(tips, hash)
+					}
+				}
+			}
+			_ = f.Close()
+		}
+	}
+	walk("logs")
+	return tips
+}
+
+// reflogCommitIter walks the commits of a walk of the refs of the repo, then the commits only reachable from
+// the reflog, from tips
+type reflogCommitIter struct {
+	object.CommitIter
+	repo *Repo
+	tips []plumbing.Hash
+	seen map[plumbing.Hash]bool
+}
+
+// withReflog returns cIter followed by the commits only reachable from the reflog of the repo
+func (repo *Repo) withReflog(cIter object.CommitIter) object.CommitIter {
+	return &reflogCommitIter{
+		CommitIter: cIter,
+		repo:       repo,
+		tips:       repo.reflogTips(),
+		seen:       make(map[plumbing.Hash]bool),
+	}
+}
+
+func (iter *reflogCommitIter) Next() (*object.Commit, error) {
+	for {
+		c, err := iter.CommitIter.Next()
+		if err == io.EOF && len(iter.tips) != 0 {
+			tip := iter.tips[0]
+			iter.tips = iter.tips[1:]
+			if iter.seen[tip] {
+				continue
+			}
+			// commits of the reflog may be pruned already
+			commit, err := iter.repo.CommitObject(tip)
+			if err != nil {
+				log.Debugf("skipping reflog entry %s: %v", tip, err)
+				continue
+			}
+			iter.CommitIter.Close()
+			// the walk stops at the commits already walked
+			iter.CommitIter = object.NewCommitPreorderIter(commit, iter.seen, nil)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if iter.seen[c.Hash] {
+			continue
+		}
+		iter.seen[c.Hash] = true
+		return c, nil
+	}
+}
+
+func (iter *reflogCommitIter) ForEach(cb func(*object.Commit) error) error {
+	defer iter.Close()
+	for {
+		c, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := cb(c); err == storer.ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package scan
+
+import (
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v6/manager"
+)
+
+// removedNotRotated marks leak, found in a line removed by the commit of bundle (--include-deletion), as
+// removed-not-rotated. Removing a secret leaves it in the history, it has to be rotated all the same. The commit
+// that introduced the line is found by blaming the parent the commit was diffed against.
+func (repo *Repo) removedNotRotated(leak *manager.Leak, bundle *Bundle, offset int) {
+	leak.Category = manager.CategoryRemovedNotRotated
+	if bundle.oldStartLine < 1 || bundle.Commit == nil || repo.Repository == nil {
+		return
+	}
+	parent := bundle.mergeParent
+	if parent == "" {
+		if len(bundle.Commit.ParentHashes) == 0 {
+			return
+		}
+		parent = bundle.Commit.ParentHashes[0].String()
+	}
+	path := bundle.FilePath
+	if bundle.OldFilePath != "" {
+		path = bundle.OldFilePath
+	}
+	lines := repo.blame(parent, path)
+	if n := bundle.oldStartLine + strings.Count(bundle.Content[:offset], "\n"); n <= len(lines) && lines[n-1].text == leak.Line {
+		leak.IntroducedCommit = lines[n-1].hash.String()
+	}
+}
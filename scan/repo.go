@@ -9,6 +9,8 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/zricethezav/gitleaks/v6/config"
@@ -18,8 +20,10 @@ import (
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage/memory"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Repo wraps a *git.Repository object in addition to a manager object and the name of the repo.
@@ -36,21 +40,58 @@ type Repo struct {
 	// for those repo scans.
 	config config.Config
 
+	// rules is the rule set of config, set along with it by setConfig
+	rules *ruleSet
+
 	// ctx is used to signal timeouts to running goroutines
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	Name    string
 	Manager *manager.Manager
+
+	// partialPath is the location of a partial clone (--partial-clone) and gitEnv holds the
+	// environment used when fetching missing blobs for it.
+	partialPath string
+	gitEnv      []string
+
+	// cachePath is the location of the clone of the repo kept in --clone-cache-dir
+	cachePath string
+
+	// lfsScanned holds the oids of lfs objects already scanned (--lfs)
+	lfsScanned sync.Map
+
+	// signatures holds the signature kind and key of the commits leaks were found in, by commit hash, and
+	// blames the blame of the files of leaks (--blame), by commit hash and path
+	signatures sync.Map
+	blames     blameCache
+
+	// headTree is the tree at HEAD and headFiles its files leaks were found in, by path, looked up with
+	// --score to tell whether leaks are still at HEAD
+	headTree     *object.Tree
+	headTreeOnce sync.Once
+	headFiles    sync.Map
+
+	// origin is the origin of the repo leaks are attributed to, resolved when the scan starts, and webRemote
+	// its web interface leaks link to
+	origin     *originRemote
+	originOnce sync.Once
+	webRemote  *webRemote
+
+	// skip holds the commits of an earlier scan that are left out of the history walk, skipHeads the
+	// branch heads they were collected from. See SkipReachable.
+	skip      map[plumbing.Hash]bool
+	skipHeads []string
 }
 
 // NewRepo initializes and returns a Repo struct.
 func NewRepo(m *manager.Manager) *Repo {
-	return &Repo{
+	repo := &Repo{
 		Manager: m,
-		config:  m.Config,
 		ctx:     context.Background(),
 	}
+	repo.setConfig(m.Config)
+	return repo
 }
 
 // Run accepts a manager and begins an scan based on the options/configs set in the manager.
@@ -61,6 +102,9 @@ func Run(m *manager.Manager) error {
 			return err
 		}
 		for _, f := range files {
+			if m.Stopped() {
+				break
+			}
 			if !f.IsDir() {
 				continue
 			}
@@ -85,7 +129,42 @@ func runHelper(r *Repo) error {
 			return nil
 		}
 	}
-	if r.Manager.Opts.OpenLocal() {
+	span := r.StartSpan(r.Manager.Opts.Target())
+	defer span.End()
+
+	if r.Manager.Opts.Env.Active {
+		return r.scanEnv(r.Manager.Opts.Env.EnvFile)
+	}
+	if r.Manager.Opts.CommitMsgFile != "" {
+		// commit-msg hooks run in the top level directory of the repo
+		if dir, err := os.Getwd(); err == nil {
+			r.Name = filepath.Base(dir)
+		}
+		return r.scanCommitMessage(r.Manager.Opts.CommitMsgFile)
+	}
+	if r.Manager.Opts.Artifact != "" {
+		r.Name = filepath.Base(r.Manager.Opts.Artifact)
+		return r.scanArtifact(r.Manager.Opts.Artifact)
+	}
+	if r.Manager.Opts.NoGit {
+		dir := r.Manager.Opts.RepoPath
+		if dir == "" {
+			dir = "."
+		}
+		r.Name = filepath.Base(dir)
+		return r.scanDir(dir)
+	}
+	if r.Manager.Opts.Bundle != "" || r.Manager.Opts.FastExport != "" {
+		var err error
+		if r.Manager.Opts.Bundle != "" {
+			err = r.OpenBundle(r.Manager.Opts.Bundle)
+		} else {
+			err = r.OpenFastExport(r.Manager.Opts.FastExport)
+		}
+		if err != nil {
+			return err
+		}
+	} else if r.Manager.Opts.OpenLocal() {
 		r.Name = path.Base(r.Manager.Opts.RepoPath)
 		if err := r.Open(); err != nil {
 			return err
@@ -104,11 +183,42 @@ func runHelper(r *Repo) error {
 			return err
 		}
 	}
-	return r.Scan()
+	if err := r.Scan(); err != nil {
+		return err
+	}
+
+	if r.Manager.Opts.IncludeWikis && r.Manager.Opts.Repo != "" {
+		return scanWiki(r.Manager)
+	}
+	return nil
+}
+
+// scanWiki clones and scans the wiki of the remote repo set by --repo. Wikis that have never
+// been edited do not have a repository so failing to clone one is not treated as an error.
+func scanWiki(m *manager.Manager) error {
+	cloneOpts := *m.CloneOptions
+	cloneOpts.URL = WikiURL(m.Opts.Repo)
+
+	wiki := NewRepo(m)
+	span := wiki.StartSpan(cloneOpts.URL)
+	defer span.End()
+	if err := wiki.Clone(&cloneOpts); err != nil {
+		log.Infof("no wiki found for %s: %v", m.Opts.Repo, err)
+		return nil
+	}
+	wiki.Name = strings.TrimSuffix(filepath.Base(cloneOpts.URL), ".git")
+	return wiki.Scan()
+}
+
+// WikiURL returns the clone url of the wiki belonging to the repo at url. This follows github's
+// convention of hosting wikis at {repo}.wiki.git
+func WikiURL(url string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git") + ".wiki.git"
 }
 
 // Clone will clone a repo and return a Repo struct which contains a go-git repo. The clone method
-// is determined by the clone options set in Manager.metadata.cloneOptions
+// is determined by the clone options set in Manager.metadata.cloneOptions. Transient failures are
+// retried with backoff, see withRetry.
 func (repo *Repo) Clone(cloneOption *git.CloneOptions) error {
 	var (
 		repository *git.Repository
@@ -118,15 +228,33 @@ func (repo *Repo) Clone(cloneOption *git.CloneOptions) error {
 		cloneOption = repo.Manager.CloneOptions
 	}
 
-	log.Infof("cloning... %s", cloneOption.URL)
+	if repo.Manager.Opts.CloneCache == "" {
+		// FetchClone logs whether cached clones are cloned or fetched
+		log.Infof("cloning... %s", cloneOption.URL)
+	}
 	start := time.Now()
+	_, span := repo.startSpan("clone", attribute.String("gitleaks.url", cloneOption.URL))
 
-	if repo.Manager.CloneDir != "" {
+	err = repo.withRetry("cloning "+cloneOption.URL, func() error {
+		// every attempt clones into a new directory so a failed attempt can't leave a partial clone behind,
+		// cached clones are removed by FetchClone if cloning them fails
 		clonePath := fmt.Sprintf("%s/%x", repo.Manager.CloneDir, md5.Sum([]byte(time.Now().String())))
-		repository, err = git.PlainClone(clonePath, false, cloneOption)
-	} else {
-		repository, err = git.Clone(memory.NewStorage(), nil, cloneOption)
-	}
+		if repo.Manager.Opts.CloneCache != "" {
+			repo.cachePath = cachedClonePath(repo.Manager.Opts.CloneCache, cloneOption.URL)
+			repository, err = FetchClone(repo.cachePath, cloneOption)
+		} else if repo.Manager.Opts.PartialClone {
+			repository, err = repo.partialClone(cloneOption, clonePath)
+		} else if repo.Manager.Opts.MemoryLimit != 0 && !repo.Manager.Opts.Disk {
+			spill := newSpillStorage(repo.Manager.Opts.MemoryLimit, repo.Manager.CloneDir, cloneOption.URL)
+			repository, err = git.Clone(spill, nil, cloneOption)
+		} else if repo.Manager.CloneDir != "" {
+			repository, err = git.PlainClone(clonePath, false, cloneOption)
+		} else {
+			repository, err = git.Clone(memory.NewStorage(), nil, cloneOption)
+		}
+		return err
+	})
+	endSpan(span, err)
 	if err != nil {
 		return err
 	}
@@ -138,10 +266,13 @@ func (repo *Repo) Clone(cloneOption *git.CloneOptions) error {
 }
 
 // howManyThreads will return a number 1-GOMAXPROCS which is the number
-// of goroutines that will spawn during gitleaks execution
-func howManyThreads(threads int) int {
+// of goroutines matching rules during gitleaks execution. auto uses GOMAXPROCS.
+func howManyThreads(threads int, auto bool) int {
 	maxThreads := runtime.GOMAXPROCS(0)
-	if threads == 0 {
+	if auto {
+		return maxThreads
+	}
+	if threads <= 0 {
 		return 1
 	} else if threads > maxThreads {
 		log.Warnf("%d threads set too high, setting to system max, %d", threads, maxThreads)
@@ -150,6 +281,16 @@ func howManyThreads(threads int) int {
 	return threads
 }
 
+// howManyPatchThreads returns the number of goroutines generating patches. Patch generation spends
+// much of its time reading and inflating objects so auto oversubscribes the CPUs, otherwise it is
+// the same as howManyThreads.
+func howManyPatchThreads(threads int, auto bool) int {
+	if auto {
+		return 2 * runtime.GOMAXPROCS(0)
+	}
+	return howManyThreads(threads, auto)
+}
+
 // getLogOptions determines what log options are used when iterating through commits.
 // It is similar to `git log {branch}`. Default behavior is to log ALL branches so
 // gitleaks gets the full git history.
@@ -262,21 +403,44 @@ func (repo *Repo) loadRepoConfig() (config.Config, error) {
 	}
 	defer f.Close()
 	var tomlLoader config.TomlLoader
-	_, err = toml.DecodeReader(f, &tomlLoader)
+	meta, err := toml.DecodeReader(f, &tomlLoader)
 	if err != nil {
 		return config.Config{}, err
 	}
+	if err := tomlLoader.CheckSchema(meta); err != nil {
+		return config.Config{}, err
+	}
 
-	return tomlLoader.Parse()
+	cfg, err := tomlLoader.Parse()
+	if err != nil {
+		return cfg, err
+	}
+	if allowed := repo.Manager.Opts.RepoConfigAllowed(); allowed != nil {
+		cfg = repo.Manager.Config.Sandbox(cfg, allowed)
+	} else if repo.Manager.Config.Policy != nil {
+		// repo configs can't weaken the policy of the organization
+		cfg = repo.Manager.Config.Policy.Merge(cfg)
+	}
+	if tags := repo.Manager.Opts.EnableRules; tags != "" {
+		// the optional rules are enabled for the scan, whatever config the repo has
+		err = cfg.EnableOptionalRules(tags)
+	}
+	return cfg, err
 }
 
-// timeoutReached returns true if the timeout deadline has been met. This function should be used
-// at the top of loops and before potentially long running goroutines (like checking inefficient regexes)
+// timeoutReached returns true if the timeout deadline has been met or the manager stopped the scan early. This
+// function should be used at the top of loops and before potentially long running goroutines (like checking
+// inefficient regexes)
 func (repo *Repo) timeoutReached() bool {
 	if repo.ctx.Err() == context.DeadlineExceeded {
 		return true
 	}
-	return false
+	return repo.Manager.Stopped()
+}
+
+// TimedOut returns true if the scan of the repo was cut short by --timeout
+func (repo *Repo) TimedOut() bool {
+	return repo.ctx.Err() == context.DeadlineExceeded
 }
 
 // setupTimeout parses the --timeout option and assigns a context with timeout to the manager
@@ -290,7 +454,7 @@ func (repo *Repo) setupTimeout() error {
 		return err
 	}
 
-	repo.ctx, repo.cancel = context.WithTimeout(context.Background(), timeout)
+	repo.ctx, repo.cancel = context.WithTimeout(repo.ctx, timeout)
 
 	go func() {
 		select {
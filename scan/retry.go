@@ -0,0 +1,72 @@
+package scan
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	log "github.com/sirupsen/logrus"
+)
+
+// retryBaseDelay is the delay before the first retry of a failed clone or fetch. The delay doubles with
+// every further retry up to retryMaxDelay.
+var retryBaseDelay = time.Second
+
+const retryMaxDelay = 30 * time.Second
+
+// permanentGitErrors are messages of the git binary for failures that retrying won't fix
+var permanentGitErrors = []string{
+	"Authentication failed",
+	"Repository not found",
+	"could not read Username",
+	"does not appear to be a git repository",
+}
+
+// withRetry calls f until it succeeds, fails with an error that isn't transient, or --clone-retries
+// retries have been made. what describes the operation in log messages.
+func (repo *Repo) withRetry(what string, f func() error) error {
+	retries := repo.Manager.Opts.CloneRetries
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= retries || !isTransient(err) {
+			return err
+		}
+		delay := backoff(attempt)
+		log.Warnf("%s failed, retry %d/%d in %s: %v", what, attempt+1, retries, delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
+	}
+}
+
+// backoff returns the delay before retry attempt+1. The delay is randomized between half and all of the
+// exponential delay so repos failing at the same time, like during an org scan, don't retry in lockstep.
+func backoff(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 16 && retryBaseDelay<<uint(attempt) < retryMaxDelay {
+		delay = retryBaseDelay << uint(attempt)
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// isTransient returns false for errors like missing repos or bad credentials where a retry would fail
+// the same way. Anything else, network errors in particular, is worth retrying.
+func isTransient(err error) bool {
+	for _, permanent := range []error{
+		transport.ErrRepositoryNotFound,
+		transport.ErrEmptyRemoteRepository,
+		transport.ErrAuthenticationRequired,
+		transport.ErrAuthorizationFailed,
+		transport.ErrInvalidAuthMethod,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	for _, msg := range permanentGitErrors {
+		if strings.Contains(err.Error(), msg) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,13 +1,8 @@
 package scan
 
 import (
-	"bufio"
-	"fmt"
-	"io"
 	"math"
-	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -19,144 +14,307 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-const (
-	diffAddPrefix           = "+"
-	diffAddFilePrefix       = "+++ b"
-	diffAddFilePrefixSlash  = "+++ b/"
-	diffLineSignature       = " @@"
-	diffLineSignaturePrefix = "@@ "
-	defaultLineNumber       = -1
-)
+const defaultLineNumber = -1
 
 // CheckRules accepts bundle and checks each rule defined in the config against the bundle's content.
 func (repo *Repo) CheckRules(bundle *Bundle) {
-	filename := filepath.Base(bundle.FilePath)
-	path := filepath.Dir(bundle.FilePath)
+	path, filename := config.SplitPath(bundle.FilePath)
 
-	bundle.lineLookup = make(map[string]bool)
+	if !repo.Manager.AddScannedBytes(len(bundle.Content)) {
+		return
+	}
 
-	// We want to check if there is a allowlist for this file
-	if len(repo.config.Allowlist.Files) != 0 {
-		for _, reFileName := range repo.config.Allowlist.Files {
-			if RegexMatched(filename, reFileName) {
-				log.Debugf("allowlisted file found, skipping scan of file: %s", filename)
-				return
-			}
-		}
+	var obfuscatedStrings []obfuscatedString
+	if repo.Manager.Opts.Deobfuscate {
+		obfuscatedStrings = deobfuscate(bundle.Content)
 	}
 
-	// We want to check if there is a allowlist for this path
-	if len(repo.config.Allowlist.Paths) != 0 {
-		for _, reFilePath := range repo.config.Allowlist.Paths {
-			if RegexMatched(path, reFilePath) {
-				log.Debugf("file in allowlisted path found, skipping scan of file: %s", filename)
-				return
-			}
-		}
+	// We want to check if there is a allowlist for this file or path. Only the rules ignoring the global
+	// allowlist are checked in allowlisted files.
+	globallyAllowListed := false
+	if isAllowListed(filename, repo.config.Allowlist.Files) {
+		log.Debugf("allowlisted file found, skipping scan of file: %s", filename)
+		globallyAllowListed = true
+	} else if isAllowListed(path, repo.config.Allowlist.Paths) {
+		log.Debugf("file in allowlisted path found, skipping scan of file: %s", filename)
+		globallyAllowListed = true
+	}
+	if globallyAllowListed && !repo.rules.ignoresGlobalAllowlist {
+		return
 	}
 
-	for _, rule := range repo.config.Rules {
+	for _, rule := range repo.rules.rules {
 		start := time.Now()
 
-		// For each rule we want to check filename allowlists
-		if isAllowListed(filename, rule.AllowList.Files) || isAllowListed(path, rule.AllowList.Paths) {
-			continue
-		}
-
-		// If it has fileNameRegex and it doesnt match we continue to next rule
-		if ruleContainFileRegex(rule) && !RegexMatched(filename, rule.File) {
+		if globallyAllowListed && !rule.IgnoreGlobalAllowlist {
 			continue
 		}
 
-		// If it has filePathRegex and it doesnt match we continue to next rule
-		if ruleContainPathRegex(rule) && !RegexMatched(path, rule.Path) {
+		// For each rule we want to check filename allowlists and the files and paths the rule applies to
+		if rule.skipsFile(filename, path) {
 			continue
 		}
 
 		// If it doesnt contain a Content regex then it is a filename regex match
-		if !ruleContainRegex(rule) {
-			repo.Manager.SendLeaks(manager.Leak{
-				LineNumber: defaultLineNumber,
-				Line:       "N/A",
-				Offender:   "Filename/path offender: " + filename,
-				Commit:     bundle.Commit.Hash.String(),
-				Repo:       repo.Name,
-				Message:    bundle.Commit.Message,
-				Rule:       rule.Description,
-				Author:     bundle.Commit.Author.Name,
-				Email:      bundle.Commit.Author.Email,
-				Date:       bundle.Commit.Author.When,
-				Tags:       strings.Join(rule.Tags, ", "),
-				File:       filename,
-				Operation:  diffOpToString(bundle.Operation),
-			})
+		if !ruleContainRegex(rule.Rule) {
+			leak := manager.Leak{
+				LineNumber:  defaultLineNumber,
+				Line:        "N/A",
+				Offender:    "Filename/path offender: " + filename,
+				Commit:      bundle.Commit.Hash.String(),
+				Repo:        repo.Name,
+				Message:     bundle.Commit.Message,
+				Rule:        rule.Description,
+				RuleID:      rule.ID,
+				RuleRegex:   fileRuleRegex(rule.Rule),
+				Author:      bundle.Commit.Author.Name,
+				Email:       bundle.Commit.Author.Email,
+				Date:        bundle.Commit.Author.When,
+				Tags:        strings.Join(rule.Tags, ", "),
+				File:        filename,
+				OldFile:     bundle.OldFilePath,
+				MergeParent: bundle.mergeParent,
+				Operation:   diffOpToString(bundle.Operation),
+				ReportOnly:  rule.ReportOnly,
+				Severity:    rule.Severity,
+			}
+			leak.Signature, leak.SigningKey = repo.commitSignature(bundle.Commit)
+			leak.URL = repo.permalink(leak, bundle)
+			repo.setOrigin(&leak)
+			leak.AtHead = repo.atHead(bundle.FilePath, "", bundle)
+			repo.Manager.SendLeaks(leak)
 		} else {
 			//otherwise we check if it matches Content regex
-			locs := rule.Regex.FindAllIndex([]byte(bundle.Content), -1)
-			if len(locs) != 0 {
-				for _, loc := range locs {
-					start := loc[0]
-					end := loc[1]
-					for start != 0 && bundle.Content[start] != '\n' {
-						start--
-					}
+			for _, match := range rule.matches(bundle.Content) {
+				repo.checkMatch(bundle, rule, match)
+			}
 
-					if bundle.Content[start] == '\n' {
-						start++
+			// secrets reassembled from obfuscated strings are reported with the expression they are built by,
+			// unless the rule finds them in the expression as it is. Rules needing several matches are only
+			// checked against the content.
+			if rule.MinMatches <= 1 {
+				for _, obfuscated := range obfuscatedStrings {
+					expression := bundle.Content[obfuscated.start:obfuscated.end]
+					for _, loc := range rule.Regex.FindAllStringIndex(obfuscated.value, -1) {
+						text := obfuscated.value[loc[0]:loc[1]]
+						if strings.Contains(expression, text) {
+							continue
+						}
+						start, end := lineBounds(bundle.Content, obfuscated.start, obfuscated.end)
+						repo.checkMatch(bundle, rule, contentMatch{
+							line:       bundle.Content[start:end],
+							offset:     obfuscated.start,
+							text:       text,
+							start:      obfuscated.start - start,
+							end:        obfuscated.end - start,
+							obfuscated: true,
+						})
 					}
+				}
+			}
+		}
 
-					for end < len(bundle.Content)-1 && bundle.Content[end] != '\n' {
-						end++
-					}
+		repo.Manager.RecordTime(manager.RegexTime{
+			Time:  howLong(start),
+			Regex: rule.Regex.String(),
+		})
+	}
+}
 
-					line := bundle.Content[start:end]
-					offender := bundle.Content[loc[0]:loc[1]]
-					groups := rule.Regex.FindStringSubmatch(offender)
+// ruleAllowLists are the allowlists matches of a rule are checked against, those of the rule and, unless the
+// rule ignores it, the global allowlist
+type ruleAllowLists struct {
+	regexes   []*regexp.Regexp
+	entropies []config.EntropyAllowance
+	fixtures  []config.AllowList
+}
 
-					if isAllowListed(line, append(rule.AllowList.Regexes, repo.config.Allowlist.Regexes...)) {
-						continue
-					}
+// contentMatch is a match of a rule in the content of a bundle
+type contentMatch struct {
+	// line is the line of the match and start and end the offsets of the match in it
+	line       string
+	start, end int
 
-					if len(rule.Entropies) != 0 && !trippedEntropy(groups, rule) {
-						continue
-					}
+	// offset is the offset of the match in the content and text the text the rule matched
+	offset int
+	text   string
 
-					// 0 is a match for the full regex pattern
-					if 0 < rule.ReportGroup && rule.ReportGroup < len(groups) {
-						offender = groups[rule.ReportGroup]
-					}
+	// obfuscated is set for matches in a string reassembled by deobfuscate, start and end are the offsets
+	// of the expression building the string then
+	obfuscated bool
+}
 
-					leak := manager.Leak{
-						LineNumber: defaultLineNumber,
-						Line:       line,
-						Offender:   offender,
-						Commit:     bundle.Commit.Hash.String(),
-						Repo:       repo.Name,
-						Message:    bundle.Commit.Message,
-						Rule:       rule.Description,
-						Author:     bundle.Commit.Author.Name,
-						Email:      bundle.Commit.Author.Email,
-						Date:       bundle.Commit.Author.When,
-						Tags:       strings.Join(rule.Tags, ", "),
-						File:       bundle.FilePath,
-						Operation:  diffOpToString(bundle.Operation),
-					}
+// skipsFile returns true if rule isn't checked against the file filename in path, because the allowlist of
+// the rule allowlists it or the file and path regexes of the rule don't match it
+func (rule matchRule) skipsFile(filename, path string) bool {
+	if isAllowListed(filename, rule.AllowList.Files) || isAllowListed(path, rule.AllowList.Paths) {
+		return true
+	}
+	if ruleContainFileRegex(rule.Rule) && !RegexMatched(filename, rule.File) {
+		return true
+	}
+	return ruleContainPathRegex(rule.Rule) && !RegexMatched(path, rule.Path)
+}
 
-					// only search for line numbers on non-deletions
-					if bundle.Operation != fdiff.Delete {
-						extractAndInjectLineNumber(&leak, bundle, repo)
-					}
+// matches returns the matches of the regex of rule in content, none if there are fewer than the min matches
+// of the rule
+func (rule matchRule) matches(content string) []contentMatch {
+	locs := rule.Regex.FindAllStringIndex(content, -1)
+	if len(locs) == 0 || len(locs) < rule.MinMatches {
+		return nil
+	}
+	matches := make([]contentMatch, 0, len(locs))
+	for _, loc := range locs {
+		start, end := lineBounds(content, loc[0], loc[1])
+		matches = append(matches, contentMatch{
+			line:   content[start:end],
+			offset: loc[0],
+			text:   content[loc[0]:loc[1]],
+			start:  loc[0] - start,
+			end:    loc[1] - start,
+		})
+	}
+	return matches
+}
 
-					repo.Manager.SendLeaks(leak)
-				}
-			}
+// matchLeak is what a match of a rule reports: the offender, its offsets in the line of the match, the groups
+// of the regex and the fields of the parser of the rule
+type matchLeak struct {
+	offender   string
+	start, end int
+	groups     []string
+	parsed     map[string]string
+}
+
+// leak returns what match reports unless the entropies, parser or validator of rule turn it down. Allowlists
+// aren't checked, see allowListed.
+func (rule matchRule) leak(match contentMatch) (matchLeak, bool) {
+	l := matchLeak{
+		offender: match.text,
+		start:    match.start,
+		end:      match.end,
+		groups:   rule.Regex.FindStringSubmatch(match.text),
+	}
+
+	if len(rule.Entropies) != 0 && !trippedEntropy(l.groups, rule.Rule) {
+		return l, false
+	}
+
+	// 0 is a match for the full regex pattern
+	if 0 < rule.ReportGroup && rule.ReportGroup < len(l.groups) {
+		l.offender = l.groups[rule.ReportGroup]
+		idx := rule.Regex.FindStringSubmatchIndex(match.text)
+		if idx[2*rule.ReportGroup] >= 0 && !match.obfuscated {
+			l.start += idx[2*rule.ReportGroup]
+			l.end = l.start + len(l.offender)
+		}
+	}
+	if rule.Parse != "" {
+		fields, secretStart, secretEnd, ok := config.Parsers[rule.Parse](l.offender)
+		if !ok {
+			return l, false
+		}
+		l.parsed, l.offender = fields, l.offender[secretStart:secretEnd]
+		if !match.obfuscated {
+			l.start, l.end = l.start+secretStart, l.start+secretEnd
 		}
+	}
+	if rule.Validate != "" && !config.Validators[rule.Validate](l.offender) {
+		return l, false
+	}
+	return l, true
+}
 
-		repo.Manager.RecordTime(manager.RegexTime{
-			Time:  howLong(start),
-			Regex: rule.Regex.String(),
+// allowListed returns true if the leak l of match in a file in path is allowlisted by the line regexes,
+// entropy allowances or fixtures of the allowlists of rule
+func (rule matchRule) allowListed(path string, match contentMatch, l matchLeak) bool {
+	if isAllowListed(match.line, rule.allowLists.regexes) {
+		return true
+	}
+	if len(rule.Entropies) != 0 && allowListedEntropy(l.groups, rule.Rule, path, rule.allowLists.entropies) != nil {
+		return true
+	}
+	_, ok := fixtureOf(l.offender, rule.allowLists.fixtures...)
+	return ok
+}
+
+// checkMatch reports the leak of a match of rule in the content of bundle unless it's allowlisted or the
+// entropies, parser or validator of rule turn it down
+func (repo *Repo) checkMatch(bundle *Bundle, rule matchRule, match contentMatch) {
+	path, _ := config.SplitPath(bundle.FilePath)
+	l, ok := rule.leak(match)
+	if !ok || rule.allowListed(path, match, l) {
+		return
+	}
+	offender, groups, parsed := l.offender, l.groups, l.parsed
+
+	tags := rule.Tags
+	if match.obfuscated {
+		tags = append(append([]string(nil), rule.Tags...), "obfuscated")
+	}
+	leak := manager.Leak{
+		LineNumber:  defaultLineNumber,
+		Line:        match.line,
+		Offender:    offender,
+		Entropy:     shannonEntropy(offender),
+		MatchStart:  l.start,
+		MatchEnd:    l.end,
+		Commit:      bundle.Commit.Hash.String(),
+		Repo:        repo.Name,
+		Message:     bundle.Commit.Message,
+		Rule:        rule.Description,
+		RuleID:      rule.ID,
+		RuleRegex:   rule.Regex.String(),
+		Groups:      namedGroups(rule.Regex, groups),
+		Author:      bundle.Commit.Author.Name,
+		Email:       bundle.Commit.Author.Email,
+		Date:        bundle.Commit.Author.When,
+		Tags:        strings.Join(tags, ", "),
+		File:        bundle.FilePath,
+		OldFile:     bundle.OldFilePath,
+		MergeParent: bundle.mergeParent,
+		Operation:   diffOpToString(bundle.Operation),
+		ReportOnly:  rule.ReportOnly,
+		Severity:    rule.Severity,
+	}
+
+	if parsed != nil {
+		leak.Groups = parsed
+	}
+
+	leak.LineNumber = bundle.lineNumber(match.offset)
+	if bundle.scanType == patchScan && bundle.Operation == fdiff.Delete {
+		repo.removedNotRotated(&leak, bundle, match.offset)
+	}
+	if repo.Manager.Opts.PatchContext && bundle.scanType == patchScan {
+		leak.DiffHeader, leak.HunkHeader, leak.Hunk = patchContext(bundle.Patch, bundle.Operation, &leak, func() []string {
+			return repo.fileLines(bundle)
 		})
 	}
+
+	// the leak links to the file it was found in, before it is blamed on an earlier commit
+	leak.URL = repo.permalink(leak, bundle)
+	repo.setOrigin(&leak)
+	commit := repo.blameLeak(&leak, bundle)
+	leak.Signature, leak.SigningKey = repo.commitSignature(commit)
+	leak.AtHead = repo.atHead(bundle.FilePath, leak.Offender, bundle)
+	repo.Manager.SendLeaks(leak)
+}
+
+// lineBounds returns the offsets of the start and end of the line of content the text from start to end is on
+func lineBounds(content string, start, end int) (int, int) {
+	for start != 0 && content[start] != '\n' {
+		start--
+	}
+
+	if content[start] == '\n' {
+		start++
+	}
+
+	for end < len(content)-1 && content[end] != '\n' {
+		end++
+	}
+	return start, end
 }
 
 // RegexMatched matched an interface to a regular expression. The interface f can
@@ -194,119 +352,6 @@ func diffOpToString(operation fdiff.Operation) string {
 	}
 }
 
-// extractAndInjectLine accepts a leak, bundle, and repo which it uses to do a reverse search in order to extract
-// the line number of a historic or present leak. The function is only called when the git operation is an addition
-// or none, it does not get called when the git operation is deletion.
-func extractAndInjectLineNumber(leak *manager.Leak, bundle *Bundle, repo *Repo) {
-	var err error
-
-	switch bundle.scanType {
-	case patchScan:
-		if bundle.Patch == "" {
-			return
-		}
-
-		// This is needed as some patches generate strings that are larger than
-		// scanners max size (MaxScanTokenSize = 64 * 1024)
-		// https://github.com/zricethezav/gitleaks/issues/413
-		buf := make([]byte, len(bundle.Patch))
-		scanner := bufio.NewScanner(strings.NewReader(bundle.Patch))
-		scanner.Buffer(buf, len(bundle.Patch))
-		scanner.Split(bufio.ScanLines)
-
-		currFile := ""
-		currLine := 0
-		currStartDiffLine := 0
-
-		for scanner.Scan() {
-			txt := scanner.Text()
-			if strings.HasPrefix(txt, diffAddFilePrefix) {
-				currStartDiffLine = 1
-				currLine = 0
-				currFile = strings.Split(txt, diffAddFilePrefixSlash)[1]
-
-				// next line contains diff line information so lets scan it here
-				scanner.Scan()
-
-				txt := scanner.Text()
-				i := strings.Index(txt, diffAddPrefix)
-				pairs := strings.Split(strings.Split(txt[i+1:], diffLineSignature)[0], ",")
-				currStartDiffLine, err = strconv.Atoi(pairs[0])
-				if err != nil {
-					log.Debug(err)
-					return
-				}
-				continue
-			} else if strings.HasPrefix(txt, diffAddPrefix) && strings.Contains(txt, leak.Line) && leak.File == currFile {
-				potentialLine := currLine + currStartDiffLine
-				if _, ok := bundle.lineLookup[fmt.Sprintf("%s%s%d%s", leak.Offender, leak.Line, potentialLine, currFile)]; !ok {
-					bundle.lineLookup[fmt.Sprintf("%s%s%d%s", leak.Offender, leak.Line, potentialLine, currFile)] = true
-					leak.LineNumber = potentialLine
-					return
-				}
-			} else if strings.HasPrefix(txt, diffLineSignaturePrefix) && currStartDiffLine != 0 {
-				// This logic is used for when there are multiple leaks of the same offender within the same patch
-				i := strings.Index(txt, diffAddPrefix)
-				pairs := strings.Split(strings.Split(txt[i+1:], diffLineSignature)[0], ",")
-				currStartDiffLine, err = strconv.Atoi(pairs[0])
-				if err != nil {
-					log.Debug(err)
-					return
-				}
-				currLine = 0
-				if !strings.HasSuffix(txt, diffLineSignature) {
-					currLine = -1
-				}
-			}
-			currLine++
-		}
-	case commitScan:
-		if bundle.Commit == nil {
-			return
-		}
-		f, err := bundle.Commit.File(bundle.FilePath)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		r, err := f.Reader()
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		leak.LineNumber = extractLineHelper(r, bundle, leak)
-	case uncommittedScan:
-		wt, err := repo.Worktree()
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		f, err := wt.Filesystem.Open(leak.File)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-		leak.LineNumber = extractLineHelper(f, bundle, leak)
-	}
-}
-
-// extractLineHelper consolidates code for checking the leak line against the contents of a reader to find the
-// line number of the leak.
-func extractLineHelper(r io.Reader, bundle *Bundle, leak *manager.Leak) int {
-	scanner := bufio.NewScanner(r)
-	lineNumber := 1
-	for scanner.Scan() {
-		if leak.Line == scanner.Text() {
-			if _, ok := bundle.lineLookup[fmt.Sprintf("%s%s%d%s", leak.Offender, leak.Line, lineNumber, bundle.FilePath)]; !ok {
-				bundle.lineLookup[fmt.Sprintf("%s%s%d%s", leak.Offender, leak.Line, lineNumber, bundle.FilePath)] = true
-				return lineNumber
-			}
-		}
-		lineNumber++
-	}
-	return -1
-}
-
 // trippedEntropy checks if a given capture group or offender falls in between entropy ranges
 // supplied by a custom gitleaks configuration. Gitleaks do not check entropy by default.
 func trippedEntropy(groups []string, rule config.Rule) bool {
@@ -321,6 +366,30 @@ func trippedEntropy(groups []string, rule config.Rule) bool {
 	return false
 }
 
+// allowListedEntropy returns the entropy allowance of allowances allowlisting the leak of rule in the files of
+// path, or nil if none does. The leak is allowlisted if the highest entropy tripping the ranges of rule is at
+// most the max of an allowance for path.
+func allowListedEntropy(groups []string, rule config.Rule, path string, allowances []config.EntropyAllowance) *config.EntropyAllowance {
+	if len(allowances) == 0 {
+		return nil
+	}
+	tripped := -1.0
+	for _, e := range rule.Entropies {
+		if len(groups) > e.Group {
+			entropy := shannonEntropy(groups[e.Group])
+			if entropy >= e.Min && entropy <= e.Max && entropy > tripped {
+				tripped = entropy
+			}
+		}
+	}
+	for i, allowance := range allowances {
+		if tripped <= allowance.Max && (len(allowance.Paths) == 0 || isAllowListed(path, allowance.Paths)) {
+			return &allowances[i]
+		}
+	}
+	return nil
+}
+
 // shannonEntropy calculates the entropy of data using the formula defined here:
 // https://en.wiktionary.org/wiki/Shannon_entropy
 // Another way to think about what this is doing is calculating the number of bits
@@ -331,20 +400,54 @@ func shannonEntropy(data string) (entropy float64) {
 		return 0
 	}
 
+	// the characters are summed in the order they first appear in, not in map order, so the entropy
+	// reported with a leak is the same for every scan down to the last bit
+	var chars []rune
 	charCounts := make(map[rune]int)
 	for _, char := range data {
+		if charCounts[char] == 0 {
+			chars = append(chars, char)
+		}
 		charCounts[char]++
 	}
 
 	invLength := 1.0 / float64(len(data))
-	for _, count := range charCounts {
-		freq := float64(count) * invLength
+	for _, char := range chars {
+		freq := float64(charCounts[char]) * invLength
 		entropy -= freq * math.Log2(freq)
 	}
 
 	return entropy
 }
 
+// namedGroups returns the values of the named groups of re matched in groups, or nil if re has no named
+// groups. Groups that didn't take part in the match are left out.
+func namedGroups(re *regexp.Regexp, groups []string) map[string]string {
+	var named map[string]string
+	for i, name := range re.SubexpNames() {
+		if name == "" || i >= len(groups) || groups[i] == "" {
+			continue
+		}
+		if named == nil {
+			named = make(map[string]string)
+		}
+		named[name] = groups[i]
+	}
+	return named
+}
+
+// fileRuleRegex returns the file and path regexes of a rule matching file names or paths only
+func fileRuleRegex(rule config.Rule) string {
+	var regexes []string
+	if ruleContainFileRegex(rule) {
+		regexes = append(regexes, rule.File.String())
+	}
+	if ruleContainPathRegex(rule) {
+		regexes = append(regexes, rule.Path.String())
+	}
+	return strings.Join(regexes, ", ")
+}
+
 // Checks if the given rule has a regex
 func ruleContainRegex(rule config.Rule) bool {
 	if rule.Regex == nil {
@@ -378,23 +481,26 @@ func ruleContainPathRegex(rule config.Rule) bool {
 	return true
 }
 
-func isCommitAllowListed(commitHash string, allowlistedCommits []string) bool {
-	for _, hash := range allowlistedCommits {
-		if commitHash == hash {
+// isCommitAllowListed returns true if the hash or the message of c is allowlisted by allowList
+func isCommitAllowListed(c *object.Commit, allowList config.AllowList) bool {
+	for _, hash := range allowList.Commits {
+		if c.Hash.String() == hash {
 			return true
 		}
 	}
-	return false
+	return isAllowListed(c.Message, allowList.CommitMessages)
 }
 
 func isAllowListed(target string, allowList []*regexp.Regexp) bool {
-	if len(allowList) != 0 {
-		for _, re := range allowList {
-			if re.FindString(target) != "" {
-				return true
-			}
+	return allowListedBy(target, allowList) != nil
+}
+
+// allowListedBy returns the first regex of allowList matching target, or nil if none does
+func allowListedBy(target string, allowList []*regexp.Regexp) *regexp.Regexp {
+	for _, re := range allowList {
+		if re.FindString(target) != "" {
+			return re
 		}
 	}
-	return false
-
+	return nil
 }
@@ -0,0 +1,51 @@
+package scan
+
+import (
+	"regexp"
+
+	"github.com/zricethezav/gitleaks/v6/config"
+)
+
+// ruleSet holds the rules of a config ready to be checked against bundles. It's built once per config, before
+// the scan starts, and only read after that so the workers of a scan share it without locking.
+type ruleSet struct {
+	rules []matchRule
+
+	// ignoresGlobalAllowlist is set if any rule is checked in files of the global allowlist
+	ignoresGlobalAllowlist bool
+}
+
+// matchRule is a rule with the allowlists its matches are checked against merged with the global allowlist
+type matchRule struct {
+	config.Rule
+	allowLists ruleAllowLists
+}
+
+// newRuleSet returns the rule set of cfg. The merged allowlists are copies, the slices of cfg are never
+// appended to by the scan.
+func newRuleSet(cfg config.Config) *ruleSet {
+	set := &ruleSet{
+		rules:                  make([]matchRule, 0, len(cfg.Rules)),
+		ignoresGlobalAllowlist: cfg.IgnoresGlobalAllowlist(),
+	}
+	for _, rule := range cfg.Rules {
+		allowLists := ruleAllowLists{
+			regexes:   append([]*regexp.Regexp(nil), rule.AllowList.Regexes...),
+			entropies: append([]config.EntropyAllowance(nil), rule.AllowList.Entropies...),
+			fixtures:  []config.AllowList{rule.AllowList},
+		}
+		if !rule.IgnoreGlobalAllowlist {
+			allowLists.regexes = append(allowLists.regexes, cfg.Allowlist.Regexes...)
+			allowLists.entropies = append(allowLists.entropies, cfg.Allowlist.Entropies...)
+			allowLists.fixtures = append(allowLists.fixtures, cfg.Allowlist)
+		}
+		set.rules = append(set.rules, matchRule{Rule: rule, allowLists: allowLists})
+	}
+	return set
+}
+
+// setConfig sets the config of the scan of repo and builds its rule set
+func (repo *Repo) setConfig(cfg config.Config) {
+	repo.config = cfg
+	repo.rules = newRuleSet(cfg)
+}
@@ -0,0 +1,22 @@
+package scan
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// sampled returns true if the commit with hash h is part of the sample of commits scanned with --sample. A
+// commit is sampled if the hash of the seed and the commit, taken as a fraction of the largest hash, is
+// within the sample rate. This picks the same commits for the same seed on every scan and spreads the
+// sample evenly over the history.
+func (repo *Repo) sampled(h plumbing.Hash) bool {
+	rate, err := repo.Manager.Opts.SampleRate()
+	if err != nil || rate >= 1 {
+		return true
+	}
+	sum := sha256.Sum256(append([]byte(repo.Manager.Opts.SampleSeed+"\x00"), h[:]...))
+	return float64(binary.BigEndian.Uint64(sum[:8])) < rate*math.MaxUint64
+}
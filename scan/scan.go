@@ -2,13 +2,13 @@ package scan
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/zricethezav/gitleaks/v6/manager"
@@ -20,6 +20,8 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/sergi/go-diff/diffmatchpatch"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Bundle contains various git information for scans.
@@ -30,9 +32,40 @@ type Bundle struct {
 	FilePath  string
 	Operation fdiff.Operation
 
-	reader     io.Reader
-	lineLookup map[string]bool
-	scanType   int
+	// OldFilePath is the path of the file before it was renamed or copied to FilePath.
+	// It is empty if the path did not change.
+	OldFilePath string
+
+	reader   io.Reader
+	scanType int
+
+	// mergeParent is the parent a merge commit was diffed against
+	mergeParent string
+
+	// startLine is the line number of the first line of Content, for content of consecutive lines like
+	// files and the added chunks of patches. lineNumbers holds the line number of each line of Content
+	// instead when its lines aren't consecutive, like the insertions of uncommitted changes. Leaks in
+	// content of neither, like deleted chunks, have no line number.
+	startLine   int
+	lineNumbers []int
+
+	// oldStartLine is the line number of the first line of Content in the parent the patch was diffed
+	// against, for deleted chunks. Removed secrets are blamed there to find the commit that added them.
+	oldStartLine int
+}
+
+// lineNumber returns the line number of the line at offset of the content of the bundle, or
+// defaultLineNumber if it isn't known. Line numbers come from the position of the content in its file, so
+// identical lines each get their own.
+func (bundle *Bundle) lineNumber(offset int) int {
+	line := strings.Count(bundle.Content[:offset], "\n")
+	switch {
+	case line < len(bundle.lineNumbers):
+		return bundle.lineNumbers[line]
+	case bundle.lineNumbers == nil && bundle.startLine > 0:
+		return bundle.startLine + line
+	}
+	return defaultLineNumber
 }
 
 // commitScanner is a function signature for scanning commits. There is some
@@ -42,8 +75,8 @@ type Bundle struct {
 type commitScanner func(c *object.Commit, repo *Repo) error
 
 const (
-	// We need to differentiate between scans as the logic for line searching is different between
-	// scanning patches, commits, and uncommitted files.
+	// We need to differentiate between scans as patches, commits, and uncommitted files are blamed and
+	// given context differently.
 	patchScan int = iota + 1
 	uncommittedScan
 	commitScan
@@ -52,7 +85,7 @@ const (
 // Scan is responsible for scanning the entire history (default behavior) of a
 // git repo. Options that can change the behavior of this function include: --Commit, --depth, --branch.
 // See options/options.go for an explanation on these options.
-func (repo *Repo) Scan() error {
+func (repo *Repo) Scan() (err error) {
 	if err := repo.setupTimeout(); err != nil {
 		return err
 	}
@@ -60,9 +93,14 @@ func (repo *Repo) Scan() error {
 		defer repo.cancel()
 	}
 
+	var span trace.Span
+	repo.ctx, span = repo.startSpan("scan", attribute.String("gitleaks.repo", repo.Name))
+	defer func() { endSpan(span, err) }()
+
 	if repo.Repository == nil {
 		return fmt.Errorf("%s repo is empty", repo.Name)
 	}
+	repo.resolveOrigin()
 
 	// load up alternative config if possible, if not use manager's config
 	if repo.Manager.Opts.RepoConfig {
@@ -70,7 +108,7 @@ func (repo *Repo) Scan() error {
 		if err != nil {
 			return err
 		}
-		repo.config = cfg
+		repo.setConfig(cfg)
 	}
 
 	scanTimeStart := time.Now()
@@ -81,6 +119,8 @@ func (repo *Repo) Scan() error {
 		return scanCommit(repo.Manager.Opts.Commit, repo, scanCommitPatches)
 	} else if repo.Manager.Opts.FilesAtCommit != "" {
 		return scanCommit(repo.Manager.Opts.FilesAtCommit, repo, scanFilesAtCommit)
+	} else if repo.Manager.Opts.FilesAtHead {
+		return repo.scanFilesAtHead()
 	} else if repo.Manager.Opts.Commits != "" {
 		commits := strings.Split(repo.Manager.Opts.Commits, ",")
 		for _, c := range commits {
@@ -111,27 +151,65 @@ func (repo *Repo) Scan() error {
 	if err != nil {
 		return err
 	}
-	cIter, err := repo.Log(logOpts)
+	if !logOpts.From.IsZero() {
+		repo.Manager.RecordHead(repo.Name, logOpts.From.String())
+	} else if head, err := repo.Head(); err == nil {
+		repo.Manager.RecordHead(repo.Name, head.Hash().String())
+	}
+	if repo.Manager.Opts.FileHistory != "" {
+		err = repo.scanFileHistory(logOpts)
+		repo.Manager.RecordTime(manager.ScanTime(howLong(scanTimeStart)))
+		return err
+	}
+	if repo.cachePath != "" && repo.scansWholeHistory(logOpts) {
+		heads, headsErr := repo.skipCachedHeads()
+		if headsErr != nil {
+			return headsErr
+		}
+		defer func() { repo.saveCachedHeads(heads, err) }()
+	}
+	if repo.Manager.Opts.GitBackend == "cli" {
+		err = repo.scanGitLog(logOpts)
+		repo.Manager.RecordTime(manager.ScanTime(howLong(scanTimeStart)))
+		return err
+	}
+	if repo.partialPath != "" {
+		if err := repo.prefetchHistory(logOpts); err != nil {
+			return err
+		}
+	}
+	cIter, err := repo.commitLog(logOpts)
 	if err != nil {
 		return err
 	}
 
 	cc := 0
-	semaphore := make(chan bool, howManyThreads(repo.Manager.Opts.Threads))
-	wg := sync.WaitGroup{}
+	pipe := newPipeline(repo)
+	_, walkSpan := repo.startSpan("walk commits")
 	err = cIter.ForEach(func(c *object.Commit) error {
 		if c == nil || repo.timeoutReached() || repo.depthReached(cc) {
 			return storer.ErrStop
 		}
 
 		// Check if Commit is allowlisted
-		if isCommitAllowListed(c.Hash.String(), repo.config.Allowlist.Commits) {
+		if isCommitAllowListed(c, repo.config.Allowlist) {
+			return nil
+		}
+
+		if !repo.sampled(c.Hash) {
+			repo.Manager.IncrementSampledOut(1)
+			if c.Hash.String() == repo.Manager.Opts.CommitTo {
+				return storer.ErrStop
+			}
 			return nil
 		}
 
 		// Check if at root
 		if len(c.ParentHashes) == 0 {
 			cc++
+			if !repo.scanChunk(fdiff.Add, true) {
+				return nil
+			}
 			err = scanFilesAtCommit(c, repo)
 			if err != nil {
 				return err
@@ -139,59 +217,38 @@ func (repo *Repo) Scan() error {
 			return nil
 		}
 
+		if len(c.ParentHashes) > 1 && repo.Manager.Opts.Merges == "skip" {
+			return nil
+		}
+
 		// increase Commit counter
 		cc++
 
 		// inspect first parent only as all other parents will be eventually reached
 		// (they exist as the tip of other branches, etc)
 		// See https://github.com/zricethezav/gitleaks/issues/413 for details
-		parent, err := c.Parent(0)
+		// Changes only made in a merge commit (evil merges) are missed this way, so --merges=all-parents
+		// diffs merges against each parent.
+		parents, err := repo.diffParents(c)
 		if err != nil {
 			return err
 		}
-
-		defer func() {
-			if err := recover(); err != nil {
-				// sometimes the Patch generation will fail due to a known bug in
-				// sergi's go-diff: https://github.com/sergi/go-diff/issues/89.
-				// Once a fix has been merged I will remove this recover.
-				return
-			}
-		}()
-		if repo.timeoutReached() {
-			return nil
-		}
-		if parent == nil {
-			// shouldn't reach this point but just in case
-			return nil
+		for _, parent := range parents {
+			pipe.add(c, parent)
 		}
 
-		start := time.Now()
-		patch, err := parent.Patch(c)
-		if err != nil {
-			log.Errorf("could not generate Patch")
-		}
-		repo.Manager.RecordTime(manager.PatchTime(howLong(start)))
-
-		wg.Add(1)
-		semaphore <- true
-		go func(c *object.Commit, patch *object.Patch) {
-			defer func() {
-				<-semaphore
-				wg.Done()
-			}()
-			scanPatch(patch, c, repo)
-		}(c, patch)
-
 		if c.Hash.String() == repo.Manager.Opts.CommitTo {
 			return storer.ErrStop
 		}
 		return nil
 	})
 
-	wg.Wait()
+	walkSpan.SetAttributes(attribute.Int("gitleaks.commits", cc))
+	walkSpan.End()
+
+	pipe.wait()
 	repo.Manager.RecordTime(manager.ScanTime(howLong(scanTimeStart)))
-	repo.Manager.IncrementCommits(cc)
+	repo.Manager.IncrementRepoCommits(repo.Name, cc)
 	return nil
 }
 
@@ -207,21 +264,47 @@ func (repo *Repo) scanEmpty() error {
 	if err != nil {
 		return err
 	}
+	if !repo.scanChunk(fdiff.Add, true) {
+		return nil
+	}
+	walker := newDirWalker(repo)
+	defer walker.wg.Wait()
 	for fn := range status {
-		workTreeBuf := bytes.NewBuffer(nil)
+		if path := filepath.Join(wt.Filesystem.Root(), fn); isSymlink(path) {
+			if repo.Manager.Opts.FollowSymlinks {
+				walker.scanSymlink(path, fn)
+			} else {
+				log.Debugf("skipping symlink %s, use --follow-symlinks to scan its target", fn)
+			}
+			continue
+		}
+		if repo.skipPath(fn) {
+			continue
+		}
 		workTreeFile, err := wt.Filesystem.Open(fn)
 		if err != nil {
 			continue
 		}
-		if _, err := io.Copy(workTreeBuf, workTreeFile); err != nil {
+		workTreeBuf := getBuffer()
+		_, err = io.Copy(workTreeBuf, workTreeFile)
+		workTreeFile.Close()
+		if err != nil {
+			putBuffer(workTreeBuf)
 			return err
 		}
+		if repo.skipContent(fn, sniffHead(workTreeBuf.Bytes()), false) {
+			putBuffer(workTreeBuf)
+			continue
+		}
 		repo.CheckRules(&Bundle{
-			Content:  workTreeBuf.String(),
-			FilePath: workTreeFile.Name(),
-			Commit:   emptyCommit(),
-			scanType: uncommittedScan,
+			Content:   workTreeBuf.String(),
+			FilePath:  workTreeFile.Name(),
+			Commit:    emptyCommit(),
+			Operation: fdiff.Add,
+			scanType:  uncommittedScan,
+			startLine: 1,
 		})
+		putBuffer(workTreeBuf)
 	}
 	repo.Manager.RecordTime(manager.ScanTime(howLong(scanTimeStart)))
 	return nil
@@ -236,7 +319,7 @@ func (repo *Repo) scanUncommitted() error {
 		if err != nil {
 			return err
 		}
-		repo.config = cfg
+		repo.setConfig(cfg)
 	}
 
 	if err := repo.setupTimeout(); err != nil {
@@ -273,60 +356,253 @@ func (repo *Repo) scanUncommitted() error {
 		return err
 	}
 
-	status, err := getStagedChanges(wt)
-	for _,fn := range status {
-		var (
-			prevFileContents string
-			currFileContents string
-			filename         string
-		)
+	walker := newDirWalker(repo)
+	defer walker.wg.Wait()
 
-		workTreeFile, err := wt.Filesystem.Open(fn)
-		if err != nil {
+	changes, err := getStagedChanges(wt)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		fn := change.path
+
+		// staged symlinks only contain the path of their target
+		if path := filepath.Join(wt.Filesystem.Root(), fn); repo.Manager.Opts.FollowSymlinks && isSymlink(path) {
+			walker.scanSymlink(path, fn)
 			continue
 		}
 
-		currFileContents, _ = getStagedFileContent(wt, fn)
-		filename = workTreeFile.Name()
-
-		// get files at HEAD state
-		prevFile, err := prevTree.File(fn)
+		if repo.skipPath(fn) {
+			continue
+		}
+		currFileContents, err := getStagedFileContent(repo.Repository, wt, fn)
 		if err != nil {
-			prevFileContents = ""
+			log.Debugf("unable to read staged file %s: %v", fn, err)
+			continue
+		}
+		if repo.skipContent(fn, currFileContents, false) {
+			continue
+		}
 
+		// renamed files are diffed against their content at HEAD under the old path
+		prevPath := fn
+		if change.status == 'R' {
+			prevPath = change.oldPath
+		}
+		var prevFileContents string
+		prevFile, err := prevTree.File(prevPath)
+		if err != nil {
+			if !repo.scanChunk(fdiff.Add, true) {
+				continue
+			}
 		} else {
+			if !repo.scanChunk(fdiff.Add, false) {
+				continue
+			}
 			prevFileContents, err = prevFile.Contents()
 			if err != nil {
 				return err
 			}
-			if filename == "" {
-				filename = prevFile.Name
-			}
 		}
 
-		dmp := diffmatchpatch.New()
-		diffs := dmp.DiffCleanupSemantic(dmp.DiffMain(prevFileContents, currFileContents, false))
-		var diffContents string
-		for _, d := range diffs {
-			if d.Type == diffmatchpatch.DiffInsert {
-				diffContents += fmt.Sprintf("%s\n", d.Text)
+		insertions, lineNumbers := diffInsertions(prevFileContents, currFileContents)
+		repo.CheckRules(&Bundle{
+			Content:     insertions,
+			FilePath:    fn,
+			OldFilePath: change.oldPath,
+			Commit:      c,
+			Operation:   fdiff.Add,
+			scanType:    uncommittedScan,
+			lineNumbers: lineNumbers,
+		})
+	}
+
+	if repo.Manager.Opts.Unstaged {
+		if err := repo.scanUnstaged(wt, walker); err != nil {
+			return err
+		}
+	}
+	if repo.Manager.Opts.Untracked {
+		if err := repo.scanUntracked(wt, walker); err != nil {
+			return err
+		}
+	}
+	repo.Manager.RecordTime(manager.ScanTime(howLong(scanTimeStart)))
+	return nil
+}
+
+// scanUnstaged scans the changes of the worktree that aren't staged yet, diffing the files of the worktree
+// against their staged version
+func (repo *Repo) scanUnstaged(wt *git.Worktree, walker *dirWalker) error {
+	if !repo.scanChunk(fdiff.Add, false) {
+		return nil
+	}
+	files, err := getUnstagedChanges(wt)
+	if err != nil {
+		return err
+	}
+	for _, fn := range files {
+		if repo.timeoutReached() {
+			return nil
+		}
+		if path := filepath.Join(wt.Filesystem.Root(), fn); isSymlink(path) {
+			if repo.Manager.Opts.FollowSymlinks {
+				walker.scanSymlink(path, fn)
 			}
+			continue
 		}
+		if repo.skipPath(fn) {
+			continue
+		}
+		workTreeFile, err := wt.Filesystem.Open(fn)
+		if err != nil {
+			continue
+		}
+		workTreeBuf := getBuffer()
+		_, err = io.Copy(workTreeBuf, workTreeFile)
+		workTreeFile.Close()
+		if err != nil {
+			putBuffer(workTreeBuf)
+			return err
+		}
+		if repo.skipContent(fn, sniffHead(workTreeBuf.Bytes()), false) {
+			putBuffer(workTreeBuf)
+			continue
+		}
+		// files added with --intent-to-add have no staged content yet
+		stagedContents, _ := getStagedFileContent(repo.Repository, wt, fn)
+
+		c := emptyCommit()
+		c.Message = "***UNSTAGED CHANGES***"
+		insertions, lineNumbers := diffInsertions(stagedContents, workTreeBuf.String())
 		repo.CheckRules(&Bundle{
-			Content:  diffContents,
-			FilePath: filename,
-			Commit:   c,
-			scanType: uncommittedScan,
+			Content:     insertions,
+			FilePath:    fn,
+			Commit:      c,
+			Operation:   fdiff.Add,
+			scanType:    uncommittedScan,
+			lineNumbers: lineNumbers,
 		})
+		putBuffer(workTreeBuf)
+	}
+	return nil
+}
+
+// diffInsertions returns the text inserted in curr, compared to prev, one insertion per line, and the line
+// number in curr of each line of the text
+func diffInsertions(prev, curr string) (string, []int) {
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffCleanupSemantic(dmp.DiffMain(prev, curr, false))
+	var insertions strings.Builder
+	var lineNumbers []int
+	currLine := 1
+	for _, d := range diffs {
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			insertions.WriteString(d.Text + "\n")
+			lines := strings.Count(d.Text, "\n")
+			for i := 0; i <= lines; i++ {
+				lineNumbers = append(lineNumbers, currLine+i)
+			}
+			currLine += lines
+		case diffmatchpatch.DiffEqual:
+			currLine += strings.Count(d.Text, "\n")
+		}
 	}
+	return insertions.String(), lineNumbers
+}
 
+// scanUntracked scans the files of the worktree that aren't tracked or ignored, like a new file that isn't
+// staged yet. The whole file is scanned as it has no previous version.
+func (repo *Repo) scanUntracked(wt *git.Worktree, walker *dirWalker) error {
+	if !repo.scanChunk(fdiff.Add, true) {
+		return nil
+	}
+	files, err := getUntrackedFiles(wt)
 	if err != nil {
 		return err
 	}
-	repo.Manager.RecordTime(manager.ScanTime(howLong(scanTimeStart)))
+	for _, fn := range files {
+		if repo.timeoutReached() {
+			return nil
+		}
+		path := filepath.Join(wt.Filesystem.Root(), fn)
+		if isSymlink(path) {
+			if repo.Manager.Opts.FollowSymlinks {
+				walker.scanSymlink(path, fn)
+			} else {
+				log.Debugf("skipping symlink %s, use --follow-symlinks to scan its target", fn)
+			}
+			continue
+		}
+		if repo.skipPath(fn) {
+			continue
+		}
+		workTreeFile, err := wt.Filesystem.Open(fn)
+		if err != nil {
+			continue
+		}
+		workTreeBuf := getBuffer()
+		_, err = io.Copy(workTreeBuf, workTreeFile)
+		workTreeFile.Close()
+		if err != nil {
+			putBuffer(workTreeBuf)
+			return err
+		}
+		if repo.skipContent(fn, sniffHead(workTreeBuf.Bytes()), false) {
+			putBuffer(workTreeBuf)
+			continue
+		}
+		c := emptyCommit()
+		c.Message = "***UNTRACKED FILES***"
+		repo.CheckRules(&Bundle{
+			Content:   workTreeBuf.String(),
+			FilePath:  fn,
+			Commit:    c,
+			Operation: fdiff.Add,
+			scanType:  uncommittedScan,
+			startLine: 1,
+		})
+		putBuffer(workTreeBuf)
+	}
 	return nil
 }
 
+// getUnstagedChanges lists the files of the worktree that were added, copied or modified since they were staged
+func getUnstagedChanges(wt *git.Worktree) ([]string, error) {
+	c := exec.Command("git", "diff", "--name-only", "--diff-filter=ACM", "-z")
+	c.Dir = wt.Filesystem.Root()
+	output, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list unstaged changes: %v", err)
+	}
+	var files []string
+	for _, file := range strings.Split(string(output), "\000") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// getUntrackedFiles lists the untracked files of the worktree with `git ls-files`, leaving out the files
+// ignored by .gitignore, .git/info/exclude and the global excludes file
+func getUntrackedFiles(wt *git.Worktree) ([]string, error) {
+	c := exec.Command("git", "ls-files", "--others", "--exclude-standard", "-z")
+	c.Dir = wt.Filesystem.Root()
+	output, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list untracked files: %v", err)
+	}
+	var files []string
+	for _, file := range strings.Split(string(output), "\000") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
 // gitStatus returns the status of modified files in the worktree. It will attempt to execute 'git status'
 // and will fall back to git.Worktree.Status() if that fails.
 func gitStatus(wt *git.Worktree) (git.Status, error) {
@@ -358,44 +634,120 @@ func gitStatus(wt *git.Worktree) (git.Status, error) {
 	return stat, err
 }
 
-//run the command "git diff --cached --name-status --diff-filter=ACM" to get all the staged files that have
-//been modified, added or copied.
-func getStagedChanges(wt *git.Worktree) ([]string, error){
-	var stagedFiles []string
+// stagedChange is a file staged for the next commit. oldPath is the path a renamed or copied file was
+// renamed or copied from.
+type stagedChange struct {
+	status  byte
+	path    string
+	oldPath string
+}
 
-	c := exec.Command("git", "diff", "--cached", "--name-status", "--diff-filter=ACM")
+// getStagedChanges lists the files that were added, copied, modified or renamed in the index, compared to HEAD.
+// The changes are read from the index with go-git if the git binary isn't available.
+func getStagedChanges(wt *git.Worktree) ([]stagedChange, error) {
+	if !gitAvailable() {
+		return stagedChangesFromIndex(wt)
+	}
+	c := exec.Command("git", "diff", "--cached", "--name-status", "--diff-filter=ACMR", "-z")
 	c.Dir = wt.Filesystem.Root()
-	output, err := c.CombinedOutput()
-
+	output, err := c.Output()
 	if err != nil {
-		log.Fatal("Execution of git command failed\n")
+		return nil, fmt.Errorf("unable to list staged changes: %v", err)
 	}
+	return parseNameStatus(string(output))
+}
 
-	//list staged files in format "Status \t Filename" e.g "A	new-file"
-	stagedFilesAndStatus := strings.Split(string(output), "\n")
+// stagedChangesFromIndex lists the staged changes from the go-git status of the worktree. go-git doesn't
+// detect renames, renamed files are listed as added under their new path.
+func stagedChangesFromIndex(wt *git.Worktree) ([]stagedChange, error) {
+	status, err := wt.Status()
+	if err != nil {
+		return nil, err
+	}
+	var changes []stagedChange
+	for path, fileStatus := range status {
+		switch fileStatus.Staging {
+		case git.Added, git.Copied, git.Modified:
+			changes = append(changes, stagedChange{status: byte(fileStatus.Staging), path: path})
+		case git.Renamed:
+			changes = append(changes, stagedChange{status: byte(fileStatus.Staging), path: path, oldPath: fileStatus.Extra})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].path < changes[j].path
+	})
+	return changes, nil
+}
 
-	for _, fileString := range stagedFilesAndStatus {
-		if len(fileString) != 0 {
+// gitAvailable returns true if the git binary is on the PATH
+func gitAvailable() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
 
-			//extract file name only and add to array
-			fileStatusAndName := strings.Split(fileString, "\t")
-			if len(fileStatusAndName) > 0 {
-				file := fileStatusAndName[1]
-				stagedFiles = append(stagedFiles, file)
+// parseNameStatus parses the output of `git diff --name-status -z`. Each status is followed by the path of
+// the file, renames and copies by the path they were renamed or copied from and then the new path. Paths
+// are NUL terminated and not quoted, so they may contain tabs, spaces and non-ASCII characters.
+func parseNameStatus(output string) ([]stagedChange, error) {
+	fields := strings.Split(strings.TrimSuffix(output, "\000"), "\000")
+	var changes []stagedChange
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" {
+			continue
+		}
+		switch status[0] {
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("unable to parse staged changes: %s is missing a path", status)
+			}
+			changes = append(changes, stagedChange{status: status[0], oldPath: fields[i+1], path: fields[i+2]})
+			i += 2
+		default:
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("unable to parse staged changes: %s is missing a path", status)
 			}
+			changes = append(changes, stagedChange{status: status[0], path: fields[i+1]})
+			i++
 		}
 	}
-	return stagedFiles, err
+	return changes, nil
 }
 
-//Get the contents of the staged version of the file, incase file has been further modified
-func getStagedFileContent(wt *git.Worktree, file string)(string, error){
-
-	c := exec.Command("git", "show", ":0:" + file)
+// getStagedFileContent returns the staged content of file, which may differ from the worktree if the file was
+// modified after it was staged. The content is read from the index with go-git if the git binary isn't available.
+func getStagedFileContent(r *git.Repository, wt *git.Worktree, file string) (string, error) {
+	if !gitAvailable() {
+		return stagedContentFromIndex(r, file)
+	}
+	c := exec.Command("git", "show", ":0:"+file)
 	c.Dir = wt.Filesystem.Root()
-	output, err := c.CombinedOutput()
+	output, err := c.Output()
+	return string(output), err
+}
 
-	return string(output) , err
+// stagedContentFromIndex reads the staged content of file from the blob its index entry points at
+func stagedContentFromIndex(r *git.Repository, file string) (string, error) {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return "", err
+	}
+	entry, err := idx.Entry(file)
+	if err != nil {
+		return "", err
+	}
+	blob, err := r.BlobObject(entry.Hash)
+	if err != nil {
+		return "", err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	var content strings.Builder
+	_, err = io.Copy(&content, reader)
+	return content.String(), err
 }
 
 // scan accepts a Patch, Commit, and repo. If the patches contains files that are
@@ -403,39 +755,101 @@ func getStagedFileContent(wt *git.Worktree, file string)(string, error){
 // allowlisted files set in the configuration. If a global rule for files is defined and a filename
 // matches said global rule, then a leak is sent to the manager.
 // After that, file chunks are created which are then inspected by InspectString()
-func scanPatch(patch *object.Patch, c *object.Commit, repo *Repo) {
+// The chunks of the patch are scanned as go-git diffed them, the line numbers of changed chunks are known from
+// the chunks before them. The patch is only encoded for --patch-context, without context lines like the patches
+// of the git cli backend.
+func scanPatch(patch *object.Patch, c *object.Commit, repo *Repo, mergeParent string) {
 	bundle := Bundle{
-		Commit:   c,
-		Patch:    patch.String(),
-		scanType: patchScan,
+		Commit:      c,
+		scanType:    patchScan,
+		mergeParent: mergeParent,
+	}
+	if repo.Manager.Opts.PatchContext {
+		buf := getBuffer()
+		defer putBuffer(buf)
+		if err := encodePatch(buf, patch); err != nil {
+			log.Errorf("could not encode patch of %s: %v", c.Hash, err)
+		}
+		bundle.Patch = buf.String()
 	}
 	for _, f := range patch.FilePatches() {
 		if repo.timeoutReached() {
 			return
 		}
-		if f.IsBinary() {
+		// go-git detects renames when generating patches. The path a file was renamed to is used
+		// so allowlists and line lookups apply to where the content lives after the commit.
+		from, to := f.Files()
+		bundle.OldFilePath = ""
+		if to != nil {
+			bundle.FilePath = to.Path()
+			if from != nil && from.Path() != to.Path() {
+				bundle.OldFilePath = from.Path()
+			}
+		} else if from != nil {
+			bundle.FilePath = from.Path()
+		} else {
+			bundle.FilePath = "???"
+		}
+
+		chunks := f.Chunks()
+		if repo.skipPath(bundle.FilePath) || repo.skipContent(bundle.FilePath, patchHead(repo, f, chunks), f.IsBinary()) {
 			continue
 		}
-		for _, chunk := range f.Chunks() {
-			if chunk.Type() == fdiff.Add || (repo.Manager.Opts.Deletion && chunk.Type() == fdiff.Delete) {
+		oldLine, newLine := 1, 1
+		for _, chunk := range chunks {
+			bundle.startLine, bundle.oldStartLine = 0, 0
+			switch chunk.Type() {
+			case fdiff.Add:
+				bundle.startLine = newLine
+			case fdiff.Delete:
+				bundle.oldStartLine = oldLine
+			}
+			if chunk.Type() != fdiff.Delete {
+				newLine += chunkLines(chunk.Content())
+			}
+			if chunk.Type() != fdiff.Add {
+				oldLine += chunkLines(chunk.Content())
+			}
+			if repo.scanChunk(chunk.Type(), from == nil) {
 				bundle.Content = chunk.Content()
 				bundle.Operation = chunk.Type()
-
-				// get filepath
-				from, to := f.Files()
-				if from != nil {
-					bundle.FilePath = from.Path()
-				} else if to != nil {
-					bundle.FilePath = to.Path()
-				} else {
-					bundle.FilePath = "???"
-				}
 				repo.CheckRules(&bundle)
+				if chunk.Type() == fdiff.Add {
+					repo.scanLFS(c, bundle.FilePath, bundle.Content)
+				}
 			}
 		}
 	}
 }
 
+// chunkLines returns the number of lines of the content of a chunk, the last of which may not end in a newline
+func chunkLines(content string) int {
+	lines := strings.Count(content, "\n")
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		lines++
+	}
+	return lines
+}
+
+// patchHead returns the start of the content of the file of a file patch to sniff its mime type from, the
+// first changed chunk or the blob of the file for binary patches, which have no chunks
+func patchHead(repo *Repo, f fdiff.FilePatch, chunks []fdiff.Chunk) string {
+	if f.IsBinary() {
+		if from, to := f.Files(); to != nil {
+			return repo.blobHead(to.Hash())
+		} else if from != nil {
+			return repo.blobHead(from.Hash())
+		}
+		return ""
+	}
+	for _, chunk := range chunks {
+		if chunk.Type() != fdiff.Equal {
+			return chunk.Content()
+		}
+	}
+	return ""
+}
+
 // scanCommit accepts a Commit hash, repo, and commit scanning function. A new Commit
 // object will be created from the hash which will be passed into either scanCommitPatches
 // or scanFilesAtCommit depending on the options set.
@@ -447,7 +861,7 @@ func scanCommit(commit string, repo *Repo, f commitScanner) error {
 		}
 		commit = ref.Hash().String()
 	}
-	repo.Manager.IncrementCommits(1)
+	repo.Manager.IncrementRepoCommits(repo.Name, 1)
 	h := plumbing.NewHash(commit)
 	c, err := repo.CommitObject(h)
 	if err != nil {
@@ -461,7 +875,14 @@ func scanCommit(commit string, repo *Repo, f commitScanner) error {
 // of said Commit. Similar to scan(), if the files contained in the Commit are a binaries or if they are
 // allowlisted then those files will be skipped.
 func scanCommitPatches(c *object.Commit, repo *Repo) error {
-	if len(c.ParentHashes) == 0 {
+	c, err := repo.ensureBlobs(c, false)
+	if err != nil {
+		return err
+	}
+	if len(c.ParentHashes) > 1 && repo.Manager.Opts.Merges == "skip" {
+		return nil
+	}
+	if len(c.ParentHashes) == 0 && repo.scanChunk(fdiff.Add, true) {
 		err := scanFilesAtCommit(c, repo)
 		if err != nil {
 			return err
@@ -490,7 +911,7 @@ func scanCommitPatches(c *object.Commit, repo *Repo) error {
 		}
 		repo.Manager.RecordTime(manager.PatchTime(howLong(start)))
 
-		scanPatch(patch, c, repo)
+		scanPatch(patch, c, repo, repo.mergeParent(c, parent.Hash))
 
 		return nil
 	})
@@ -501,18 +922,26 @@ func scanCommitPatches(c *object.Commit, repo *Repo) error {
 // of said Commit. Similar to scan(), if the files contained in the Commit are a binaries or if they are
 // allowlisted then those files will be skipped.
 func scanFilesAtCommit(c *object.Commit, repo *Repo) error {
+	c, err := repo.ensureBlobs(c, true)
+	if err != nil {
+		return err
+	}
 	fIter, err := c.Files()
 	if err != nil {
 		return err
 	}
 
 	err = fIter.ForEach(func(f *object.File) error {
-		bin, err := f.IsBinary()
-		if bin || repo.timeoutReached() {
+		if repo.timeoutReached() || repo.skipPath(f.Name) {
 			return nil
-		} else if err != nil {
+		}
+		head, err := fileHead(f)
+		if err != nil {
 			return err
 		}
+		if repo.skipContent(f.Name, head, false) {
+			return nil
+		}
 
 		content, err := f.Contents()
 		if err != nil {
@@ -525,12 +954,56 @@ func scanFilesAtCommit(c *object.Commit, repo *Repo) error {
 			Commit:    c,
 			scanType:  commitScan,
 			Operation: fdiff.Add,
+			startLine: 1,
 		})
+		repo.scanLFS(c, f.Name, content)
 		return nil
 	})
 	return err
 }
 
+// diffParents returns the parents commit c is diffed against. That is the first parent unless c is a merge
+// and --merges=all-parents is set.
+func (repo *Repo) diffParents(c *object.Commit) ([]*object.Commit, error) {
+	if len(c.ParentHashes) > 1 && repo.Manager.Opts.Merges == "all-parents" {
+		var parents []*object.Commit
+		err := c.Parents().ForEach(func(parent *object.Commit) error {
+			parents = append(parents, parent)
+			return nil
+		})
+		return parents, err
+	}
+	parent, err := c.Parent(0)
+	if err != nil {
+		return nil, err
+	}
+	return []*object.Commit{parent}, nil
+}
+
+// mergeParent returns the hash of parent if c is a merge commit diffed against all of its parents.
+// Leaks found in such merge commits are annotated with the parent the merge was diffed against.
+func (repo *Repo) mergeParent(c *object.Commit, parent plumbing.Hash) string {
+	if len(c.ParentHashes) < 2 || repo.Manager.Opts.Merges != "all-parents" {
+		return ""
+	}
+	return parent.String()
+}
+
+// scanChunk checks if changed lines of type op should be scanned according to --operations.
+// Added lines count as an add operation if the file is new and as a modify operation otherwise.
+func (repo *Repo) scanChunk(op fdiff.Operation, newFile bool) bool {
+	switch {
+	case op == fdiff.Delete:
+		return repo.Manager.Opts.ScanOperation("delete")
+	case op != fdiff.Add:
+		return false
+	case newFile:
+		return repo.Manager.Opts.ScanOperation("add")
+	default:
+		return repo.Manager.Opts.ScanOperation("modify")
+	}
+}
+
 // depthReached checks if i meets the depth (--depth=) if set
 func (repo *Repo) depthReached(i int) bool {
 	if repo.Manager.Opts.Depth != 0 && repo.Manager.Opts.Depth == i {
@@ -540,6 +1013,12 @@ func (repo *Repo) depthReached(i int) bool {
 	return false
 }
 
+// isSymlink returns true if the file at path is a symbolic link
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
 // emptyCommit generates an empty commit used for scanning uncommitted changes
 func emptyCommit() *object.Commit {
 	return &object.Commit{
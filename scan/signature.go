@@ -0,0 +1,110 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	pgpSignatureHeader  = "-----BEGIN PGP SIGNATURE-----"
+	sshSignatureHeader  = "-----BEGIN SSH SIGNATURE-----"
+	x509SignatureHeader = "-----BEGIN SIGNED MESSAGE-----"
+
+	// sshSignatureMagic starts the blob of ssh signatures, see PROTOCOL.sshsig of openssh
+	sshSignatureMagic = "SSHSIG"
+)
+
+// commitSignature returns how commit c was signed, gpg, ssh or x509, and the key it was signed with, or empty
+// strings if c isn't signed. The signature isn't verified. Commits read from `git log` output don't carry
+// their signature, which is then read from the repo, once per commit.
+func (repo *Repo) commitSignature(c *object.Commit) (string, string) {
+	if c.Hash.IsZero() {
+		return "", ""
+	}
+	if s, ok := repo.signatures.Load(c.Hash); ok {
+		sig := s.([2]string)
+		return sig[0], sig[1]
+	}
+	signature := c.PGPSignature
+	if signature == "" && repo.Repository != nil {
+		if commit, err := repo.CommitObject(c.Hash); err == nil {
+			signature = commit.PGPSignature
+		}
+	}
+	kind, key := parseSignature(signature)
+	repo.signatures.Store(c.Hash, [2]string{kind, key})
+	return kind, key
+}
+
+// parseSignature returns the kind of the commit signature and the key it was signed with: the id of the gpg
+// key, the SHA256 fingerprint of the ssh key or, for x509 signatures, nothing
+func parseSignature(signature string) (string, string) {
+	signature = strings.TrimSpace(signature)
+	switch {
+	case signature == "":
+		return "", ""
+	case strings.HasPrefix(signature, pgpSignatureHeader):
+		return "gpg", pgpKeyID(signature)
+	case strings.HasPrefix(signature, sshSignatureHeader):
+		return "ssh", sshKeyFingerprint(signature)
+	case strings.HasPrefix(signature, x509SignatureHeader):
+		return "x509", ""
+	}
+	return "unknown", ""
+}
+
+// pgpKeyID returns the id of the key issuing the armored pgp signature, or "" if it can't be read
+func pgpKeyID(signature string) string {
+	block, err := armor.Decode(strings.NewReader(signature))
+	if err != nil {
+		return ""
+	}
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return ""
+	}
+	if sig, ok := p.(*packet.Signature); ok && sig.IssuerKeyId != nil {
+		return fmt.Sprintf("%016X", *sig.IssuerKeyId)
+	}
+	return ""
+}
+
+// sshKeyFingerprint returns the fingerprint of the public key of the armored ssh signature, or "" if it
+// can't be read
+func sshKeyFingerprint(signature string) string {
+	lines := strings.Split(signature, "\n")
+	var encoded strings.Builder
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "-----END") {
+			break
+		}
+		encoded.WriteString(line)
+	}
+	blob, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil || !bytes.HasPrefix(blob, []byte(sshSignatureMagic)) {
+		return ""
+	}
+	// the magic is followed by the version and the public key as a length prefixed string
+	blob = blob[len(sshSignatureMagic):]
+	if len(blob) < 8 {
+		return ""
+	}
+	n := binary.BigEndian.Uint32(blob[4:8])
+	if uint32(len(blob)-8) < n {
+		return ""
+	}
+	key, err := ssh.ParsePublicKey(blob[8 : 8+n])
+	if err != nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(key)
+}
@@ -0,0 +1,133 @@
+package scan
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+// sniffLen is how much of the content of a file is looked at to tell if it's binary, the same as git, and to
+// sniff its mime type
+const sniffLen = 8000
+
+// skipPath returns true if the file at path is skipped because it ends in an extension of --skip-extensions.
+// Files are checked before they are read.
+func (repo *Repo) skipPath(path string) bool {
+	if !repo.Manager.Opts.SkipsExtension(path) {
+		return false
+	}
+	repo.skipped(path, "extension")
+	return true
+}
+
+// skipContent returns true if the file at path is skipped because its mime type, sniffed from head, the start
+// of its content, is of a kind of --skip-mime or because it's binary. binary is set for files already known to
+// be binary, like the files of binary patches.
+func (repo *Repo) skipContent(path, head string, binary bool) bool {
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	if kind := mimeKind(http.DetectContentType([]byte(head))); kind != "" {
+		for _, skipped := range repo.Manager.Opts.SkippedMIME() {
+			if kind == skipped {
+				repo.skipped(path, kind)
+				return true
+			}
+		}
+	}
+	if binary || isBinary([]byte(head)) {
+		repo.skipped(path, "binary")
+		return true
+	}
+	return false
+}
+
+// skipped counts the file at path as skipped for reason
+func (repo *Repo) skipped(path, reason string) {
+	log.Debugf("skipping file %s: %s", path, reason)
+	repo.Manager.IncrementSkippedFiles(reason)
+}
+
+// mimeKind returns the kind of --skip-mime of the files of contentType, or "" if it isn't of any kind
+func mimeKind(contentType string) string {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return "image"
+	case strings.HasPrefix(mediaType, "font/"), mediaType == "application/vnd.ms-fontobject":
+		return "font"
+	case strings.HasPrefix(mediaType, "audio/"), mediaType == "application/ogg":
+		return "audio"
+	case strings.HasPrefix(mediaType, "video/"):
+		return "video"
+	}
+	switch mediaType {
+	case "application/zip", "application/x-gzip", "application/x-rar-compressed", "application/x-7z-compressed":
+		return "archive"
+	case "application/pdf", "application/postscript":
+		return "document"
+	}
+	return ""
+}
+
+// fileHead returns the start of the content of f, enough to sniff its mime type
+func fileHead(f *object.File) (string, error) {
+	r, err := f.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	return readHead(r)
+}
+
+// blobHead returns the start of the content of the blob hash, or "" if the blob can't be read, like blobs
+// missing from partial clones
+func (repo *Repo) blobHead(hash plumbing.Hash) string {
+	blob, err := repo.BlobObject(hash)
+	if err != nil {
+		return ""
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+	head, _ := readHead(r)
+	return head
+}
+
+// fileHeadAt returns the start of the content of the file at path in commit, or "" if it can't be read, like
+// files deleted by the commit
+func (repo *Repo) fileHeadAt(commit plumbing.Hash, path string) string {
+	c, err := repo.CommitObject(commit)
+	if err != nil {
+		return ""
+	}
+	f, err := c.File(path)
+	if err != nil {
+		return ""
+	}
+	head, _ := fileHead(f)
+	return head
+}
+
+// sniffHead returns the start of content, enough to sniff its mime type
+func sniffHead(content []byte) string {
+	if len(content) > sniffLen {
+		content = content[:sniffLen]
+	}
+	return string(content)
+}
+
+func readHead(r io.Reader) (string, error) {
+	var head strings.Builder
+	_, err := io.CopyN(&head, r, sniffLen)
+	if err == io.EOF {
+		err = nil
+	}
+	return head.String(), err
+}
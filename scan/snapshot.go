@@ -0,0 +1,603 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	log "github.com/sirupsen/logrus"
+)
+
+// OpenBundle loads a git bundle file (--bundle=) into memory so its history can be scanned
+// without importing the bundle into a repository.
+// See https://git-scm.com/docs/gitformat-bundle
+func (repo *Repo) OpenBundle(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if header != "# v2 git bundle\n" && header != "# v3 git bundle\n" {
+		return fmt.Errorf("%s is not a git bundle", path)
+	}
+
+	refs := make(map[plumbing.ReferenceName]plumbing.Hash)
+	var refOrder []plumbing.ReferenceName
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("unable to read bundle header of %s: %v", path, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+		switch line[0] {
+		case '@':
+			// v3 capabilities, only sha1 bundles are supported by go-git
+			if strings.HasPrefix(line, "@object-format=") && line != "@object-format=sha1" {
+				return fmt.Errorf("unsupported bundle %s: %s", path, line)
+			}
+		case '-':
+			log.Warnf("bundle %s is incremental, commits depending on %s can not be fully scanned", path, line[1:])
+		default:
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) != 2 {
+				return fmt.Errorf("invalid bundle reference in %s: %q", path, line)
+			}
+			name := plumbing.ReferenceName(fields[1])
+			refs[name] = plumbing.NewHash(fields[0])
+			refOrder = append(refOrder, name)
+		}
+	}
+
+	storage := memory.NewStorage()
+	if err := packfile.UpdateObjectStorage(storage, r); err != nil {
+		return err
+	}
+	if err := setSnapshotRefs(storage, refs, refOrder); err != nil {
+		return err
+	}
+	return repo.openSnapshot(storage, path)
+}
+
+// OpenFastExport reconstructs the commits and blobs of a `git fast-export` stream (--fast-export=) in
+// memory so they can be scanned like any other repository. A path of "-" reads the stream from stdin.
+// Streams don't carry commit signatures so signed commits end up with different hashes than in the original repository.
+func (repo *Repo) OpenFastExport(path string) error {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	storage := memory.NewStorage()
+	fe := &fastExport{
+		r:       bufio.NewReader(in),
+		storage: storage,
+		marks:   make(map[string]plumbing.Hash),
+		refs:    make(map[plumbing.ReferenceName]plumbing.Hash),
+		files:   make(map[plumbing.Hash]map[string]fastExportFile),
+	}
+	if err := fe.parse(); err != nil {
+		return fmt.Errorf("unable to parse fast-export stream %s: %v", path, err)
+	}
+	if err := setSnapshotRefs(storage, fe.refs, fe.refOrder); err != nil {
+		return err
+	}
+	return repo.openSnapshot(storage, path)
+}
+
+// openSnapshot opens the repository stored in storage and names it after the snapshot file
+func (repo *Repo) openSnapshot(storage *memory.Storage, path string) error {
+	repository, err := git.Open(storage, nil)
+	if err != nil {
+		return err
+	}
+	repo.Repository = repository
+	repo.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if path == "-" {
+		repo.Name = "stdin"
+	}
+	return nil
+}
+
+// setSnapshotRefs stores refs and points HEAD to the snapshot's HEAD, or otherwise its first branch
+func setSnapshotRefs(storage *memory.Storage, refs map[plumbing.ReferenceName]plumbing.Hash, order []plumbing.ReferenceName) error {
+	if len(refs) == 0 {
+		return fmt.Errorf("snapshot does not contain any references")
+	}
+	var head *plumbing.Reference
+	for _, name := range order {
+		if name == plumbing.HEAD {
+			head = plumbing.NewHashReference(plumbing.HEAD, refs[name])
+			continue
+		}
+		if err := storage.SetReference(plumbing.NewHashReference(name, refs[name])); err != nil {
+			return err
+		}
+		if head == nil && name.IsBranch() {
+			head = plumbing.NewSymbolicReference(plumbing.HEAD, name)
+		}
+	}
+	if head == nil {
+		head = plumbing.NewHashReference(plumbing.HEAD, refs[order[0]])
+	}
+	return storage.SetReference(head)
+}
+
+// fastExportFile is a file of a commit's tree while reconstructing a fast-export stream
+type fastExportFile struct {
+	mode filemode.FileMode
+	hash plumbing.Hash
+}
+
+// fastExport parses the subset of the fast-import format emitted by `git fast-export`.
+// See https://git-scm.com/docs/git-fast-import#_input_format
+type fastExport struct {
+	r       *bufio.Reader
+	storage *memory.Storage
+
+	// pending is a line read ahead while looking for the end of a command
+	pending *string
+
+	marks    map[string]plumbing.Hash
+	refs     map[plumbing.ReferenceName]plumbing.Hash
+	refOrder []plumbing.ReferenceName
+	files    map[plumbing.Hash]map[string]fastExportFile
+}
+
+func (fe *fastExport) readLine() (string, error) {
+	if fe.pending != nil {
+		line := *fe.pending
+		fe.pending = nil
+		return line, nil
+	}
+	line, err := fe.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+func (fe *fastExport) unreadLine(line string) {
+	fe.pending = &line
+}
+
+func (fe *fastExport) parse() error {
+	for {
+		line, err := fe.readLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		cmd := strings.SplitN(line, " ", 2)[0]
+		switch cmd {
+		case "blob":
+			err = fe.parseBlob()
+		case "commit":
+			err = fe.parseCommit(strings.TrimPrefix(line, "commit "))
+		case "reset":
+			err = fe.parseReset(strings.TrimPrefix(line, "reset "))
+		case "tag":
+			err = fe.skipCommand()
+		case "done":
+			return nil
+		case "", "feature", "option", "progress", "checkpoint", "get-mark", "cat-blob", "ls", "alias":
+		default:
+			return fmt.Errorf("unsupported command %q", line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readData reads the payload of a `data` command in either the exact byte count or delimited format
+func (fe *fastExport) readData(line string) ([]byte, error) {
+	arg := strings.TrimPrefix(line, "data ")
+	if strings.HasPrefix(arg, "<<") {
+		delim := arg[2:]
+		var buf bytes.Buffer
+		for {
+			l, err := fe.readLine()
+			if err != nil {
+				return nil, err
+			}
+			if l == delim {
+				return buf.Bytes(), nil
+			}
+			buf.WriteString(l + "\n")
+		}
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data command %q", line)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(fe.r, data); err != nil {
+		return nil, err
+	}
+	// the payload may be followed by an optional LF
+	if b, err := fe.r.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = fe.r.ReadByte()
+	}
+	return data, nil
+}
+
+func (fe *fastExport) storeObject(t plumbing.ObjectType, data []byte) (plumbing.Hash, error) {
+	obj := fe.storage.NewEncodedObject()
+	obj.SetType(t)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return fe.storage.SetEncodedObject(obj)
+}
+
+func (fe *fastExport) parseBlob() error {
+	var mark string
+	for {
+		line, err := fe.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "mark "):
+			mark = strings.TrimPrefix(line, "mark ")
+		case strings.HasPrefix(line, "original-oid "):
+		case strings.HasPrefix(line, "data "):
+			data, err := fe.readData(line)
+			if err != nil {
+				return err
+			}
+			h, err := fe.storeObject(plumbing.BlobObject, data)
+			if err != nil {
+				return err
+			}
+			if mark != "" {
+				fe.marks[mark] = h
+			}
+			return nil
+		default:
+			return fmt.Errorf("unexpected line in blob: %q", line)
+		}
+	}
+}
+
+// resolve returns the hash of a commit-ish which is either a mark, a full sha, or a ref seen earlier in the stream
+func (fe *fastExport) resolve(ref string) (plumbing.Hash, error) {
+	if h, ok := fe.marks[ref]; ok {
+		return h, nil
+	}
+	if plumbing.IsHash(ref) {
+		return plumbing.NewHash(ref), nil
+	}
+	if h, ok := fe.refs[plumbing.ReferenceName(strings.TrimSuffix(ref, "^0"))]; ok {
+		return h, nil
+	}
+	return plumbing.ZeroHash, fmt.Errorf("unknown commit %q", ref)
+}
+
+func (fe *fastExport) setRef(name plumbing.ReferenceName, h plumbing.Hash) {
+	if _, ok := fe.refs[name]; !ok {
+		fe.refOrder = append(fe.refOrder, name)
+	}
+	fe.refs[name] = h
+}
+
+func (fe *fastExport) parseReset(ref string) error {
+	line, err := fe.readLine()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !strings.HasPrefix(line, "from ") {
+		fe.unreadLine(line)
+		return nil
+	}
+	h, err := fe.resolve(strings.TrimPrefix(line, "from "))
+	if err != nil {
+		return err
+	}
+	fe.setRef(plumbing.ReferenceName(ref), h)
+	return nil
+}
+
+// skipCommand skips a command such as tag, including its data payload
+func (fe *fastExport) skipCommand() error {
+	for {
+		line, err := fe.readLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "data ") {
+			_, err := fe.readData(line)
+			return err
+		}
+	}
+}
+
+func (fe *fastExport) parseCommit(ref string) error {
+	var (
+		mark    string
+		commit  object.Commit
+		files   map[string]fastExportFile
+		started bool
+		err     error
+	)
+	refName := plumbing.ReferenceName(ref)
+	if h, ok := fe.refs[refName]; ok {
+		// commits without a from command continue the branch
+		files = copyFiles(fe.files[h])
+		commit.ParentHashes = []plumbing.Hash{h}
+	} else {
+		files = make(map[string]fastExportFile)
+	}
+
+	for {
+		line, readErr := fe.readLine()
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		switch {
+		case strings.HasPrefix(line, "mark "):
+			mark = strings.TrimPrefix(line, "mark ")
+		case strings.HasPrefix(line, "original-oid "), strings.HasPrefix(line, "encoding "):
+		case strings.HasPrefix(line, "author "):
+			commit.Author, err = parseFastExportIdent(strings.TrimPrefix(line, "author "))
+		case strings.HasPrefix(line, "committer "):
+			commit.Committer, err = parseFastExportIdent(strings.TrimPrefix(line, "committer "))
+		case strings.HasPrefix(line, "data ") && !started:
+			var msg []byte
+			msg, err = fe.readData(line)
+			commit.Message = string(msg)
+			started = true
+		case strings.HasPrefix(line, "from "):
+			var h plumbing.Hash
+			if h, err = fe.resolve(strings.TrimPrefix(line, "from ")); err == nil {
+				files = copyFiles(fe.files[h])
+				commit.ParentHashes = []plumbing.Hash{h}
+			}
+		case strings.HasPrefix(line, "merge "):
+			var h plumbing.Hash
+			if h, err = fe.resolve(strings.TrimPrefix(line, "merge ")); err == nil {
+				commit.ParentHashes = append(commit.ParentHashes, h)
+			}
+		case strings.HasPrefix(line, "M "):
+			err = fe.parseModify(line, files)
+		case strings.HasPrefix(line, "D "):
+			deletePath(files, unquotePath(strings.TrimPrefix(line, "D ")))
+		case strings.HasPrefix(line, "C "), strings.HasPrefix(line, "R "):
+			src, dst := splitPaths(line[2:])
+			for p, f := range copyFiles(files) {
+				if p == src || strings.HasPrefix(p, src+"/") {
+					if line[0] == 'R' {
+						delete(files, p)
+					}
+					files[dst+strings.TrimPrefix(p, src)] = f
+				}
+			}
+		case line == "deleteall":
+			files = make(map[string]fastExportFile)
+		case strings.HasPrefix(line, "N "):
+			// notes are not part of the commit's tree
+			if strings.Contains(line, " inline ") {
+				next, err := fe.readLine()
+				if err != nil {
+					return err
+				}
+				if _, err := fe.readData(next); err != nil {
+					return err
+				}
+			}
+		default:
+			// anything else ends the commit
+			if line != "" {
+				fe.unreadLine(line)
+			}
+			return fe.storeCommit(refName, mark, commit, files)
+		}
+		if err != nil {
+			return err
+		}
+		if readErr == io.EOF {
+			return fe.storeCommit(refName, mark, commit, files)
+		}
+	}
+}
+
+func (fe *fastExport) parseModify(line string, files map[string]fastExportFile) error {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 {
+		return fmt.Errorf("invalid filemodify command %q", line)
+	}
+	mode, err := filemode.New(fields[1])
+	if err != nil {
+		return err
+	}
+	path := unquotePath(fields[3])
+
+	var h plumbing.Hash
+	if fields[2] == "inline" {
+		next, err := fe.readLine()
+		if err != nil {
+			return err
+		}
+		data, err := fe.readData(next)
+		if err != nil {
+			return err
+		}
+		if h, err = fe.storeObject(plumbing.BlobObject, data); err != nil {
+			return err
+		}
+	} else if h, err = fe.resolve(fields[2]); err != nil {
+		return err
+	}
+	files[path] = fastExportFile{mode: mode, hash: h}
+	return nil
+}
+
+func (fe *fastExport) storeCommit(ref plumbing.ReferenceName, mark string, commit object.Commit, files map[string]fastExportFile) error {
+	if commit.Author.Email == "" && commit.Author.Name == "" {
+		commit.Author = commit.Committer
+	}
+	treeHash, err := fe.storeTree(files, "")
+	if err != nil {
+		return err
+	}
+	commit.TreeHash = treeHash
+
+	obj := fe.storage.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return err
+	}
+	h, err := fe.storage.SetEncodedObject(obj)
+	if err != nil {
+		return err
+	}
+	if mark != "" {
+		fe.marks[mark] = h
+	}
+	fe.files[h] = files
+	fe.setRef(ref, h)
+	return nil
+}
+
+// storeTree writes the tree of the files under dir, and all of its subtrees, to the object storage
+func (fe *fastExport) storeTree(files map[string]fastExportFile, dir string) (plumbing.Hash, error) {
+	subdirs := make(map[string]bool)
+	var tree object.Tree
+	for p, f := range files {
+		if dir != "" {
+			if !strings.HasPrefix(p, dir+"/") {
+				continue
+			}
+			p = strings.TrimPrefix(p, dir+"/")
+		}
+		if i := strings.Index(p, "/"); i != -1 {
+			subdirs[p[:i]] = true
+			continue
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: p, Mode: f.mode, Hash: f.hash})
+	}
+	for name := range subdirs {
+		h, err := fe.storeTree(files, strings.TrimPrefix(dir+"/"+name, "/"))
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: h})
+	}
+
+	// git sorts tree entries as if directory names end with a slash
+	sortName := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool { return sortName(tree.Entries[i]) < sortName(tree.Entries[j]) })
+
+	obj := fe.storage.NewEncodedObject()
+	if err := tree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return fe.storage.SetEncodedObject(obj)
+}
+
+// parseFastExportIdent parses an identity like `Name <email> 1136239445 -0700`
+func parseFastExportIdent(s string) (object.Signature, error) {
+	open, closing := strings.Index(s, "<"), strings.LastIndex(s, ">")
+	if open == -1 || closing < open {
+		return object.Signature{}, fmt.Errorf("invalid identity %q", s)
+	}
+	sig := object.Signature{
+		Name:  strings.TrimSpace(s[:open]),
+		Email: s[open+1 : closing],
+	}
+	fields := strings.Fields(s[closing+1:])
+	if len(fields) != 2 {
+		return sig, nil
+	}
+	sec, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return sig, nil
+	}
+	when := time.Unix(sec, 0)
+	if tz, err := time.Parse("-0700", fields[1]); err == nil {
+		when = when.In(tz.Location())
+	}
+	sig.When = when
+	return sig, nil
+}
+
+// unquotePath removes the C style quoting fast-export uses for paths with special characters
+func unquotePath(p string) string {
+	if strings.HasPrefix(p, "\"") {
+		if unquoted, err := strconv.Unquote(p); err == nil {
+			return unquoted
+		}
+	}
+	return p
+}
+
+// splitPaths splits the source and destination paths of a copy or rename command
+func splitPaths(s string) (string, string) {
+	if strings.HasPrefix(s, "\"") {
+		for i := 1; i < len(s); i++ {
+			if s[i] == '"' && s[i-1] != '\\' {
+				return unquotePath(s[:i+1]), unquotePath(strings.TrimPrefix(s[i+1:], " "))
+			}
+		}
+	}
+	fields := strings.SplitN(s, " ", 2)
+	if len(fields) != 2 {
+		return s, ""
+	}
+	return fields[0], unquotePath(fields[1])
+}
+
+func deletePath(files map[string]fastExportFile, path string) {
+	for p := range files {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(files, p)
+		}
+	}
+}
+
+func copyFiles(files map[string]fastExportFile) map[string]fastExportFile {
+	c := make(map[string]fastExportFile, len(files))
+	for p, f := range files {
+		c[p] = f
+	}
+	return c
+}
@@ -0,0 +1,171 @@
+package scan
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+	log "github.com/sirupsen/logrus"
+)
+
+// spillStorage stores a clone in memory until the packfile of the clone grows past limit bytes
+// (--memory-limit), then spills it to a temporary directory in dir. Small repos keep the speed of
+// in-memory clones while huge repos are cloned to disk instead of running the process out of memory.
+//
+// The limit is a packfile size: it counts the compressed bytes received, not the memory the clone takes.
+// Objects stored in memory are stored inflated, so a clone kept in memory can take several times the
+// limit. Every packfile received is counted on its own, fetches after the clone start from zero again.
+type spillStorage struct {
+	storage.Storer
+
+	limit int64
+	dir   string
+	name  string
+}
+
+// newSpillStorage returns a storage of the clone of name spilling to a directory in dir past limit bytes
+func newSpillStorage(limit int64, dir, name string) *spillStorage {
+	return &spillStorage{Storer: memory.NewStorage(), limit: limit, dir: dir, name: name}
+}
+
+// PackfileWriter returns a writer keeping the packfile received by a clone or fetch in memory until it's
+// past the limit of the storage. go-git writes packfiles to storages that have a packfile writer instead
+// of storing their objects one by one.
+func (s *spillStorage) PackfileWriter() (io.WriteCloser, error) {
+	return &spillWriter{storage: s}, nil
+}
+
+// spilled returns the storage on disk of the clone, or nil if it's still in memory
+func (s *spillStorage) spilled() *filesystem.Storage {
+	fsStorer, _ := s.Storer.(*filesystem.Storage)
+	return fsStorer
+}
+
+// spill moves the clone to a temporary directory on disk. Everything stored in memory so far is copied
+// over, everything stored after is stored on disk.
+func (s *spillStorage) spill() (*filesystem.Storage, error) {
+	path, err := ioutil.TempDir(s.dir, "gitleaks")
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("%s is past --memory-limit, spilling the clone to %s", s.name, path)
+	fsStorer := filesystem.NewStorage(osfs.New(path), cache.NewObjectLRUDefault())
+	if err := fsStorer.Init(); err != nil {
+		return nil, err
+	}
+
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	if err := fsStorer.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	refs, err := s.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		return fsStorer.SetReference(ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	shallow, err := s.Shallow()
+	if err != nil {
+		return nil, err
+	}
+	if len(shallow) != 0 {
+		if err := fsStorer.SetShallow(shallow); err != nil {
+			return nil, err
+		}
+	}
+	objects, err := s.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return nil, err
+	}
+	err = objects.ForEach(func(obj plumbing.EncodedObject) error {
+		_, err := fsStorer.SetEncodedObject(obj)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.Storer = fsStorer
+	return fsStorer, nil
+}
+
+// spillWriter buffers a packfile in memory and stores it in memory once it's written, or spills the
+// storage and writes the packfile to disk once it's past the limit of the storage
+type spillWriter struct {
+	storage *spillStorage
+	buf     bytes.Buffer
+
+	// pack is the packfile writer of the storage on disk once the storage is spilled
+	pack io.WriteCloser
+}
+
+func (w *spillWriter) Write(p []byte) (int, error) {
+	if w.pack != nil {
+		return w.pack.Write(p)
+	}
+	if fsStorer := w.storage.spilled(); fsStorer != nil {
+		// spilled by an earlier packfile
+		return w.writeToDisk(fsStorer, p)
+	}
+	if int64(w.buf.Len()+len(p)) <= w.storage.limit {
+		return w.buf.Write(p)
+	}
+	fsStorer, err := w.storage.spill()
+	if err != nil {
+		return 0, err
+	}
+	return w.writeToDisk(fsStorer, p)
+}
+
+// writeToDisk writes what was buffered of the packfile and p to the packfile writer of fsStorer
+func (w *spillWriter) writeToDisk(fsStorer *filesystem.Storage, p []byte) (int, error) {
+	pack, err := fsStorer.PackfileWriter()
+	if err != nil {
+		return 0, err
+	}
+	w.pack = pack
+	if _, err := w.pack.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	w.buf = bytes.Buffer{}
+	return w.pack.Write(p)
+}
+
+// Close stores the objects of the packfile
+func (w *spillWriter) Close() error {
+	if w.pack != nil {
+		return w.pack.Close()
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	// memory storages have no packfile writer, the objects of the packfile are parsed into the storage
+	return packfile.UpdateObjectStorage(w.storage.Storer, &w.buf)
+}
+
+// fsStorage returns the storage of the repo if the repo is on disk, like clones spilled to disk past
+// --memory-limit
+func (repo *Repo) fsStorage() (*filesystem.Storage, bool) {
+	switch s := repo.Storer.(type) {
+	case *filesystem.Storage:
+		return s, true
+	case *spillStorage:
+		fsStorer := s.spilled()
+		return fsStorer, fsStorer != nil
+	}
+	return nil, false
+}
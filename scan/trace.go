@@ -0,0 +1,32 @@
+package scan
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartSpan starts the span of the scan of a single repo. The spans of the repo's clone and scan
+// stages become its children, so every repo of a host or owner scan gets a trace of its own. The
+// caller ends the span once the repo is done.
+func (repo *Repo) StartSpan(target string) trace.Span {
+	var span trace.Span
+	repo.ctx, span = repo.startSpan("repo", attribute.String("gitleaks.repo", target))
+	return span
+}
+
+// startSpan starts a span as a child of the repo's current span
+func (repo *Repo) startSpan(name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return repo.Manager.Tracer.Start(repo.ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, marking it as failed if err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}